@@ -2,128 +2,330 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"order-service/internal/auth"
 	"order-service/internal/cache"
+	"order-service/internal/certs"
+	"order-service/internal/config"
 	"order-service/internal/database"
 	"order-service/internal/handlers"
 	"order-service/internal/kafka"
+	"order-service/internal/metrics"
+	"order-service/internal/migrate"
+	"order-service/internal/redact"
+	"order-service/internal/validation"
+	"order-service/migrations"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Загрузка переменных окружения
-	if err := godotenv.Load("config.env"); err != nil {
-		log.Printf("level=warn component=bootstrap event=env_load_warning err=%v", err)
+	// Сборка конфигурации из всех источников
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			log.Printf("level=error component=bootstrap event=invalid_config err=%q", line)
+		}
+		log.Fatalf("level=fatal component=bootstrap event=invalid_config msg=\"configuration is invalid\"")
 	}
 
-	// Получение переменных окружения
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "orders_db")
-	dbSSLMode := getEnv("DB_SSLMODE", "disable")
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
 
-	kafkaBroker := getEnv("KAFKA_BROKER", "localhost:9092")
-	kafkaTopic := getEnv("KAFKA_TOPIC", "orders")
+	// Подкоманда config печатает итоговую конфигурацию и завершает работу
+	if command == "config" {
+		printConfig(cfg)
+		return
+	}
 
-	httpPort := getEnv("HTTP_PORT", "8081")
+	for _, line := range cfg.LogLines() {
+		log.Printf("level=info component=bootstrap event=config %s", line)
+	}
 
-	log.Printf("level=info component=bootstrap event=config db_host=%q db_port=%q db_name=%q kafka_broker=%q topic=%q http_port=%q", dbHost, dbPort, dbName, kafkaBroker, kafkaTopic, httpPort)
+	retryPolicy := cfg.Retry()
+	fetchConfig := cfg.Fetch()
+
+	// Подключение к кластеру Kafka: сертификаты TLS и SASL проверяются до подключения к базе
+	cluster, err := kafka.NewCluster(cfg.Conn())
+	if err != nil {
+		log.Fatalf("level=fatal component=bootstrap event=kafka_config_failed err=%v", err)
+	}
+
+	// Аутентификация HTTP API: JWKS файл читается при старте
+	authConfig, err := cfg.Authentication()
+	if err != nil {
+		log.Fatalf("level=fatal component=bootstrap event=auth_config_failed err=%v", err)
+	}
+	authn, err := auth.New(authConfig)
+	if err != nil {
+		log.Fatalf("level=fatal component=bootstrap event=auth_config_failed err=%v", err)
+	}
+	if !authConfig.Enabled {
+		log.Println("level=warn component=auth event=disabled msg=\"HTTP API is served without authentication, anonymous requests get reader role\"")
+	}
+
+	// Маскирование персональных данных; политика проверена в config.Validate
+	redactor, err := redact.New(cfg.Redaction())
+	if err != nil {
+		log.Fatalf("level=fatal component=bootstrap event=redact_config_failed err=%v", err)
+	}
 
 	// Подключение к базе данных
-	db, err := database.New(dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode)
+	db, err := database.New(cfg.Database())
 	if err != nil {
 		log.Fatalf("level=fatal component=bootstrap event=db_connect_failed err=%v", err)
 	}
 	defer db.Close()
 
+	// Подкоманда migrate выполняет миграции и завершает работу без запуска сервиса
+	if command == "migrate" {
+		if err := runMigrate(context.Background(), db, args[1:]); err != nil {
+			log.Fatalf("level=fatal component=migrate event=failed err=%v", err)
+		}
+		return
+	}
+
+	// Применение миграций при старте
+	if cfg.DB.AutoMigrate {
+		migrator, err := migrate.New(db.Conn(), migrations.FS)
+		if err != nil {
+			log.Fatalf("level=fatal component=bootstrap event=migrations_load_failed err=%v", err)
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("level=fatal component=bootstrap event=migrate_failed err=%v", err)
+		}
+	}
+
 	// Создание кеша
-	orderCache := cache.New()
+	orderCache := cache.New(cfg.CacheLimits())
+	metrics.RegisterCache(orderCache)
 
-	// Восстановление кеша из базы данных
-	log.Println("level=info component=bootstrap event=cache_load msg=\"loading cache from database\"")
-	orders, err := db.GetAllOrders()
-	if err != nil {
-		log.Printf("level=warn component=bootstrap event=cache_load_failed err=%v", err)
+	// Правила валидации по маркетплейсам
+	var validator kafka.OrderValidator
+	var rulesStore *validation.Store
+	if cfg.Validation.RulesFile != "" {
+		rulesStore, err = validation.NewStore(cfg.Validation.RulesFile)
+		if err != nil {
+			log.Fatalf("level=fatal component=bootstrap event=validation_rules_failed err=%v", err)
+		}
+		validator = rulesStore
+	}
+
+	// Подкоманда replay повторно обрабатывает окно топика и завершает работу без запуска сервиса
+	if command == "replay" {
+		replayCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		processor := kafka.NewConsumerFromSource(nil, newDeadLetterWriter(cluster, cfg.Kafka.DLQTopic), retryPolicy, db, orderCache, validator)
+		processor.SetRedactor(redactor)
+		defer processor.Close()
+
+		replayer := kafka.NewReplayer(processor, kafka.NewReplaySource(cluster, cfg.Kafka.Topic, fetchConfig))
+		if err := runReplay(replayCtx, replayer, args[1:]); err != nil {
+			log.Fatalf("level=fatal component=kafka_replay event=failed err=%v", err)
+		}
+		return
+	}
+
+	if command != "" {
+		log.Fatalf("level=fatal component=bootstrap event=unknown_command command=%q msg=\"expected migrate, replay or config\"", command)
+	}
+
+	// Контекст для graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Создание Kafka consumer
+	var consumer *kafka.Consumer
+	if cfg.Kafka.OffsetStorage == config.OffsetStoragePostgres {
+		source, err := kafka.NewStoredOffsetSource(cluster, cfg.Kafka.Topic, fetchConfig, db)
+		if err != nil {
+			log.Fatalf("level=fatal component=bootstrap event=kafka_connect_failed err=%v", err)
+		}
+		consumer = kafka.NewConsumerFromSource(source, newDeadLetterWriter(cluster, cfg.Kafka.DLQTopic), retryPolicy, db, orderCache, validator)
+		consumer.StoreOffsets(db, fetchConfig.GroupID)
 	} else {
-		orderCache.LoadFromDB(orders)
+		consumer = kafka.NewConsumer(cluster, cfg.Kafka.Topic, cfg.Kafka.DLQTopic, fetchConfig, retryPolicy, db, orderCache, validator)
 	}
+	consumer.SetBatch(cfg.Batch())
+	consumer.SetWorkers(cfg.Workers())
+	consumer.SetRedactor(redactor)
 
 	// Создание HTTP handlers
-	orderHandler := handlers.NewOrderHandler(db, orderCache)
+	orderHandler := handlers.NewOrderHandler(db, orderCache, redactor)
 
 	// Настройка роутера
 	router := mux.NewRouter()
+	router.Use(handlers.MetricsMiddleware)
 
 	// Health endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"status":"ok"}`))
+		_, _ = fmt.Fprintf(w, `{"status":"ok","cache_warmup":%q}`, orderCache.WarmupState())
 	}).Methods("GET")
 
-	// API endpoints
-	router.HandleFunc("/order/{order_uid}", orderHandler.GetOrder).Methods("GET")
-	router.HandleFunc("/cache/stats", orderHandler.GetCacheStats).Methods("GET")
+	// API endpoints; каждый маршрут требует роль, старшие роли включают младшие
+	protect := func(role auth.Role, h http.HandlerFunc) http.Handler {
+		return authn.Require(role)(h)
+	}
+	router.Handle("/orders", protect(auth.RoleReader, orderHandler.ListOrders)).Methods("GET")
+	router.Handle("/order/{order_uid}", protect(auth.RoleReader, orderHandler.GetOrder)).Methods("GET")
+	router.Handle("/order/{order_uid}/history", protect(auth.RoleSupport, orderHandler.GetOrderHistory)).Methods("GET")
+	router.Handle("/order/{order_uid}/status", protect(auth.RoleReader, orderHandler.GetOrderStatus)).Methods("GET")
+	router.Handle("/track/{track_number}", protect(auth.RoleReader, orderHandler.GetOrderByTrackNumber)).Methods("GET")
+	router.Handle("/payment/{transaction}", protect(auth.RoleReader, orderHandler.GetOrderByTransaction)).Methods("GET")
+	router.Handle("/cache/stats", protect(auth.RoleSupport, orderHandler.GetCacheStats)).Methods("GET")
+
+	// Администрирование; без аутентификации маршруты не регистрируются
+	if authConfig.Enabled {
+		replayHandler := handlers.NewReplayHandler(ctx, kafka.NewReplayer(consumer, kafka.NewReplaySource(cluster, cfg.Kafka.Topic, fetchConfig)))
+		router.Handle("/admin/replay", protect(auth.RoleAdmin, replayHandler.StartReplay)).Methods("POST")
+		router.Handle("/admin/replay", protect(auth.RoleAdmin, replayHandler.GetReplay)).Methods("GET")
+		router.Handle("/admin/replay", protect(auth.RoleAdmin, replayHandler.CancelReplay)).Methods("DELETE")
+	} else {
+		log.Println("level=warn component=auth event=admin_routes_disabled msg=\"/admin routes require AUTH_ENABLED=true\"")
+	}
+
+	// Метрики Prometheus
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	// Статические файлы
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./web/static/")))
+	router.PathPrefix("/").Handler(http.FileServer(http.Dir(cfg.HTTP.StaticDir)))
 
 	// Создание HTTP сервера
 	server := &http.Server{
-		Addr:         ":" + httpPort,
+		Addr:         ":" + strconv.Itoa(cfg.HTTP.Port),
 		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
 	}
 
-	// Создание Kafka consumer
-	consumer := kafka.NewConsumer(kafkaBroker, kafkaTopic, db, orderCache)
+	// HTTPS: сертификаты перечитываются при ротации, клиентские проверяются по CA из конфигурации
+	scheme := "http"
+	var certStore *certs.Store
+	var redirectServer *http.Server
+	if cfg.HTTP.TLS.Enabled {
+		clientAuth, _ := certs.ParseClientAuth(cfg.HTTP.TLS.ClientAuth) // проверено в config.Validate
+		certStore, err = certs.NewStore(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile, cfg.HTTP.TLS.ClientCAFile, clientAuth)
+		if err != nil {
+			log.Fatalf("level=fatal component=bootstrap event=tls_load_failed err=%v", err)
+		}
+		server.TLSConfig = certStore.TLSConfig()
+		scheme = "https"
 
-	// Контекст для graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+		if cfg.HTTP.RedirectPort != 0 {
+			redirectServer = &http.Server{
+				Addr:         ":" + strconv.Itoa(cfg.HTTP.RedirectPort),
+				Handler:      handlers.RedirectToHTTPS(cfg.HTTP.Port),
+				ReadTimeout:  cfg.HTTP.ReadTimeout,
+				WriteTimeout: cfg.HTTP.WriteTimeout,
+				IdleTimeout:  cfg.HTTP.IdleTimeout,
+			}
+		}
+	}
+
+	// Перечитывание правил валидации при изменении файла
+	if rulesStore != nil {
+		go rulesStore.Watch(ctx, cfg.Validation.RulesReload)
+	}
+
+	// Перечитывание JWKS при изменении файла
+	go authn.Watch(ctx, cfg.Auth.JWKSReload)
+
+	// Перечитывание сертификатов HTTPS при изменении файлов
+	if certStore != nil {
+		go certStore.Watch(ctx, cfg.HTTP.TLS.ReloadInterval)
+	}
+
+	// Прогрев кеша в фоне: пока он идет, промахи обслуживаются базой данных
+	go func() {
+		log.Println("level=info component=bootstrap event=cache_load msg=\"warming up cache from database\"")
+		if err := orderCache.WarmUp(ctx, db, cfg.Cache.WarmupChunk); err != nil {
+			log.Printf("level=warn component=bootstrap event=cache_load_failed err=%v", err)
+		}
+	}()
 
 	// Запуск Kafka consumer в отдельной горутине
-	go consumer.Start(ctx)
+	consumerErr := make(chan error, 1)
+	go func() {
+		consumerErr <- consumer.Start(ctx)
+	}()
 
 	// Запуск HTTP сервера в отдельной горутине
 	go func() {
-		log.Printf("level=info component=http event=start port=%s", httpPort)
-		log.Printf("level=info component=http event=endpoints web=\"http://localhost:%s\" api_example=\"http://localhost:%s/order/<order_uid>\"", httpPort, httpPort)
+		log.Printf("level=info component=http event=start port=%d tls=%t client_auth=%s", cfg.HTTP.Port, certStore != nil, cfg.HTTP.TLS.ClientAuth)
+		log.Printf("level=info component=http event=endpoints web=\"%s://localhost:%d\" api_example=\"%s://localhost:%d/order/<order_uid>\"", scheme, cfg.HTTP.Port, scheme, cfg.HTTP.Port)
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if certStore != nil {
+			// Сертификат берется из TLSConfig, поэтому пути к файлам не передаются
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("level=fatal component=http event=server_failed err=%v", err)
 		}
 	}()
 
+	// Перенаправление открытого HTTP на HTTPS
+	if redirectServer != nil {
+		go func() {
+			log.Printf("level=info component=http event=redirect_start port=%d target_port=%d", cfg.HTTP.RedirectPort, cfg.HTTP.Port)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("level=fatal component=http event=redirect_server_failed err=%v", err)
+			}
+		}()
+	}
+
 	// Обработка сигналов для graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Ожидание сигнала завершения
-	<-sigChan
+	// Ожидание сигнала завершения или остановки consumer
+	select {
+	case <-sigChan:
+	case err := <-consumerErr:
+		if err != nil {
+			log.Printf("level=error component=kafka_consumer event=stopped err=%v", err)
+		}
+	}
 	log.Println("level=info component=bootstrap event=shutdown msg=\"shutting down gracefully\"")
 
 	// Остановка контекста для Kafka consumer
 	cancel()
 
 	// Остановка HTTP сервера
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
 	defer shutdownCancel()
 
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("level=error component=http event=shutdown_error err=%v", err)
 	}
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("level=error component=http event=redirect_shutdown_error err=%v", err)
+		}
+	}
 
 	// Закрытие Kafka consumer
 	if err := consumer.Close(); err != nil {
@@ -133,10 +335,114 @@ func main() {
 	log.Println("level=info component=bootstrap event=stopped msg=\"server stopped\"")
 }
 
-// getEnv получает переменную окружения или возвращает значение по умолчанию
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// runMigrate выполняет подкоманду migrate: up, down [N] или status
+func runMigrate(ctx context.Context, db *database.DB, args []string) error {
+	migrator, err := migrate.New(db.Conn(), migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("V%03d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down [N] or status)", command)
+	}
+}
+
+// printConfig печатает итоговую конфигурацию с источниками значений; секреты скрыты
+func printConfig(cfg *config.Config) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tENV")
+	for _, s := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Key, s.Value, s.Source, s.Env)
+	}
+	_ = w.Flush()
+}
+
+// newDeadLetterWriter создает writer dead-letter топика или возвращает nil, если топик не задан
+func newDeadLetterWriter(cluster *kafka.Cluster, topic string) *kafka.DeadLetterWriter {
+	if topic == "" {
+		return nil
+	}
+	return kafka.NewDeadLetterWriter(cluster, topic)
+}
+
+// runReplay разбирает аргументы подкоманды replay, выполняет повторное чтение и печатает итог в JSON
+func runReplay(ctx context.Context, replayer *kafka.Replayer, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	partitions := flags.String("partitions", "", "comma-separated partitions, all if empty")
+	fromOffset := flags.Int64("from-offset", -1, "first offset to replay")
+	fromTime := flags.String("from-time", "", "replay messages not older than this RFC 3339 time")
+	toOffset := flags.Int64("to-offset", -1, "last offset to replay, inclusive")
+	toTime := flags.String("to-time", "", "replay messages not newer than this RFC 3339 time")
+	dryRun := flags.Bool("dry-run", false, "only parse and validate messages")
+	overwrite := flags.Bool("overwrite", false, "also apply messages already stored in order revisions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := kafka.ReplayRequest{DryRun: *dryRun, Overwrite: *overwrite}
+	if *partitions != "" {
+		for _, p := range strings.Split(*partitions, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return fmt.Errorf("invalid partition %q", p)
+			}
+			req.Partitions = append(req.Partitions, n)
+		}
+	}
+	if *fromOffset >= 0 {
+		req.FromOffset = fromOffset
+	}
+	if *toOffset >= 0 {
+		req.ToOffset = toOffset
+	}
+	for _, t := range []struct {
+		value string
+		dst   **time.Time
+	}{{*fromTime, &req.FromTime}, {*toTime, &req.ToTime}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return fmt.Errorf("invalid time %q: %w", t.value, err)
+		}
+		*t.dst = &parsed
+	}
+
+	result, err := replayer.Replay(ctx, req)
+	if result != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(result)
 	}
-	return defaultValue
+	return err
 }
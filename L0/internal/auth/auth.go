@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"order-service/internal/metrics"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HeaderAPIKey — заголовок со статическим API ключом. Ключ также принимается как Bearer токен.
+const HeaderAPIKey = "X-API-Key"
+
+// minAPIKeyLength — минимальная длина API ключа
+const minAPIKeyLength = 16
+
+// APIKey — статический ключ доступа
+type APIKey struct {
+	Name string // Имя для логов; ключ в логи не попадает
+	Role Role
+	Key  string
+}
+
+// ParseAPIKeys разбирает список ключей через запятую в формате name:role:key
+func ParseAPIKeys(list string) ([]APIKey, error) {
+	var keys []APIKey
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, errors.New("api key must be in the form name:role:key")
+		}
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("api key %s: %w", parts[0], err)
+		}
+		if len(parts[2]) < minAPIKeyLength {
+			return nil, fmt.Errorf("api key %s must be at least %d characters", parts[0], minAPIKeyLength)
+		}
+		if seen[parts[2]] {
+			return nil, fmt.Errorf("api key %s duplicates another key", parts[0])
+		}
+		seen[parts[2]] = true
+		keys = append(keys, APIKey{Name: parts[0], Role: role, Key: parts[2]})
+	}
+	return keys, nil
+}
+
+// Config задает аутентификацию HTTP API
+type Config struct {
+	Enabled  bool
+	APIKeys  []APIKey
+	JWKSFile string // Локальный JWKS файл; пустой — JWT не принимаются
+	JWT      JWTConfig
+}
+
+// Validate проверяет корректность конфигурации без чтения JWKS файла
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.APIKeys) == 0 && c.JWKSFile == "" {
+		return errors.New("at least one api key or a jwks file is required when auth is enabled")
+	}
+	if c.JWKSFile != "" && c.JWT.RoleClaim == "" {
+		return errors.New("jwt role claim must not be empty")
+	}
+	if c.JWT.Leeway < 0 {
+		return fmt.Errorf("jwt leeway must be >= 0, got %s", c.JWT.Leeway)
+	}
+	return nil
+}
+
+// Authenticator проверяет учетные данные запроса и роль, требуемую маршрутом
+type Authenticator struct {
+	enabled bool
+	apiKeys map[[sha256.Size]byte]APIKey // Ключи хранятся по хешу, чтобы поиск не зависел от совпавшего префикса
+	jwks    *KeyStore
+	jwt     JWTConfig
+	now     func() time.Time
+}
+
+// New создает Authenticator и загружает JWKS файл, если он задан
+func New(cfg Config) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{
+		enabled: cfg.Enabled,
+		apiKeys: make(map[[sha256.Size]byte]APIKey, len(cfg.APIKeys)),
+		jwt:     cfg.JWT,
+		now:     time.Now,
+	}
+	for _, k := range cfg.APIKeys {
+		a.apiKeys[sha256.Sum256([]byte(k.Key))] = k
+	}
+	if cfg.Enabled && cfg.JWKSFile != "" {
+		jwks, err := NewKeyStore(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwks = jwks
+	}
+	return a, nil
+}
+
+// Watch перечитывает JWKS файл при изменении до отмены контекста; без JWKS ничего не делает
+func (a *Authenticator) Watch(ctx context.Context, interval time.Duration) {
+	if a.jwks != nil {
+		a.jwks.Watch(ctx, interval)
+	}
+}
+
+// Require возвращает middleware, которое пропускает только запросы с ролью не ниже role.
+// Без учетных данных или с неверными отвечает 401, с недостаточной ролью — 403.
+// Если аутентификация выключена, запрос выполняется от имени анонимного читателя (Anonymous):
+// маршруты, которым нужна роль выше reader, отвечают 403.
+func (a *Authenticator) Require(role Role) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := Anonymous()
+			if a.enabled {
+				var reason string
+				var err error
+				if p, reason, err = a.authenticate(r); err != nil {
+					metrics.HTTPAuthFailures.WithLabelValues(reason).Inc()
+					log.Printf("level=warn component=auth event=unauthorized path=%q reason=%s err=%q", r.URL.Path, reason, err)
+					writeUnauthorized(w, reason, err)
+					return
+				}
+			}
+			if !p.Role.Allows(role) {
+				metrics.HTTPAuthFailures.WithLabelValues("forbidden").Inc()
+				log.Printf("level=warn component=auth event=forbidden path=%q subject=%q method=%s role=%s required=%s", r.URL.Path, p.Subject, p.Method, p.Role, role)
+				writeError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("role %s is not allowed, %s required", p.Role, role))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// authenticate проверяет учетные данные: X-API-Key или Authorization: Bearer с JWT или API ключом.
+// При ошибке возвращает причину для метрик.
+func (a *Authenticator) authenticate(r *http.Request) (*Principal, string, error) {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return a.apiKey(key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, "missing_credentials", errors.New("credentials are required")
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, "invalid_header", errors.New("authorization header must be Bearer <token>")
+	}
+	token = strings.TrimSpace(token)
+
+	// JWT состоит из трех частей через точку; остальное считается API ключом
+	if strings.Count(token, ".") != 2 {
+		return a.apiKey(token)
+	}
+	if a.jwks == nil {
+		return nil, "invalid_token", errors.New("jwt authentication is not configured")
+	}
+	c, err := verifyJWT(token, a.jwks, a.jwt, a.now())
+	if err != nil {
+		return nil, "invalid_token", err
+	}
+	role, err := c.role(a.jwt.RoleClaim)
+	if err != nil {
+		return nil, "invalid_token", err
+	}
+	return &Principal{Subject: c.Subject, Role: role, Method: MethodJWT}, "", nil
+}
+
+// apiKey ищет статический ключ
+func (a *Authenticator) apiKey(key string) (*Principal, string, error) {
+	k, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, "invalid_api_key", errors.New("unknown api key")
+	}
+	return &Principal{Subject: k.Name, Role: k.Role, Method: MethodAPIKey}, "", nil
+}
+
+// errorResponse — тело ответов 401 и 403
+type errorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// writeUnauthorized отвечает 401 с WWW-Authenticate. Подробности ошибки токена остаются в логе.
+func writeUnauthorized(w http.ResponseWriter, reason string, err error) {
+	challenge := `Bearer realm="order-service"`
+	message := err.Error()
+	if reason == "invalid_token" {
+		challenge += `, error="invalid_token"`
+		message = "invalid or expired token"
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeError(w, http.StatusUnauthorized, "unauthorized", message)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(errorResponse{Error: code, Message: message}); err != nil {
+		log.Printf("level=error component=auth event=json_encode_error err=%v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	keys := []APIKey{
+		{Name: "web", Role: RoleReader, Key: "reader-key-0123456789"},
+		{Name: "ops", Role: RoleAdmin, Key: "admin-key-0123456789"},
+	}
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		required    Role
+		header      string
+		value       string
+		wantStatus  int
+		wantSubject string
+		wantRole    Role
+		wantMethod  string
+	}{
+		{
+			name:        "disabled: anonymous reader",
+			required:    RoleReader,
+			wantStatus:  http.StatusOK,
+			wantSubject: "anonymous",
+			wantRole:    RoleReader,
+			wantMethod:  MethodNone,
+		},
+		{
+			name:       "disabled: support route is forbidden",
+			required:   RoleSupport,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "disabled: admin route is forbidden",
+			required:   RoleAdmin,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "disabled: credentials do not raise the role",
+			required:   RoleAdmin,
+			header:     HeaderAPIKey,
+			value:      "admin-key-0123456789",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "enabled: missing credentials",
+			cfg:        Config{Enabled: true, APIKeys: keys},
+			required:   RoleReader,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "enabled: unknown key",
+			cfg:        Config{Enabled: true, APIKeys: keys},
+			required:   RoleReader,
+			header:     HeaderAPIKey,
+			value:      "unknown-key-0123456789",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "enabled: insufficient role",
+			cfg:        Config{Enabled: true, APIKeys: keys},
+			required:   RoleAdmin,
+			header:     HeaderAPIKey,
+			value:      "reader-key-0123456789",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:        "enabled: bearer api key",
+			cfg:         Config{Enabled: true, APIKeys: keys},
+			required:    RoleAdmin,
+			header:      "Authorization",
+			value:       "Bearer admin-key-0123456789",
+			wantStatus:  http.StatusOK,
+			wantSubject: "ops",
+			wantRole:    RoleAdmin,
+			wantMethod:  MethodAPIKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			var got *Principal
+			h := a.Require(tt.required)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = FromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if got != nil {
+					t.Error("handler was called for a rejected request")
+				}
+				return
+			}
+			if got == nil || got.Subject != tt.wantSubject || got.Role != tt.wantRole || got.Method != tt.wantMethod {
+				t.Errorf("principal = %+v, want %s/%s/%s", got, tt.wantSubject, tt.wantRole, tt.wantMethod)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"order-service/internal/filewatch"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Алгоритмы подписи JWT
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// Ошибки проверки токена; в ответ клиенту передается только факт отказа
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("no matching key in jwks")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrInvalidClaims    = errors.New("invalid claims")
+)
+
+// jwk — ключ из JWKS (RFC 7517): RSA для RS256 или симметричный (oct) для HS256
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// verificationKey — разобранный ключ проверки подписи
+type verificationKey struct {
+	kid    string
+	alg    string
+	rsa    *rsa.PublicKey
+	secret []byte
+}
+
+// parseJWKS разбирает набор ключей. Ключи с use, отличным от sig, пропускаются.
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	var keys []verificationKey
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key := verificationKey{kid: k.Kid}
+		switch k.Kty {
+		case "RSA":
+			if k.Alg != "" && k.Alg != AlgRS256 {
+				return nil, fmt.Errorf("jwks key %d: unsupported alg %q for RSA key", i, k.Alg)
+			}
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil || len(n) == 0 {
+				return nil, fmt.Errorf("jwks key %d: invalid modulus", i)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("jwks key %d: invalid exponent", i)
+			}
+			key.alg = AlgRS256
+			key.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if key.rsa.N.BitLen() < 2048 {
+				return nil, fmt.Errorf("jwks key %d: RSA key must be at least 2048 bits", i)
+			}
+		case "oct":
+			if k.Alg != "" && k.Alg != AlgHS256 {
+				return nil, fmt.Errorf("jwks key %d: unsupported alg %q for oct key", i, k.Alg)
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) < 32 {
+				return nil, fmt.Errorf("jwks key %d: HS256 secret must be at least 32 bytes", i)
+			}
+			key.alg = AlgHS256
+			key.secret = secret
+		default:
+			return nil, fmt.Errorf("jwks key %d: unsupported key type %q", i, k.Kty)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no signing keys")
+	}
+	return keys, nil
+}
+
+// KeyStore хранит ключи из локального JWKS файла и перечитывает его при изменении
+type KeyStore struct {
+	path  string
+	watch *filewatch.Watcher
+
+	mu   sync.RWMutex
+	keys []verificationKey
+}
+
+// NewKeyStore загружает JWKS файл. Ошибка загрузки при старте фатальна.
+func NewKeyStore(path string) (*KeyStore, error) {
+	s := &KeyStore{path: path}
+	s.watch = filewatch.New(s.load, path)
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload перечитывает JWKS, если файл изменился. Возвращает true, если ключи обновлены;
+// при ошибке токены продолжают проверяться прежними ключами.
+func (s *KeyStore) Reload() (bool, error) {
+	return s.watch.Reload()
+}
+
+// load разбирает JWKS файл и заменяет набор ключей
+func (s *KeyStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks %s: %w", s.path, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	log.Printf("level=info component=auth event=jwks_loaded path=%q keys=%d", s.path, len(keys))
+	return nil
+}
+
+// Watch проверяет JWKS файл с интервалом interval до отмены контекста
+func (s *KeyStore) Watch(ctx context.Context, interval time.Duration) {
+	s.watch.Watch(ctx, interval, func(err error) {
+		log.Printf("level=error component=auth event=jwks_reload_failed path=%q err=%v", s.path, err)
+	})
+}
+
+// candidates возвращает ключи для алгоритма и kid токена; без kid подходят все ключи алгоритма
+func (s *KeyStore) candidates(alg, kid string) []verificationKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []verificationKey
+	for _, k := range s.keys {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// claims — проверяемые поля JWT
+type claims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  audience        `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Raw       json.RawMessage `json:"-"`
+}
+
+// audience принимает aud строкой или массивом строк
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// JWTConfig задает проверку JWT. Пустые Issuer и Audience не проверяются.
+type JWTConfig struct {
+	Issuer    string
+	Audience  string
+	RoleClaim string        // Claim с ролью: строка или массив строк, берется старшая известная роль
+	Leeway    time.Duration // Допуск расхождения часов для exp и nbf
+}
+
+// verifyJWT проверяет подпись и срок действия токена и возвращает его claims
+func verifyJWT(token string, keys *KeyStore, cfg JWTConfig, now time.Time) (*claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+	if header.Alg != AlgHS256 && header.Alg != AlgRS256 {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	candidates := keys.candidates(header.Alg, header.Kid)
+	if len(candidates) == 0 {
+		return nil, ErrUnknownKey
+	}
+	verified := false
+	for _, k := range candidates {
+		if verifySignature(k, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClaims, err)
+	}
+	c.Raw = payload
+
+	if c.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: exp is required", ErrInvalidClaims)
+	}
+	if now.After(time.Unix(*c.ExpiresAt, 0).Add(cfg.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if c.NotBefore != nil && now.Add(cfg.Leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if cfg.Issuer != "" && c.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, c.Issuer)
+	}
+	if cfg.Audience != "" && !contains(c.Audience, cfg.Audience) {
+		return nil, fmt.Errorf("%w: audience %q not accepted", ErrInvalidClaims, cfg.Audience)
+	}
+
+	return &c, nil
+}
+
+// verifySignature проверяет подпись ключом k
+func verifySignature(k verificationKey, signed, signature []byte) bool {
+	switch k.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case AlgRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+// role возвращает старшую известную роль из claim'а с именем claim
+func (c *claims) role(claim string) (Role, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(c.Raw, &all); err != nil {
+		return RoleNone, fmt.Errorf("%w: %v", ErrInvalidClaims, err)
+	}
+	raw, ok := all[claim]
+	if !ok {
+		return RoleNone, fmt.Errorf("%w: claim %q is missing", ErrInvalidClaims, claim)
+	}
+
+	var names []string
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		names = []string{one}
+	} else if err := json.Unmarshal(raw, &names); err != nil {
+		return RoleNone, fmt.Errorf("%w: claim %q must be a string or an array of strings", ErrInvalidClaims, claim)
+	}
+
+	best := RoleNone
+	for _, name := range names {
+		if r, err := ParseRole(name); err == nil && r > best {
+			best = r
+		}
+	}
+	if best == RoleNone {
+		return RoleNone, fmt.Errorf("%w: claim %q has no known role", ErrInvalidClaims, claim)
+	}
+	return best, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
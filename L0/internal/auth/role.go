@@ -0,0 +1,80 @@
+// Package auth проверяет API ключи и JWT и ограничивает доступ к маршрутам по ролям.
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// Role — роль вызывающей стороны. Роли упорядочены: каждая следующая включает права предыдущей.
+type Role int
+
+// Роли
+const (
+	RoleNone    Role = iota // Роль не назначена; не разрешает ни один маршрут
+	RoleReader              // Чтение заказов
+	RoleSupport             // Служба поддержки: история ревизий, статистика кеша
+	RoleAdmin               // Администрирование: повторное чтение топика
+)
+
+var roleNames = map[Role]string{
+	RoleNone:    "none",
+	RoleReader:  "reader",
+	RoleSupport: "support",
+	RoleAdmin:   "admin",
+}
+
+// String возвращает название роли
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// Allows сообщает, достаточно ли роли r для маршрута, требующего required
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// ParseRole возвращает роль по названию; RoleNone не назначается учетным данным
+func ParseRole(name string) (Role, error) {
+	for r, n := range roleNames {
+		if n == name && r != RoleNone {
+			return r, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q (expected reader, support or admin)", name)
+}
+
+// Способы аутентификации
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodNone   = "none" // Аутентификация выключена, запрос анонимный
+)
+
+// Principal — аутентифицированная вызывающая сторона
+type Principal struct {
+	Subject string // Имя API ключа или sub из JWT
+	Role    Role
+	Method  string
+}
+
+// Anonymous возвращает вызывающую сторону запроса при выключенной аутентификации
+func Anonymous() *Principal {
+	return &Principal{Subject: "anonymous", Role: RoleReader, Method: MethodNone}
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст с вызывающей стороной
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает вызывающую сторону запроса или nil, если запрос не проходил через middleware
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
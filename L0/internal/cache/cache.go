@@ -1,69 +1,253 @@
 package cache
 
 import (
+	"container/list"
+	"encoding/json"
+	"fmt"
 	"log"
 	"order-service/internal/models"
 	"sync"
+	"time"
 )
 
-// Cache представляет in-memory кеш для заказов
+// Config задает ограничения кеша. Нулевые значения означают отсутствие ограничения.
+type Config struct {
+	MaxEntries int           // Максимальное число заказов
+	MaxBytes   int64         // Максимальный суммарный размер заказов (по размеру JSON)
+	TTL        time.Duration // Время жизни записи
+}
+
+// DefaultConfig возвращает ограничения кеша по умолчанию: только по числу заказов
+func DefaultConfig() Config {
+	return Config{MaxEntries: 100000}
+}
+
+// Validate проверяет корректность конфигурации
+func (c Config) Validate() error {
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("cache max entries must be >= 0, got %d", c.MaxEntries)
+	}
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("cache max bytes must be >= 0, got %d", c.MaxBytes)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("cache ttl must be >= 0, got %s", c.TTL)
+	}
+	return nil
+}
+
+// Stats содержит счетчики кеша
+type Stats struct {
+	Size        int    `json:"size"`
+	Bytes       int64  `json:"bytes"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+// entry — элемент LRU списка
+type entry struct {
+	orderUID  string
+	order     *models.Order
+	size      int64
+	expiresAt time.Time
+}
+
+// Cache представляет in-memory LRU кеш для заказов с опциональным TTL
 type Cache struct {
-	mu     sync.RWMutex
-	orders map[string]*models.Order
+	mu      sync.Mutex
+	cfg     Config
+	orders  map[string]*list.Element
+	lru     *list.List // Начало списка — недавно использованные заказы
+	bytes   int64
+	stats   Stats
+	warmup  string
+	written map[string]struct{} // Заказы, записанные или удаленные во время прогрева; nil вне прогрева
+	now     func() time.Time
 }
 
 // New создает новый экземпляр кеша
-func New() *Cache {
+func New(cfg Config) *Cache {
 	return &Cache{
-		orders: make(map[string]*models.Order),
+		cfg:    cfg,
+		orders: make(map[string]*list.Element),
+		lru:    list.New(),
+		warmup: WarmupPending,
+		now:    time.Now,
 	}
 }
 
-// Set сохраняет заказ в кеше
+// Set сохраняет заказ в кеше, вытесняя давно не использованные заказы при превышении лимитов
 func (c *Cache) Set(orderUID string, order *models.Order) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.orders[orderUID] = order
+	c.touch(orderUID)
+	c.set(orderUID, order)
+}
+
+// Delete удаляет заказ из кеша. Возвращает false, если заказа в кеше не было.
+func (c *Cache) Delete(orderUID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Удаление запоминается, даже если заказа в кеше нет: прогрев мог прочитать его раньше
+	c.touch(orderUID)
+	elem, ok := c.orders[orderUID]
+	if !ok {
+		return false
+	}
+	c.remove(elem)
+	return true
 }
 
 // Get получает заказ из кеша
 func (c *Cache) Get(orderUID string) (*models.Order, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	order, exists := c.orders[orderUID]
-	return order, exists
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.orders[orderUID]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if c.expired(e) {
+		c.remove(elem)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	return e.order, true
 }
 
-// LoadFromDB восстанавливает кеш из базы данных
+// LoadFromDB восстанавливает кеш из базы данных.
+// Заказы ожидаются в порядке от новых к старым: при заполнении лимита остаются самые новые.
 func (c *Cache) LoadFromDB(orders []*models.Order) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.orders = make(map[string]*models.Order, len(orders))
+	c.orders = make(map[string]*list.Element, len(orders))
+	c.lru.Init()
+	c.bytes = 0
 
-	for _, order := range orders {
-		c.orders[order.OrderUID] = order
+	for i := len(orders) - 1; i >= 0; i-- {
+		c.set(orders[i].OrderUID, orders[i])
 	}
 
-	log.Printf("Cache loaded with %d orders", len(orders))
+	log.Printf("Cache loaded with %d orders", len(c.orders))
 }
 
 // Size возвращает количество заказов в кеше
 func (c *Cache) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return len(c.orders)
 }
 
+// Stats возвращает снимок счетчиков кеша
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = len(c.orders)
+	stats.Bytes = c.bytes
+	return stats
+}
+
 // GetAll возвращает все заказы из кеша (для отладки)
 func (c *Cache) GetAll() map[string]*models.Order {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	result := make(map[string]*models.Order, len(c.orders))
-	for k, v := range c.orders {
-		result[k] = v
+	for k, elem := range c.orders {
+		e := elem.Value.(*entry)
+		if !c.expired(e) {
+			result[k] = e.order
+		}
 	}
 
 	return result
 }
+
+// set добавляет или обновляет запись; вызывается под блокировкой
+func (c *Cache) set(orderUID string, order *models.Order) {
+	size := orderSize(order)
+	if c.cfg.MaxBytes > 0 && size > c.cfg.MaxBytes {
+		// Заказ больше всего кеша: не кешируем, но убираем устаревшую версию
+		if elem, exists := c.orders[orderUID]; exists {
+			c.remove(elem)
+		}
+		return
+	}
+
+	var expiresAt time.Time
+	if c.cfg.TTL > 0 {
+		expiresAt = c.now().Add(c.cfg.TTL)
+	}
+
+	if elem, exists := c.orders[orderUID]; exists {
+		e := elem.Value.(*entry)
+		c.bytes += size - e.size
+		e.order, e.size, e.expiresAt = order, size, expiresAt
+		c.lru.MoveToFront(elem)
+	} else {
+		c.orders[orderUID] = c.lru.PushFront(&entry{
+			orderUID:  orderUID,
+			order:     order,
+			size:      size,
+			expiresAt: expiresAt,
+		})
+		c.bytes += size
+	}
+
+	c.evict()
+}
+
+// evict вытесняет записи с конца LRU списка, пока кеш превышает лимиты
+func (c *Cache) evict() {
+	for c.overLimit() {
+		back := c.lru.Back()
+		if back == nil {
+			return
+		}
+		if c.expired(back.Value.(*entry)) {
+			c.stats.Expirations++
+		} else {
+			c.stats.Evictions++
+		}
+		c.remove(back)
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	if c.cfg.MaxEntries > 0 && len(c.orders) > c.cfg.MaxEntries {
+		return true
+	}
+	return c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.orders, e.orderUID)
+	c.bytes -= e.size
+}
+
+func (c *Cache) expired(e *entry) bool {
+	return !e.expiresAt.IsZero() && c.now().After(e.expiresAt)
+}
+
+// orderSize оценивает размер заказа в памяти по размеру его JSON
+func orderSize(order *models.Order) int64 {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
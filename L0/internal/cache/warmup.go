@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"order-service/internal/models"
+	"time"
+)
+
+// ErrCacheFull прерывает чтение из хранилища, когда кеш заполнен и дальнейший прогрев бесполезен
+var ErrCacheFull = errors.New("cache is full")
+
+// Состояния прогрева кеша
+const (
+	WarmupPending    = "pending"
+	WarmupInProgress = "in_progress"
+	WarmupDone       = "done"
+	WarmupFailed     = "failed"
+)
+
+// OrderStreamer отдает заказы из хранилища порциями от новых к старым
+type OrderStreamer interface {
+	CountOrders(ctx context.Context) (int, error)
+	StreamOrders(ctx context.Context, chunkSize int, fn func([]*models.Order) error) error
+}
+
+// WarmUp заполняет кеш из хранилища порциями, логируя прогресс.
+// Кеш доступен для чтения и записи во время прогрева: промахи обслуживает база данных,
+// а заказы, записанные или удаленные consumer'ом после старта прогрева, не перезаписываются
+// версиями, прочитанными из хранилища раньше.
+// Прогрев прекращается досрочно, когда кеш заполнен до лимита.
+func (c *Cache) WarmUp(ctx context.Context, source OrderStreamer, chunkSize int) error {
+	c.setWarmup(WarmupInProgress)
+	start := time.Now()
+
+	total, err := source.CountOrders(ctx)
+	if err != nil {
+		log.Printf("level=warn component=cache event=warmup_count_failed err=%v", err)
+	}
+
+	loaded := 0
+	err = source.StreamOrders(ctx, chunkSize, func(orders []*models.Order) error {
+		added, full := c.warm(orders)
+		loaded += added
+		log.Printf("level=info component=cache event=warmup_progress loaded=%d total=%d elapsed=%s", loaded, total, time.Since(start).Round(time.Millisecond))
+		if full {
+			log.Printf("level=info component=cache event=warmup_cache_full loaded=%d", loaded)
+			return ErrCacheFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCacheFull) {
+		c.setWarmup(WarmupFailed)
+		return err
+	}
+
+	c.setWarmup(WarmupDone)
+	log.Printf("level=info component=cache event=warmup_done loaded=%d elapsed=%s", loaded, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// WarmupState возвращает текущее состояние прогрева
+func (c *Cache) WarmupState() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.warmup
+}
+
+func (c *Cache) setWarmup(state string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warmup = state
+	if state == WarmupInProgress {
+		c.written = make(map[string]struct{})
+	} else {
+		c.written = nil
+	}
+}
+
+// touch отмечает заказ, записанный или удаленный во время прогрева; вызывается под блокировкой
+func (c *Cache) touch(orderUID string) {
+	if c.written != nil {
+		c.written[orderUID] = struct{}{}
+	}
+}
+
+// warm добавляет порцию заказов в конец LRU списка, не вытесняя уже закешированные.
+// Возвращает число добавленных заказов и признак заполнения кеша.
+func (c *Cache) warm(orders []*models.Order) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if c.cfg.TTL > 0 {
+		expiresAt = c.now().Add(c.cfg.TTL)
+	}
+
+	added := 0
+	for _, order := range orders {
+		if _, exists := c.orders[order.OrderUID]; exists {
+			continue // Более свежая версия уже пришла из Kafka или по запросу
+		}
+		if _, written := c.written[order.OrderUID]; written {
+			continue // Заказ изменен или удален после того, как порция была прочитана
+		}
+
+		size := orderSize(order)
+		if c.cfg.MaxEntries > 0 && len(c.orders) >= c.cfg.MaxEntries {
+			return added, true
+		}
+		if c.cfg.MaxBytes > 0 && c.bytes+size > c.cfg.MaxBytes {
+			return added, true
+		}
+
+		c.orders[order.OrderUID] = c.lru.PushBack(&entry{
+			orderUID:  order.OrderUID,
+			order:     order,
+			size:      size,
+			expiresAt: expiresAt,
+		})
+		c.bytes += size
+		added++
+	}
+
+	return added, false
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"order-service/internal/models"
+	"testing"
+)
+
+func order(uid string) *models.Order {
+	return &models.Order{OrderUID: uid, TrackNumber: "TRACK-" + uid}
+}
+
+// chunkStreamer отдает заранее заданные порции и перед каждой вызывает before —
+// так тест изменяет кеш между чтением порции из хранилища и ее загрузкой
+type chunkStreamer struct {
+	chunks [][]*models.Order
+	before func(chunk int)
+}
+
+func (s *chunkStreamer) CountOrders(context.Context) (int, error) {
+	n := 0
+	for _, chunk := range s.chunks {
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+func (s *chunkStreamer) StreamOrders(_ context.Context, _ int, fn func([]*models.Order) error) error {
+	for i, chunk := range s.chunks {
+		if s.before != nil {
+			s.before(i)
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWarmUpSkipsOrdersChangedDuringWarmup(t *testing.T) {
+	stale := func(uid string) *models.Order {
+		o := order(uid)
+		o.Entry = "stale"
+		return o
+	}
+
+	tests := []struct {
+		name      string
+		change    func(c *Cache)
+		wantFound bool
+		wantEntry string
+	}{
+		{
+			name:      "untouched order is loaded",
+			change:    func(c *Cache) {},
+			wantFound: true,
+			wantEntry: "stale",
+		},
+		{
+			name:   "order deleted before its chunk is not resurrected",
+			change: func(c *Cache) { c.Delete("b") },
+		},
+		{
+			name: "order deleted after being cached by the consumer stays deleted",
+			change: func(c *Cache) {
+				c.Set("b", order("b"))
+				c.Delete("b")
+			},
+		},
+		{
+			name: "newer version written by the consumer is kept",
+			change: func(c *Cache) {
+				o := order("b")
+				o.Entry = "fresh"
+				c.Set("b", o)
+			},
+			wantFound: true,
+			wantEntry: "fresh",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(DefaultConfig())
+			source := &chunkStreamer{
+				chunks: [][]*models.Order{{stale("a")}, {stale("b")}},
+				before: func(chunk int) {
+					if chunk == 1 {
+						tt.change(c)
+					}
+				},
+			}
+			if err := c.WarmUp(context.Background(), source, 1); err != nil {
+				t.Fatalf("WarmUp: %v", err)
+			}
+
+			got, found := c.Get("b")
+			if found != tt.wantFound {
+				t.Fatalf("Get(b) found = %v, want %v", found, tt.wantFound)
+			}
+			if found && got.Entry != tt.wantEntry {
+				t.Errorf("entry = %q, want %q", got.Entry, tt.wantEntry)
+			}
+			if _, found := c.Get("a"); !found {
+				t.Error("order from the first chunk was not loaded")
+			}
+			if c.WarmupState() != WarmupDone {
+				t.Errorf("warmup state = %s, want %s", c.WarmupState(), WarmupDone)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package certs загружает сертификат HTTPS сервера и CA для проверки клиентских сертификатов
+// и перечитывает их при ротации без перезапуска сервиса.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"order-service/internal/filewatch"
+	"order-service/internal/metrics"
+	"os"
+	"sync"
+	"time"
+)
+
+// Режимы проверки клиентских сертификатов
+const (
+	ClientAuthNone     = "none"     // Клиентский сертификат не запрашивается
+	ClientAuthOptional = "optional" // Проверяется, если клиент его предъявил
+	ClientAuthRequire  = "require"  // Обязателен и проверяется (mTLS)
+)
+
+// ParseClientAuth возвращает режим проверки клиентских сертификатов по названию
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q (expected %s, %s or %s)", mode, ClientAuthNone, ClientAuthOptional, ClientAuthRequire)
+	}
+}
+
+// Store хранит актуальную конфигурацию TLS и перечитывает файлы при изменении
+type Store struct {
+	certFile   string
+	keyFile    string
+	caFile     string // Пустой, если клиентские сертификаты не проверяются
+	clientAuth tls.ClientAuthType
+	watch      *filewatch.Watcher
+
+	mu     sync.RWMutex
+	config *tls.Config
+}
+
+// NewStore загружает сертификат, ключ и, если caFile задан, CA клиентских сертификатов.
+// Ошибка загрузки при старте фатальна.
+func NewStore(certFile, keyFile, caFile string, clientAuth tls.ClientAuthType) (*Store, error) {
+	s := &Store{certFile: certFile, keyFile: keyFile, caFile: caFile, clientAuth: clientAuth}
+	files := []string{certFile, keyFile}
+	if caFile != "" {
+		files = append(files, caFile)
+	}
+	s.watch = filewatch.New(s.load, files...)
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// TLSConfig возвращает конфигурацию для http.Server: каждое новое соединение
+// получает сертификат и CA, загруженные последними
+func (s *Store) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			return s.config, nil
+		},
+	}
+}
+
+// Reload перечитывает файлы, если хотя бы один изменился. Возвращает true, если конфигурация обновлена.
+// Если сертификат уже заменен, а ключ еще нет, остается прежняя конфигурация,
+// и пара загружается при следующей проверке.
+func (s *Store) Reload() (bool, error) {
+	return s.watch.Reload()
+}
+
+// load загружает сертификат, ключ и CA и заменяет ими конфигурацию новых соединений
+func (s *Store) load() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", s.certFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate %s: %w", s.certFile, err)
+	}
+
+	// GetConfigForClient заменяет конфигурацию http.Server целиком, поэтому протоколы ALPN,
+	// которые сервер добавляет сам, нужно перечислить здесь: иначе HTTP/2 не согласуется
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   s.clientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if s.caFile != "" {
+		pem, err := os.ReadFile(s.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client ca file %s: %w", s.caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client ca file %s", s.caFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	s.mu.Lock()
+	s.config = config
+	s.mu.Unlock()
+
+	metrics.HTTPCertExpiry.Set(float64(leaf.NotAfter.Unix()))
+	log.Printf("level=info component=http event=certificate_loaded path=%q subject=%q not_after=%s client_ca=%t",
+		s.certFile, leaf.Subject.CommonName, leaf.NotAfter.UTC().Format(time.RFC3339), s.caFile != "")
+	return nil
+}
+
+// Watch проверяет файлы сертификата с интервалом interval до отмены контекста
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	s.watch.Watch(ctx, interval, func(err error) {
+		log.Printf("level=error component=http event=certificate_reload_failed path=%q err=%v", s.certFile, err)
+	})
+}
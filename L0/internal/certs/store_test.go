@@ -0,0 +1,147 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA — удостоверяющий центр для сертификатов сервера
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ca key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create ca certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse ca certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// writeServerCert выпускает сертификат сервера для 127.0.0.1, записывает его и ключ в certFile
+// и keyFile и сдвигает время изменения, чтобы Reload заметил запись при грубом разрешении mtime
+func (ca *testCA) writeServerCert(t *testing.T, name, certFile, keyFile string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("failed to set mtime: %v", err)
+		}
+	}
+}
+
+// handshake выполняет запрос новым соединением и возвращает протокол и имя сертификата сервера
+func handshake(t *testing.T, ca *testCA, addr string) (proto, commonName string) {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get("https://" + addr)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.Proto, resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestStoreServesRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	start := time.Now().Add(-time.Hour)
+	ca := newTestCA(t)
+	ca.writeServerCert(t, "server-1", certFile, keyFile, start)
+
+	s, err := NewStore(certFile, keyFile, "", tls.NoClientCert)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: s.TLSConfig(),
+	}
+	go server.ServeTLS(ln, "", "")
+	defer server.Close()
+
+	// Сервер согласует HTTP/2, хотя конфигурацию соединения подставляет GetConfigForClient
+	if proto, name := handshake(t, ca, ln.Addr().String()); proto != "HTTP/2.0" || name != "server-1" {
+		t.Fatalf("handshake = %s, %s; want HTTP/2.0, server-1", proto, name)
+	}
+
+	ca.writeServerCert(t, "server-2", certFile, keyFile, start.Add(time.Minute))
+	if changed, err := s.Reload(); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v; want true, nil", changed, err)
+	}
+	if _, name := handshake(t, ca, ln.Addr().String()); name != "server-2" {
+		t.Errorf("certificate after rotation = %s, want server-2", name)
+	}
+
+	// Без изменений файлов конфигурация не перечитывается
+	if changed, err := s.Reload(); err != nil || changed {
+		t.Errorf("Reload() without changes = %v, %v; want false, nil", changed, err)
+	}
+}
@@ -0,0 +1,474 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"order-service/internal/auth"
+	"order-service/internal/cache"
+	"order-service/internal/certs"
+	"order-service/internal/database"
+	"order-service/internal/kafka"
+	"order-service/internal/redact"
+	"strings"
+	"time"
+)
+
+// Хранилища смещений Kafka
+const (
+	OffsetStorageKafka    = "kafka"    // Коммиты группы в Kafka
+	OffsetStoragePostgres = "postgres" // В одной транзакции с заказом
+)
+
+// Config — конфигурация сервиса. Теги полей задают ключ в файле конфигурации (yaml),
+// переменную окружения (env), из которой также выводится имя флага командной строки,
+// прежнее имя переменной, которое еще читается (alias), описание для справки (usage)
+// и признак секрета, который не выводится в лог (secret).
+type Config struct {
+	DB         DBConfig         `yaml:"db"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Redact     RedactConfig     `yaml:"redact"`
+	Cache      CacheConfig      `yaml:"cache"`
+	Validation ValidationConfig `yaml:"validation"`
+
+	sources map[string]string // Ключ -> источник итогового значения
+}
+
+// DBConfig — подключение к PostgreSQL
+type DBConfig struct {
+	Host            string        `yaml:"host" env:"DB_HOST" usage:"PostgreSQL host"`
+	Port            int           `yaml:"port" env:"DB_PORT" usage:"PostgreSQL port"`
+	User            string        `yaml:"user" env:"DB_USER" usage:"PostgreSQL user"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" usage:"PostgreSQL password" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME" usage:"database name"`
+	SSLMode         string        `yaml:"sslmode" env:"DB_SSLMODE" usage:"sslmode: disable, allow, prefer, require, verify-ca or verify-full"`
+	AutoMigrate     bool          `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" usage:"apply migrations on start"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" usage:"maximum number of open connections"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" usage:"maximum number of idle connections"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" usage:"maximum connection lifetime, 0 for no limit"`
+}
+
+// KafkaConfig — чтение топика заказов
+type KafkaConfig struct {
+	Brokers        string        `yaml:"brokers" env:"KAFKA_BROKERS" alias:"KAFKA_BROKER" usage:"comma-separated bootstrap brokers host:port"`
+	DialTimeout    time.Duration `yaml:"dial_timeout" env:"KAFKA_DIAL_TIMEOUT" usage:"broker connection timeout"`
+	Topic          string        `yaml:"topic" env:"KAFKA_TOPIC" usage:"orders topic"`
+	DLQTopic       string        `yaml:"dlq_topic" env:"KAFKA_DLQ_TOPIC" usage:"dead-letter topic, empty to disable"`
+	GroupID        string        `yaml:"group_id" env:"KAFKA_GROUP_ID" usage:"consumer group"`
+	MinBytes       int           `yaml:"min_bytes" env:"KAFKA_MIN_BYTES" usage:"minimum fetch response size"`
+	MaxBytes       int           `yaml:"max_bytes" env:"KAFKA_MAX_BYTES" usage:"maximum fetch response size"`
+	CommitInterval time.Duration `yaml:"commit_interval" env:"KAFKA_COMMIT_INTERVAL" usage:"offset commit interval, 0 for synchronous commits"`
+	OffsetStorage  string        `yaml:"offset_storage" env:"KAFKA_OFFSET_STORAGE" usage:"where offsets are stored: kafka or postgres"`
+
+	SASL    SASLConfig   `yaml:"sasl"`
+	TLS     TLSConfig    `yaml:"tls"`
+	Retry   RetryConfig  `yaml:"retry"`
+	Batch   BatchConfig  `yaml:"batch"`
+	Workers WorkerConfig `yaml:"workers"`
+}
+
+// SASLConfig — аутентификация в Kafka
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism" env:"KAFKA_SASL_MECHANISM" usage:"SASL mechanism: plain, scram-sha-256 or scram-sha-512, empty to disable"`
+	Username  string `yaml:"username" env:"KAFKA_SASL_USERNAME" usage:"SASL username"`
+	Password  string `yaml:"password" env:"KAFKA_SASL_PASSWORD" usage:"SASL password" secret:"true"`
+}
+
+// TLSConfig — шифрование соединений с Kafka
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled" env:"KAFKA_TLS_ENABLED" usage:"connect to brokers over TLS"`
+	CAFile             string `yaml:"ca_file" env:"KAFKA_TLS_CA_FILE" usage:"PEM file with CA certificates, empty for system roots"`
+	CertFile           string `yaml:"cert_file" env:"KAFKA_TLS_CERT_FILE" usage:"PEM file with the client certificate"`
+	KeyFile            string `yaml:"key_file" env:"KAFKA_TLS_KEY_FILE" usage:"PEM file with the client private key"`
+	ServerName         string `yaml:"server_name" env:"KAFKA_TLS_SERVER_NAME" usage:"expected broker certificate name, empty to use the address"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"KAFKA_TLS_INSECURE_SKIP_VERIFY" usage:"do not verify the broker certificate (debugging only)"`
+}
+
+// RetryConfig — повторная обработка сообщения
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts" env:"KAFKA_RETRY_MAX_ATTEMPTS" usage:"maximum processing attempts, 0 for no limit"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"KAFKA_RETRY_INITIAL_BACKOFF" usage:"delay before the second attempt"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"KAFKA_RETRY_MAX_BACKOFF" usage:"maximum delay between attempts"`
+	Multiplier     float64       `yaml:"multiplier" env:"KAFKA_RETRY_MULTIPLIER" usage:"delay multiplier"`
+	Jitter         float64       `yaml:"jitter" env:"KAFKA_RETRY_JITTER" usage:"random delay spread, from 0 to 1"`
+	OnExhausted    string        `yaml:"on_exhausted" env:"KAFKA_RETRY_ON_EXHAUSTED" usage:"action after the last attempt: dead_letter or halt"`
+}
+
+// BatchConfig — пакетный режим consumer
+type BatchConfig struct {
+	Size int           `yaml:"size" env:"KAFKA_BATCH_SIZE" usage:"messages per batch, 1 disables batching"`
+	Wait time.Duration `yaml:"wait" env:"KAFKA_BATCH_WAIT" usage:"maximum time to fill a batch"`
+}
+
+// WorkerConfig — параллельная обработка сообщений
+type WorkerConfig struct {
+	Count     int    `yaml:"count" env:"KAFKA_WORKERS" usage:"number of workers"`
+	Ordering  string `yaml:"ordering" env:"KAFKA_WORKER_ORDERING" usage:"ordering guarantee: partition or key"`
+	QueueSize int    `yaml:"queue_size" env:"KAFKA_WORKER_QUEUE" usage:"queue capacity of each worker"`
+}
+
+// HTTPConfig — HTTP сервер
+type HTTPConfig struct {
+	Port            int           `yaml:"port" env:"HTTP_PORT" usage:"HTTP port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" usage:"request read timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" usage:"response write timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" usage:"keep-alive idle timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" usage:"graceful shutdown timeout"`
+	StaticDir       string        `yaml:"static_dir" env:"HTTP_STATIC_DIR" usage:"directory with the web interface"`
+	RedirectPort    int           `yaml:"redirect_port" env:"HTTP_REDIRECT_PORT" usage:"plaintext port redirecting to HTTPS, 0 to disable"`
+
+	TLS ServerTLSConfig `yaml:"tls"`
+}
+
+// ServerTLSConfig — HTTPS и проверка клиентских сертификатов
+type ServerTLSConfig struct {
+	Enabled        bool          `yaml:"enabled" env:"HTTP_TLS_ENABLED" usage:"serve HTTPS instead of HTTP"`
+	CertFile       string        `yaml:"cert_file" env:"HTTP_TLS_CERT_FILE" usage:"PEM file with the server certificate chain"`
+	KeyFile        string        `yaml:"key_file" env:"HTTP_TLS_KEY_FILE" usage:"PEM file with the server private key"`
+	ClientCAFile   string        `yaml:"client_ca_file" env:"HTTP_TLS_CLIENT_CA_FILE" usage:"PEM bundle of CAs for client certificates"`
+	ClientAuth     string        `yaml:"client_auth" env:"HTTP_TLS_CLIENT_AUTH" usage:"client certificates: none, optional or require"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"HTTP_TLS_RELOAD" usage:"certificate files check interval"`
+}
+
+// AuthConfig — аутентификация HTTP API
+type AuthConfig struct {
+	Enabled      bool          `yaml:"enabled" env:"AUTH_ENABLED" usage:"require credentials on the HTTP API"`
+	APIKeys      string        `yaml:"api_keys" env:"AUTH_API_KEYS" usage:"comma-separated static keys name:role:key" secret:"true"`
+	JWKSFile     string        `yaml:"jwks_file" env:"AUTH_JWKS_FILE" usage:"local JWKS file with HS256 (oct) and RS256 (RSA) keys"`
+	JWKSReload   time.Duration `yaml:"jwks_reload" env:"AUTH_JWKS_RELOAD" usage:"JWKS file check interval"`
+	JWTIssuer    string        `yaml:"jwt_issuer" env:"AUTH_JWT_ISSUER" usage:"required iss claim, empty to skip the check"`
+	JWTAudience  string        `yaml:"jwt_audience" env:"AUTH_JWT_AUDIENCE" usage:"required aud claim, empty to skip the check"`
+	JWTRoleClaim string        `yaml:"jwt_role_claim" env:"AUTH_JWT_ROLE_CLAIM" usage:"claim with the role: reader, support or admin"`
+	JWTLeeway    time.Duration `yaml:"jwt_leeway" env:"AUTH_JWT_LEEWAY" usage:"allowed clock skew for exp and nbf"`
+}
+
+// RedactConfig — маскирование персональных данных в ответах API и в логах
+type RedactConfig struct {
+	Fields  string `yaml:"fields" env:"REDACT_FIELDS" usage:"masked fields: name, phone, zip, city, address, region, email, transaction"`
+	Reader  string `yaml:"reader" env:"REDACT_READER" usage:"masking for the reader role: none, partial or full"`
+	Support string `yaml:"support" env:"REDACT_SUPPORT" usage:"masking for the support role: none, partial or full"`
+	Admin   string `yaml:"admin" env:"REDACT_ADMIN" usage:"masking for the admin role: none, partial or full"`
+	Debug   string `yaml:"log_debug" env:"REDACT_LOG_DEBUG" usage:"masking in debug log records such as message bodies"`
+	Info    string `yaml:"log_info" env:"REDACT_LOG_INFO" usage:"masking in info and higher log records"`
+}
+
+// CacheConfig — ограничения и прогрев кеша
+type CacheConfig struct {
+	MaxEntries  int           `yaml:"max_entries" env:"CACHE_MAX_ENTRIES" usage:"maximum number of cached orders, 0 for no limit"`
+	MaxBytes    int64         `yaml:"max_bytes" env:"CACHE_MAX_BYTES" usage:"maximum total size of cached orders, 0 for no limit"`
+	TTL         time.Duration `yaml:"ttl" env:"CACHE_TTL" usage:"cache entry lifetime, 0 for no limit"`
+	WarmupChunk int           `yaml:"warmup_chunk" env:"CACHE_WARMUP_CHUNK" usage:"orders per warm-up query"`
+}
+
+// ValidationConfig — правила валидации по маркетплейсам
+type ValidationConfig struct {
+	RulesFile   string        `yaml:"rules_file" env:"VALIDATION_RULES_FILE" usage:"validation rules file, empty for built-in checks only"`
+	RulesReload time.Duration `yaml:"rules_reload" env:"VALIDATION_RULES_RELOAD" usage:"rules file check interval"`
+}
+
+// Default возвращает конфигурацию по умолчанию
+func Default() *Config {
+	db := database.DefaultConfig()
+	conn := kafka.DefaultConnConfig()
+	fetch := kafka.DefaultFetchConfig()
+	retry := kafka.DefaultRetryPolicy()
+	batch := kafka.DefaultBatchConfig()
+	workers := kafka.DefaultWorkerConfig()
+	limits := cache.DefaultConfig()
+	policy := redact.DefaultPolicy()
+
+	return &Config{
+		DB: DBConfig{
+			Host:            db.Host,
+			Port:            db.Port,
+			User:            db.User,
+			Password:        db.Password,
+			Name:            db.Name,
+			SSLMode:         db.SSLMode,
+			AutoMigrate:     true,
+			MaxOpenConns:    db.MaxOpenConns,
+			MaxIdleConns:    db.MaxIdleConns,
+			ConnMaxLifetime: db.ConnMaxLifetime,
+		},
+		Kafka: KafkaConfig{
+			Brokers:        strings.Join(conn.Brokers, ","),
+			DialTimeout:    conn.DialTimeout,
+			Topic:          "orders",
+			DLQTopic:       "orders-dlq",
+			GroupID:        fetch.GroupID,
+			MinBytes:       fetch.MinBytes,
+			MaxBytes:       fetch.MaxBytes,
+			CommitInterval: fetch.CommitInterval,
+			OffsetStorage:  OffsetStorageKafka,
+			Retry: RetryConfig{
+				MaxAttempts:    retry.MaxAttempts,
+				InitialBackoff: retry.InitialBackoff,
+				MaxBackoff:     retry.MaxBackoff,
+				Multiplier:     retry.Multiplier,
+				Jitter:         retry.Jitter,
+				OnExhausted:    string(retry.OnExhausted),
+			},
+			Batch: BatchConfig{
+				Size: batch.Size,
+				Wait: batch.Wait,
+			},
+			Workers: WorkerConfig{
+				Count:     workers.Workers,
+				Ordering:  string(workers.Ordering),
+				QueueSize: workers.QueueSize,
+			},
+		},
+		HTTP: HTTPConfig{
+			Port:            8081,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+			StaticDir:       "./web/static/",
+			TLS: ServerTLSConfig{
+				ClientAuth:     certs.ClientAuthNone,
+				ReloadInterval: time.Minute,
+			},
+		},
+		Auth: AuthConfig{
+			JWKSReload:   time.Minute,
+			JWTRoleClaim: "role",
+			JWTLeeway:    30 * time.Second,
+		},
+		Redact: RedactConfig{
+			Fields:  strings.Join(policy.Fields, ","),
+			Reader:  string(policy.Reader),
+			Support: string(policy.Support),
+			Admin:   string(policy.Admin),
+			Debug:   string(policy.Debug),
+			Info:    string(policy.Info),
+		},
+		Cache: CacheConfig{
+			MaxEntries:  limits.MaxEntries,
+			MaxBytes:    limits.MaxBytes,
+			TTL:         limits.TTL,
+			WarmupChunk: 1000,
+		},
+		Validation: ValidationConfig{
+			RulesReload: 10 * time.Second,
+		},
+	}
+}
+
+// Database возвращает параметры подключения к базе данных
+func (c *Config) Database() database.Config {
+	return database.Config{
+		Host:            c.DB.Host,
+		Port:            c.DB.Port,
+		User:            c.DB.User,
+		Password:        c.DB.Password,
+		Name:            c.DB.Name,
+		SSLMode:         c.DB.SSLMode,
+		MaxOpenConns:    c.DB.MaxOpenConns,
+		MaxIdleConns:    c.DB.MaxIdleConns,
+		ConnMaxLifetime: c.DB.ConnMaxLifetime,
+	}
+}
+
+// Conn возвращает подключение к кластеру Kafka
+func (c *Config) Conn() kafka.ConnConfig {
+	return kafka.ConnConfig{
+		Brokers:     kafka.ParseBrokers(c.Kafka.Brokers),
+		DialTimeout: c.Kafka.DialTimeout,
+		SASL: kafka.SASLConfig{
+			Mechanism: c.Kafka.SASL.Mechanism,
+			Username:  c.Kafka.SASL.Username,
+			Password:  c.Kafka.SASL.Password,
+		},
+		TLS: kafka.TLSConfig{
+			Enabled:            c.Kafka.TLS.Enabled,
+			CAFile:             c.Kafka.TLS.CAFile,
+			CertFile:           c.Kafka.TLS.CertFile,
+			KeyFile:            c.Kafka.TLS.KeyFile,
+			ServerName:         c.Kafka.TLS.ServerName,
+			InsecureSkipVerify: c.Kafka.TLS.InsecureSkipVerify,
+		},
+	}
+}
+
+// Fetch возвращает параметры чтения топика
+func (c *Config) Fetch() kafka.FetchConfig {
+	return kafka.FetchConfig{
+		GroupID:        c.Kafka.GroupID,
+		MinBytes:       c.Kafka.MinBytes,
+		MaxBytes:       c.Kafka.MaxBytes,
+		CommitInterval: c.Kafka.CommitInterval,
+	}
+}
+
+// Retry возвращает политику повторов
+func (c *Config) Retry() kafka.RetryPolicy {
+	return kafka.RetryPolicy{
+		MaxAttempts:    c.Kafka.Retry.MaxAttempts,
+		InitialBackoff: c.Kafka.Retry.InitialBackoff,
+		MaxBackoff:     c.Kafka.Retry.MaxBackoff,
+		Multiplier:     c.Kafka.Retry.Multiplier,
+		Jitter:         c.Kafka.Retry.Jitter,
+		OnExhausted:    kafka.ExhaustedAction(c.Kafka.Retry.OnExhausted),
+	}
+}
+
+// Batch возвращает конфигурацию пакетного режима
+func (c *Config) Batch() kafka.BatchConfig {
+	return kafka.BatchConfig{Size: c.Kafka.Batch.Size, Wait: c.Kafka.Batch.Wait}
+}
+
+// Workers возвращает конфигурацию параллельной обработки
+func (c *Config) Workers() kafka.WorkerConfig {
+	return kafka.WorkerConfig{
+		Workers:   c.Kafka.Workers.Count,
+		Ordering:  kafka.Ordering(c.Kafka.Workers.Ordering),
+		QueueSize: c.Kafka.Workers.QueueSize,
+	}
+}
+
+// Authentication возвращает конфигурацию аутентификации; ошибка означает неверный список API ключей
+func (c *Config) Authentication() (auth.Config, error) {
+	keys, err := auth.ParseAPIKeys(c.Auth.APIKeys)
+	if err != nil {
+		return auth.Config{}, err
+	}
+	return auth.Config{
+		Enabled:  c.Auth.Enabled,
+		APIKeys:  keys,
+		JWKSFile: c.Auth.JWKSFile,
+		JWT: auth.JWTConfig{
+			Issuer:    c.Auth.JWTIssuer,
+			Audience:  c.Auth.JWTAudience,
+			RoleClaim: c.Auth.JWTRoleClaim,
+			Leeway:    c.Auth.JWTLeeway,
+		},
+	}, nil
+}
+
+// Redaction возвращает политику маскирования персональных данных
+func (c *Config) Redaction() redact.Policy {
+	return redact.Policy{
+		Fields:  redact.ParseFields(c.Redact.Fields),
+		Reader:  redact.Mode(c.Redact.Reader),
+		Support: redact.Mode(c.Redact.Support),
+		Admin:   redact.Mode(c.Redact.Admin),
+		Debug:   redact.Mode(c.Redact.Debug),
+		Info:    redact.Mode(c.Redact.Info),
+	}
+}
+
+// CacheLimits возвращает ограничения кеша
+func (c *Config) CacheLimits() cache.Config {
+	return cache.Config{MaxEntries: c.Cache.MaxEntries, MaxBytes: c.Cache.MaxBytes, TTL: c.Cache.TTL}
+}
+
+// Validate проверяет всю конфигурацию и возвращает все найденные ошибки сразу,
+// каждую с префиксом раздела
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(section string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", section, err))
+		}
+	}
+
+	check("db", c.Database().Validate())
+
+	check("kafka", c.Conn().Validate())
+	if c.Kafka.Topic == "" {
+		check("kafka", errors.New("topic must not be empty"))
+	}
+	if c.Kafka.DLQTopic != "" && c.Kafka.DLQTopic == c.Kafka.Topic {
+		check("kafka", fmt.Errorf("dead-letter topic must differ from topic %q", c.Kafka.Topic))
+	}
+	check("kafka", c.Fetch().Validate())
+	switch c.Kafka.OffsetStorage {
+	case OffsetStorageKafka:
+	case OffsetStoragePostgres:
+		if c.Kafka.Workers.Count > 1 && c.Kafka.Workers.Ordering != string(kafka.OrderingPartition) {
+			check("kafka", fmt.Errorf("offset storage %s requires partition ordering, got %q", OffsetStoragePostgres, c.Kafka.Workers.Ordering))
+		}
+	default:
+		check("kafka", fmt.Errorf("unknown offset storage %q (expected %s or %s)", c.Kafka.OffsetStorage, OffsetStorageKafka, OffsetStoragePostgres))
+	}
+	check("kafka.retry", c.Retry().Validate())
+	check("kafka.batch", c.Batch().Validate())
+	check("kafka.workers", c.Workers().Validate())
+
+	if c.HTTP.Port < 1 || c.HTTP.Port > 65535 {
+		check("http", fmt.Errorf("port must be in [1, 65535], got %d", c.HTTP.Port))
+	}
+	for _, t := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read timeout", c.HTTP.ReadTimeout},
+		{"write timeout", c.HTTP.WriteTimeout},
+		{"idle timeout", c.HTTP.IdleTimeout},
+	} {
+		if t.value < 0 {
+			check("http", fmt.Errorf("%s must be >= 0, got %s", t.name, t.value))
+		}
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		check("http", fmt.Errorf("shutdown timeout must be positive, got %s", c.HTTP.ShutdownTimeout))
+	}
+	check("http.tls", c.HTTP.TLS.validate())
+	if c.HTTP.RedirectPort != 0 {
+		switch {
+		case !c.HTTP.TLS.Enabled:
+			check("http", errors.New("redirect port requires tls to be enabled"))
+		case c.HTTP.RedirectPort < 1 || c.HTTP.RedirectPort > 65535:
+			check("http", fmt.Errorf("redirect port must be in [1, 65535], got %d", c.HTTP.RedirectPort))
+		case c.HTTP.RedirectPort == c.HTTP.Port:
+			check("http", fmt.Errorf("redirect port must differ from port %d", c.HTTP.Port))
+		}
+	}
+
+	authConfig, err := c.Authentication()
+	if err == nil {
+		err = authConfig.Validate()
+	}
+	check("auth", err)
+	if c.Auth.JWKSFile != "" && c.Auth.JWKSReload <= 0 {
+		check("auth", fmt.Errorf("jwks reload interval must be positive, got %s", c.Auth.JWKSReload))
+	}
+
+	check("redact", c.Redaction().Validate())
+
+	check("cache", c.CacheLimits().Validate())
+	if c.Cache.WarmupChunk < 1 {
+		check("cache", fmt.Errorf("warmup chunk must be >= 1, got %d", c.Cache.WarmupChunk))
+	}
+
+	if c.Validation.RulesFile != "" && c.Validation.RulesReload <= 0 {
+		check("validation", fmt.Errorf("rules reload interval must be positive, got %s", c.Validation.RulesReload))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate проверяет настройки HTTPS; файлы сертификатов читаются при старте сервера
+func (t ServerTLSConfig) validate() error {
+	if _, err := certs.ParseClientAuth(t.ClientAuth); err != nil {
+		return err
+	}
+	if !t.Enabled {
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return errors.New("cert file and key file are required when tls is enabled")
+	}
+	if t.ClientAuth == certs.ClientAuthNone && t.ClientCAFile != "" {
+		return fmt.Errorf("client ca file is set but client auth is %s", certs.ClientAuthNone)
+	}
+	if t.ClientAuth != certs.ClientAuthNone && t.ClientCAFile == "" {
+		return fmt.Errorf("client auth %s requires a client ca file", t.ClientAuth)
+	}
+	if t.ReloadInterval <= 0 {
+		return fmt.Errorf("reload interval must be positive, got %s", t.ReloadInterval)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Источники значений в порядке возрастания приоритета
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnvFile = "env_file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// DefaultEnvFile — env файл, который читается, если не задан флаг -env-file
+const DefaultEnvFile = "config.env"
+
+// EnvConfigFile — переменная окружения с путем к файлу конфигурации (как флаг -config)
+const EnvConfigFile = "CONFIG_FILE"
+
+// Load собирает конфигурацию: значения по умолчанию, файл YAML или TOML (-config или CONFIG_FILE),
+// env файл (-env-file, по умолчанию config.env), переменные окружения и флаги командной строки;
+// каждый следующий источник переопределяет предыдущий. args — аргументы без имени программы.
+// Возвращает оставшиеся после флагов аргументы (подкоманду) и все ошибки разбора и проверки сразу.
+// Для -h возвращает flag.ErrHelp.
+func Load(args []string, output io.Writer) (*Config, []string, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	// Флаги разбираются первыми, чтобы узнать пути к файлам, но применяются последними
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", "", "YAML or TOML config file (env "+EnvConfigFile+")")
+	envFile := fs.String("env-file", DefaultEnvFile, "env file, empty to skip")
+	flagValues := make(map[string]*flagValue, len(fields))
+	for _, f := range fields {
+		v := &flagValue{isBool: f.value.Kind() == reflect.Bool, value: f.format()}
+		flagValues[f.key] = v
+		fs.Var(v, f.flag(), f.usage+" (env "+f.env+")")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [migrate up|down [N]|status | replay [replay flags] | config]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	var envFileValues map[string]string
+	if *envFile != "" {
+		values, err := godotenv.Read(*envFile)
+		switch {
+		case err == nil:
+			envFileValues = values
+		case errors.Is(err, os.ErrNotExist) && !flagSet(fs, "env-file"):
+			// Env файл по умолчанию необязателен
+		default:
+			return nil, nil, fmt.Errorf("failed to read env file %s: %w", *envFile, err)
+		}
+	}
+
+	path := *configFile
+	if path == "" {
+		if value, ok := os.LookupEnv(EnvConfigFile); ok {
+			path = value
+		} else {
+			path = envFileValues[EnvConfigFile]
+		}
+	}
+
+	var errs []error
+	set := func(f field, source, origin, value string) {
+		if err := f.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", origin, err))
+			return
+		}
+		cfg.sources[f.key] = source
+	}
+
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		known := make(map[string]bool, len(fields))
+		for _, f := range fields {
+			known[f.key] = true
+			if value, ok := values[f.key]; ok {
+				set(f, SourceFile, path+": "+f.key, value)
+			}
+		}
+		for _, key := range sortedKeys(values) {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s: unknown key %q", path, key))
+			}
+		}
+	}
+
+	fromEnvFile := func(name string) (string, bool) {
+		value, ok := envFileValues[name]
+		return value, ok
+	}
+	for _, f := range fields {
+		if name, value, ok := f.lookup(fromEnvFile); ok {
+			set(f, SourceEnvFile, *envFile+": "+name, value)
+		}
+	}
+	for _, f := range fields {
+		if name, value, ok := f.lookup(os.LookupEnv); ok {
+			set(f, SourceEnv, "env "+name, value)
+		}
+	}
+	for _, f := range fields {
+		if v := flagValues[f.key]; v.set {
+			set(f, SourceFlag, "flag -"+f.flag(), v.value)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// field — настраиваемое поле конфигурации
+type field struct {
+	key    string // Путь в файле конфигурации, например db.host
+	env    string
+	alias  string // Прежнее имя переменной окружения
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// fields возвращает поля конфигурации в порядке объявления
+func (c *Config) fields() []field {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+
+	var out []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			key := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			out = append(out, field{
+				key:    key,
+				env:    sf.Tag.Get("env"),
+				alias:  sf.Tag.Get("alias"),
+				usage:  sf.Tag.Get("usage"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return out
+}
+
+// lookup ищет значение поля по имени переменной, а если его нет — по прежнему имени
+func (f field) lookup(get func(name string) (string, bool)) (string, string, bool) {
+	if value, ok := get(f.env); ok {
+		return f.env, value, true
+	}
+	if f.alias != "" {
+		if value, ok := get(f.alias); ok {
+			return f.alias, value, true
+		}
+	}
+	return "", "", false
+}
+
+// flag возвращает имя флага: переменная окружения в нижнем регистре через дефис (DB_HOST -> db-host)
+func (f field) flag() string {
+	return strings.ReplaceAll(strings.ToLower(f.env), "_", "-")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set разбирает строковое значение по типу поля
+func (f field) set(value string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (expected e.g. 500ms, 10s, 5m)", value)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (expected true or false)", value)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(x)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// format возвращает значение поля в том же виде, в каком оно задается
+func (f field) format() string {
+	if f.value.Type() == durationType {
+		return time.Duration(f.value.Int()).String()
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// flagValue запоминает значение флага; разбор выполняется вместе с остальными источниками
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	v.set = true
+	return nil
+}
+
+// IsBoolFlag позволяет задавать логические флаги без значения (-db-auto-migrate)
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// flagSet сообщает, задан ли флаг в командной строке
+func flagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// readFile читает файл конфигурации YAML или TOML и возвращает значения по ключам вида db.host
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		_, err = toml.Decode(string(data), &tree)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (expected .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten(tree, "", values); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten раскладывает вложенные разделы файла в ключи вида kafka.retry.max_attempts
+func flatten(tree map[string]interface{}, prefix string, out map[string]string) error {
+	for key, value := range tree {
+		key = prefix + key
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(v, key+".", out); err != nil {
+				return err
+			}
+		case []interface{}:
+			// Списки задаются так же, как в переменных окружения: через запятую
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				if _, ok := item.(map[string]interface{}); ok {
+					return fmt.Errorf("%s: list items must be scalar", key)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		case float64:
+			out[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
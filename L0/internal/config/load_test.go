@@ -0,0 +1,169 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile создает файл во временном каталоге теста и возвращает его путь
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// settings возвращает итоговые параметры по ключам
+func settings(cfg *Config) map[string]Setting {
+	out := make(map[string]Setting)
+	for _, s := range cfg.Settings() {
+		out[s.Key] = s
+	}
+	return out
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+db:
+  host: file-host
+  port: 5433
+  user: file-user
+  name: file-db
+`)
+	envFile := writeFile(t, "test.env", "DB_HOST=envfile-host\nDB_USER=envfile-user\nDB_NAME=envfile-db\n")
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_NAME", "env-db")
+
+	cfg, rest, err := Load([]string{"-config", file, "-env-file", envFile, "-db-host", "flag-host", "replay", "-dry-run"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := strings.Join(rest, " "); got != "replay -dry-run" {
+		t.Errorf("remaining args = %q, want %q", got, "replay -dry-run")
+	}
+
+	tests := []struct {
+		key        string
+		wantValue  string
+		wantSource string
+	}{
+		{key: "db.sslmode", wantValue: Default().DB.SSLMode, wantSource: SourceDefault},
+		{key: "db.port", wantValue: "5433", wantSource: SourceFile},
+		{key: "db.user", wantValue: "envfile-user", wantSource: SourceEnvFile},
+		{key: "db.name", wantValue: "env-db", wantSource: SourceEnv},
+		{key: "db.host", wantValue: "flag-host", wantSource: SourceFlag},
+	}
+
+	got := settings(cfg)
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if s := got[tt.key]; s.Value != tt.wantValue || s.Source != tt.wantSource {
+				t.Errorf("%s = %q from %s, want %q from %s", tt.key, s.Value, s.Source, tt.wantValue, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadBrokerAlias(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		envFile    string
+		wantValue  string
+		wantSource string
+	}{
+		{name: "alias in env", env: map[string]string{"KAFKA_BROKER": "old:9092"}, wantValue: "old:9092", wantSource: SourceEnv},
+		{name: "alias in env file", envFile: "KAFKA_BROKER=old:9092\n", wantValue: "old:9092", wantSource: SourceEnvFile},
+		{name: "current name wins over alias", env: map[string]string{"KAFKA_BROKER": "old:9092", "KAFKA_BROKERS": "new:9092"}, wantValue: "new:9092", wantSource: SourceEnv},
+		{name: "env alias overrides env file", env: map[string]string{"KAFKA_BROKER": "old:9092"}, envFile: "KAFKA_BROKERS=file:9092\n", wantValue: "old:9092", wantSource: SourceEnv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, _, err := Load([]string{"-env-file", writeFile(t, "test.env", tt.envFile)}, io.Discard)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if s := settings(cfg)["kafka.brokers"]; s.Value != tt.wantValue || s.Source != tt.wantSource {
+				t.Errorf("kafka.brokers = %q from %s, want %q from %s", s.Value, s.Source, tt.wantValue, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		wants []string // Подстроки, которые должны быть в тексте ошибки
+	}{
+		{
+			name:  "unknown file keys",
+			file:  "db:\n  hots: localhost\nkafka:\n  topik: orders\n",
+			wants: []string{`unknown key "db.hots"`, `unknown key "kafka.topik"`},
+		},
+		{
+			name: "several errors are returned together",
+			file: "http:\n  port: 0\nunknown: 1\n",
+			env:  map[string]string{"DB_PORT": "abc"},
+			args: []string{"-kafka-dial-timeout", "soon"},
+			wants: []string{
+				`unknown key "unknown"`,
+				`env DB_PORT: invalid integer "abc"`,
+				`flag -kafka-dial-timeout: invalid duration "soon"`,
+				"http: port must be in [1, 65535], got 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := append([]string{"-env-file", "", "-config", writeFile(t, "config.yaml", tt.file)}, tt.args...)
+
+			_, _, err := Load(args, io.Discard)
+			if err == nil {
+				t.Fatal("Load() error = nil, want errors")
+			}
+			for _, want := range tt.wants {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestSettingsRedactSecrets(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "s3cret-password")
+
+	cfg, _, err := Load([]string{"-env-file", ""}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	got := settings(cfg)
+	if s := got["db.password"]; s.Value != redacted || s.Source != SourceEnv {
+		t.Errorf("db.password = %q from %s, want %q from %s", s.Value, s.Source, redacted, SourceEnv)
+	}
+	if s := got["kafka.sasl.password"]; s.Value != "" {
+		t.Errorf("empty kafka.sasl.password = %q, want empty", s.Value)
+	}
+	for _, line := range cfg.LogLines() {
+		if strings.Contains(line, "s3cret-password") {
+			t.Errorf("log line %q contains the secret", line)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// redacted заменяет непустые секреты при выводе конфигурации
+const redacted = "******"
+
+// Setting — итоговое значение параметра и его источник
+type Setting struct {
+	Key    string // Путь в файле конфигурации, например db.host
+	Env    string // Переменная окружения
+	Value  string // Значение; секреты скрыты
+	Source string // Источник итогового значения
+}
+
+// Settings возвращает итоговые значения всех параметров в порядке объявления; секреты скрыты
+func (c *Config) Settings() []Setting {
+	fields := c.fields()
+	settings := make([]Setting, 0, len(fields))
+	for _, f := range fields {
+		value := f.format()
+		if f.secret && value != "" {
+			value = redacted
+		}
+		source := c.sources[f.key]
+		if source == "" {
+			source = SourceDefault
+		}
+		settings = append(settings, Setting{Key: f.key, Env: f.env, Value: value, Source: source})
+	}
+	return settings
+}
+
+// LogLines возвращает итоговую конфигурацию в формате logfmt, по строке на раздел:
+// section=kafka.retry max_attempts="5" ...; секреты скрыты
+func (c *Config) LogLines() []string {
+	var lines []string
+	var section string
+	var b strings.Builder
+	for _, s := range c.Settings() {
+		dot := strings.LastIndex(s.Key, ".")
+		if s.Key[:dot] != section || b.Len() == 0 {
+			if b.Len() > 0 {
+				lines = append(lines, b.String())
+				b.Reset()
+			}
+			section = s.Key[:dot]
+			fmt.Fprintf(&b, "section=%s", section)
+		}
+		fmt.Fprintf(&b, " %s=%q", s.Key[dot+1:], s.Value)
+	}
+	if b.Len() > 0 {
+		lines = append(lines, b.String())
+	}
+	return lines
+}
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SaveOrders сохраняет пакет заказов в одной транзакции.
+// Заказы, доставка, оплата и товары записываются многострочными upsert'ами
+// через unnest массивов, поэтому число запросов не зависит от размера пакета.
+// Если order_uid встречается в пакете несколько раз, в таблицах остается последняя
+// версия, а в журнал ревизий попадают все версии по порядку.
+func (db *DB) SaveOrders(writes []repository.OrderWrite) (err error) {
+	defer func(start time.Time) { metrics.ObserveDB("save_orders", start, err) }(time.Now())
+
+	if len(writes) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Этапы проверяются до выбора последних версий: статусы заполняются у всех версий
+	transitions, err := applyStatuses(tx, writes)
+	if err != nil {
+		return err
+	}
+
+	orders := latestOrders(writes)
+
+	var (
+		uids, tracks, entries, locales, signatures, customers []string
+		services, shardkeys, dates, oofShards                 []string
+		smIDs, statuses                                       []int64
+		cancelled                                             []sql.NullString
+	)
+	for _, o := range orders {
+		uids = append(uids, o.OrderUID)
+		tracks = append(tracks, o.TrackNumber)
+		entries = append(entries, o.Entry)
+		locales = append(locales, o.Locale)
+		signatures = append(signatures, o.InternalSignature)
+		customers = append(customers, o.CustomerID)
+		services = append(services, o.DeliveryService)
+		shardkeys = append(shardkeys, o.Shardkey)
+		smIDs = append(smIDs, int64(o.SmID))
+		dates = append(dates, string(pq.FormatTimestamp(o.DateCreated)))
+		oofShards = append(oofShards, o.OofShard)
+		statuses = append(statuses, int64(o.Status))
+		var cancelledAt sql.NullString
+		if on := cancelledOn(o); on.Valid {
+			cancelledAt = sql.NullString{String: string(pq.FormatTimestamp(on.Time)), Valid: true}
+		}
+		cancelled = append(cancelled, cancelledAt)
+	}
+
+	// Строки заказов блокируются в порядке order_uid, чтобы параллельные пакеты не взаимоблокировались.
+	// Отмена не перезаписывается и возвращается для заполнения заказов пакета.
+	rows, err := tx.Query(`
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature,
+			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, cancelled_at)
+		SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::varchar[], $4::varchar[], $5::varchar[],
+			$6::varchar[], $7::varchar[], $8::varchar[], $9::integer[], $10::timestamp[], $11::varchar[],
+			$12::integer[], $13::timestamp[])
+		ORDER BY 1
+		ON CONFLICT (order_uid) DO UPDATE SET
+			track_number = EXCLUDED.track_number,
+			entry = EXCLUDED.entry,
+			locale = EXCLUDED.locale,
+			internal_signature = EXCLUDED.internal_signature,
+			customer_id = EXCLUDED.customer_id,
+			delivery_service = EXCLUDED.delivery_service,
+			shardkey = EXCLUDED.shardkey,
+			sm_id = EXCLUDED.sm_id,
+			date_created = EXCLUDED.date_created,
+			oof_shard = EXCLUDED.oof_shard,
+			status = EXCLUDED.status,
+			cancelled_at = COALESCE(orders.cancelled_at, EXCLUDED.cancelled_at)
+		RETURNING order_uid, cancelled_at, cancel_reason`,
+		pq.Array(uids), pq.Array(tracks), pq.Array(entries), pq.Array(locales),
+		pq.Array(signatures), pq.Array(customers), pq.Array(services),
+		pq.Array(shardkeys), pq.Array(smIDs), pq.Array(dates), pq.Array(oofShards),
+		pq.Array(statuses), pq.Array(cancelled))
+	if err != nil {
+		return fmt.Errorf("failed to upsert orders: %w", err)
+	}
+	if err := applyCancellations(rows, writes); err != nil {
+		return err
+	}
+
+	if err := saveDeliveries(tx, orders); err != nil {
+		return err
+	}
+	if err := savePayments(tx, orders); err != nil {
+		return err
+	}
+	if err := saveItemsBatch(tx, orders); err != nil {
+		return err
+	}
+	if err := saveTransitions(tx, transitions); err != nil {
+		return err
+	}
+
+	sources := make([]*models.Source, 0, len(writes))
+	for _, w := range writes {
+		if err := saveRevision(tx, w.Order, w.Source); err != nil {
+			return err
+		}
+		sources = append(sources, w.Source)
+	}
+
+	if err := saveOffsets(tx, sources); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// latestOrders оставляет последнюю версию каждого заказа пакета
+func latestOrders(writes []repository.OrderWrite) []*models.Order {
+	index := make(map[string]int, len(writes))
+	orders := make([]*models.Order, 0, len(writes))
+	for _, w := range writes {
+		if i, ok := index[w.Order.OrderUID]; ok {
+			orders[i] = w.Order
+			continue
+		}
+		index[w.Order.OrderUID] = len(orders)
+		orders = append(orders, w.Order)
+	}
+	return orders
+}
+
+// applyCancellations заполняет поля отмены всех версий заказов пакета
+// значениями, которые вернул upsert
+func applyCancellations(rows *sql.Rows, writes []repository.OrderWrite) error {
+	defer rows.Close()
+
+	type cancellation struct {
+		at     *time.Time
+		reason string
+	}
+	byUID := make(map[string]cancellation, len(writes))
+	for rows.Next() {
+		var uid, reason string
+		var at sql.NullTime
+		if err := rows.Scan(&uid, &at, &reason); err != nil {
+			return fmt.Errorf("failed to scan upserted order: %w", err)
+		}
+		byUID[uid] = cancellation{at: nullTime(at), reason: reason}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to upsert orders: %w", err)
+	}
+
+	for _, w := range writes {
+		c := byUID[w.Order.OrderUID]
+		w.Order.CancelledAt, w.Order.CancelReason = c.at, c.reason
+	}
+	return nil
+}
+
+func saveDeliveries(tx *sql.Tx, orders []*models.Order) error {
+	var uids, names, phones, zips, cities, addresses, regions, emails []string
+	for _, o := range orders {
+		d := o.Delivery
+		uids = append(uids, o.OrderUID)
+		names = append(names, d.Name)
+		phones = append(phones, d.Phone)
+		zips = append(zips, d.Zip)
+		cities = append(cities, d.City)
+		addresses = append(addresses, d.Address)
+		regions = append(regions, d.Region)
+		emails = append(emails, d.Email)
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
+		SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::varchar[], $4::varchar[],
+			$5::varchar[], $6::text[], $7::varchar[], $8::varchar[])
+		ON CONFLICT (order_uid) DO UPDATE SET
+			name = EXCLUDED.name,
+			phone = EXCLUDED.phone,
+			zip = EXCLUDED.zip,
+			city = EXCLUDED.city,
+			address = EXCLUDED.address,
+			region = EXCLUDED.region,
+			email = EXCLUDED.email`,
+		pq.Array(uids), pq.Array(names), pq.Array(phones), pq.Array(zips),
+		pq.Array(cities), pq.Array(addresses), pq.Array(regions), pq.Array(emails))
+	if err != nil {
+		return fmt.Errorf("failed to upsert deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func savePayments(tx *sql.Tx, orders []*models.Order) error {
+	var uids, transactions, requestIDs, currencies, providers, banks []string
+	var amounts, paymentDts, deliveryCosts, goodsTotals, customFees []int64
+	for _, o := range orders {
+		p := o.Payment
+		uids = append(uids, o.OrderUID)
+		transactions = append(transactions, p.Transaction)
+		requestIDs = append(requestIDs, p.RequestID)
+		currencies = append(currencies, p.Currency)
+		providers = append(providers, p.Provider)
+		amounts = append(amounts, int64(p.Amount))
+		paymentDts = append(paymentDts, p.PaymentDt)
+		banks = append(banks, p.Bank)
+		deliveryCosts = append(deliveryCosts, int64(p.DeliveryCost))
+		goodsTotals = append(goodsTotals, int64(p.GoodsTotal))
+		customFees = append(customFees, int64(p.CustomFee))
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO payments (order_uid, transaction, request_id, currency, provider,
+			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+		SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::varchar[], $4::varchar[], $5::varchar[],
+			$6::integer[], $7::bigint[], $8::varchar[], $9::integer[], $10::integer[], $11::integer[])
+		ON CONFLICT (order_uid) DO UPDATE SET
+			transaction = EXCLUDED.transaction,
+			request_id = EXCLUDED.request_id,
+			currency = EXCLUDED.currency,
+			provider = EXCLUDED.provider,
+			amount = EXCLUDED.amount,
+			payment_dt = EXCLUDED.payment_dt,
+			bank = EXCLUDED.bank,
+			delivery_cost = EXCLUDED.delivery_cost,
+			goods_total = EXCLUDED.goods_total,
+			custom_fee = EXCLUDED.custom_fee`,
+		pq.Array(uids), pq.Array(transactions), pq.Array(requestIDs), pq.Array(currencies),
+		pq.Array(providers), pq.Array(amounts), pq.Array(paymentDts), pq.Array(banks),
+		pq.Array(deliveryCosts), pq.Array(goodsTotals), pq.Array(customFees))
+	if err != nil {
+		return fmt.Errorf("failed to upsert payments: %w", err)
+	}
+
+	return nil
+}
+
+// saveItemsBatch сверяет товары всех заказов пакета, как saveItems для одного заказа.
+// Повторяющийся в заказе rid сохраняется один раз, последней версией.
+func saveItemsBatch(tx *sql.Tx, orders []*models.Order) error {
+	var uids []string
+	var (
+		itemUIDs, tracks, rids, names, sizes, brands []string
+		chrtIDs, prices, sales, totals, nmIDs, stats []int64
+	)
+	for _, o := range orders {
+		uids = append(uids, o.OrderUID)
+
+		index := make(map[string]int, len(o.Items))
+		for _, item := range o.Items {
+			if i, ok := index[item.Rid]; ok {
+				tracks[i], names[i], sizes[i], brands[i] = item.TrackNumber, item.Name, item.Size, item.Brand
+				chrtIDs[i], prices[i], sales[i] = int64(item.ChrtID), int64(item.Price), int64(item.Sale)
+				totals[i], nmIDs[i], stats[i] = int64(item.TotalPrice), int64(item.NmID), int64(item.Status)
+				continue
+			}
+			index[item.Rid] = len(rids)
+
+			itemUIDs = append(itemUIDs, o.OrderUID)
+			tracks = append(tracks, item.TrackNumber)
+			rids = append(rids, item.Rid)
+			names = append(names, item.Name)
+			sizes = append(sizes, item.Size)
+			brands = append(brands, item.Brand)
+			chrtIDs = append(chrtIDs, int64(item.ChrtID))
+			prices = append(prices, int64(item.Price))
+			sales = append(sales, int64(item.Sale))
+			totals = append(totals, int64(item.TotalPrice))
+			nmIDs = append(nmIDs, int64(item.NmID))
+			stats = append(stats, int64(item.Status))
+		}
+	}
+
+	_, err := tx.Exec(`
+		DELETE FROM items i
+		WHERE i.order_uid = ANY($1)
+			AND NOT EXISTS (
+				SELECT 1 FROM unnest($2::varchar[], $3::varchar[]) AS n(order_uid, rid)
+				WHERE n.order_uid = i.order_uid AND n.rid = i.rid
+			)`,
+		pq.Array(uids), pq.Array(itemUIDs), pq.Array(rids))
+	if err != nil {
+		return fmt.Errorf("failed to delete stale items: %w", err)
+	}
+
+	if len(rids) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name,
+			sale, size, total_price, nm_id, brand, status)
+		SELECT * FROM unnest($1::varchar[], $2::integer[], $3::varchar[], $4::integer[], $5::varchar[], $6::varchar[],
+			$7::integer[], $8::varchar[], $9::integer[], $10::integer[], $11::varchar[], $12::integer[])
+		ON CONFLICT (order_uid, rid) DO UPDATE SET
+			chrt_id = EXCLUDED.chrt_id,
+			track_number = EXCLUDED.track_number,
+			price = EXCLUDED.price,
+			name = EXCLUDED.name,
+			sale = EXCLUDED.sale,
+			size = EXCLUDED.size,
+			total_price = EXCLUDED.total_price,
+			nm_id = EXCLUDED.nm_id,
+			brand = EXCLUDED.brand,
+			status = EXCLUDED.status`,
+		pq.Array(itemUIDs), pq.Array(chrtIDs), pq.Array(tracks), pq.Array(prices),
+		pq.Array(rids), pq.Array(names), pq.Array(sales), pq.Array(sizes),
+		pq.Array(totals), pq.Array(nmIDs), pq.Array(brands), pq.Array(stats))
+	if err != nil {
+		return fmt.Errorf("failed to upsert items: %w", err)
+	}
+
+	return nil
+}
@@ -1,23 +1,90 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"order-service/internal/metrics"
 	"order-service/internal/models"
+	"order-service/internal/repository"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// DB — PostgreSQL реализация repository.OrderRepository
 type DB struct {
 	conn *sql.DB
 }
 
+var _ repository.OrderRepository = (*DB)(nil)
+
+// Config задает подключение к PostgreSQL и пул соединений
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+
+	MaxOpenConns    int           // Максимальное число открытых соединений
+	MaxIdleConns    int           // Максимальное число простаивающих соединений
+	ConnMaxLifetime time.Duration // Время жизни соединения, 0 — без ограничения
+}
+
+// DefaultConfig возвращает параметры подключения к локальной базе данных
+func DefaultConfig() Config {
+	return Config{
+		Host:            "localhost",
+		Port:            5432,
+		User:            "postgres",
+		Password:        "postgres",
+		Name:            "orders_db",
+		SSLMode:         "disable",
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 5 * time.Minute,
+	}
+}
+
+// Validate проверяет корректность конфигурации
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return errors.New("database host must not be empty")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("database port must be in [1, 65535], got %d", c.Port)
+	}
+	if c.User == "" {
+		return errors.New("database user must not be empty")
+	}
+	if c.Name == "" {
+		return errors.New("database name must not be empty")
+	}
+	switch c.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("unknown database sslmode %q", c.SSLMode)
+	}
+	if c.MaxOpenConns < 1 {
+		return fmt.Errorf("database max open conns must be >= 1, got %d", c.MaxOpenConns)
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("database max idle conns must be in [0, %d], got %d", c.MaxOpenConns, c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime < 0 {
+		return fmt.Errorf("database conn max lifetime must be >= 0, got %s", c.ConnMaxLifetime)
+	}
+	return nil
+}
+
 // New создает новое подключение к базе данных
-func New(host, port, user, password, dbname, sslmode string) (*DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, sslmode)
+func New(cfg Config) (*DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
 
 	conn, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -25,9 +92,9 @@ func New(host, port, user, password, dbname, sslmode string) (*DB, error) {
 	}
 
 	// Настройка пула соединений
-	conn.SetMaxOpenConns(25)
-	conn.SetMaxIdleConns(25)
-	conn.SetConnMaxLifetime(5 * time.Minute)
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// Проверка соединения
 	if err := conn.Ping(); err != nil {
@@ -38,41 +105,82 @@ func New(host, port, user, password, dbname, sslmode string) (*DB, error) {
 	return &DB{conn: conn}, nil
 }
 
+// Conn возвращает пул соединений (для миграций)
+func (db *DB) Conn() *sql.DB {
+	return db.conn
+}
+
 // Close закрывает соединение с базой данных
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-// SaveOrder сохраняет заказ в базу данных с использованием транзакции
-func (db *DB) SaveOrder(order *models.Order) error {
+// SaveOrder сохраняет заказ в базу данных с использованием транзакции.
+// Если заказ уже существует, он полностью заменяется новой версией:
+// доставка и оплата обновляются, товары сверяются по rid.
+// Смена этапов заказа и товаров проверяется по таблице переходов и записывается в журнал;
+// недопустимый переход возвращается как *models.TransitionError.
+// В той же транзакции в журнал добавляется ревизия, а если у source задана группа,
+// сохраняется смещение сообщения; source может быть nil.
+func (db *DB) SaveOrder(order *models.Order, source *models.Source) (err error) {
+	defer func(start time.Time) { metrics.ObserveDB("save_order", start, err) }(time.Now())
+
 	tx, err := db.conn.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Сохранение основной информации о заказе
-	_, err = tx.Exec(`
+	transitions, err := applyStatuses(tx, []repository.OrderWrite{{Order: order, Source: source}})
+	if err != nil {
+		return err
+	}
+
+	// Сохранение основной информации о заказе; отмена не перезаписывается
+	var cancelledAt sql.NullTime
+	err = tx.QueryRow(`
 		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, 
-			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (order_uid) DO NOTHING`,
+			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, cancelled_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (order_uid) DO UPDATE SET
+			track_number = EXCLUDED.track_number,
+			entry = EXCLUDED.entry,
+			locale = EXCLUDED.locale,
+			internal_signature = EXCLUDED.internal_signature,
+			customer_id = EXCLUDED.customer_id,
+			delivery_service = EXCLUDED.delivery_service,
+			shardkey = EXCLUDED.shardkey,
+			sm_id = EXCLUDED.sm_id,
+			date_created = EXCLUDED.date_created,
+			oof_shard = EXCLUDED.oof_shard,
+			status = EXCLUDED.status,
+			cancelled_at = COALESCE(orders.cancelled_at, EXCLUDED.cancelled_at)
+		RETURNING cancelled_at, cancel_reason`,
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
 		order.InternalSignature, order.CustomerID, order.DeliveryService,
-		order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
+		order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		order.Status, cancelledOn(order)).Scan(&cancelledAt, &order.CancelReason)
 	if err != nil {
-		return fmt.Errorf("failed to insert order: %w", err)
+		return fmt.Errorf("failed to upsert order: %w", err)
 	}
+	order.CancelledAt = nullTime(cancelledAt)
 
 	// Сохранение информации о доставке
 	_, err = tx.Exec(`
 		INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT DO NOTHING`,
+		ON CONFLICT (order_uid) DO UPDATE SET
+			name = EXCLUDED.name,
+			phone = EXCLUDED.phone,
+			zip = EXCLUDED.zip,
+			city = EXCLUDED.city,
+			address = EXCLUDED.address,
+			region = EXCLUDED.region,
+			email = EXCLUDED.email`,
 		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
 		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
 	if err != nil {
-		return fmt.Errorf("failed to insert delivery: %w", err)
+		return fmt.Errorf("failed to upsert delivery: %w", err)
 	}
 
 	// Сохранение информации об оплате
@@ -80,53 +188,159 @@ func (db *DB) SaveOrder(order *models.Order) error {
 		INSERT INTO payments (order_uid, transaction, request_id, currency, provider, 
 			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT DO NOTHING`,
+		ON CONFLICT (order_uid) DO UPDATE SET
+			transaction = EXCLUDED.transaction,
+			request_id = EXCLUDED.request_id,
+			currency = EXCLUDED.currency,
+			provider = EXCLUDED.provider,
+			amount = EXCLUDED.amount,
+			payment_dt = EXCLUDED.payment_dt,
+			bank = EXCLUDED.bank,
+			delivery_cost = EXCLUDED.delivery_cost,
+			goods_total = EXCLUDED.goods_total,
+			custom_fee = EXCLUDED.custom_fee`,
 		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID,
 		order.Payment.Currency, order.Payment.Provider, order.Payment.Amount,
 		order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost,
 		order.Payment.GoodsTotal, order.Payment.CustomFee)
 	if err != nil {
-		return fmt.Errorf("failed to insert payment: %w", err)
+		return fmt.Errorf("failed to upsert payment: %w", err)
+	}
+
+	if err := saveItems(tx, order); err != nil {
+		return err
+	}
+
+	if err := saveTransitions(tx, transitions); err != nil {
+		return err
+	}
+
+	if err := saveRevision(tx, order, source); err != nil {
+		return err
+	}
+
+	if err := saveOffsets(tx, []*models.Source{source}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveRevision добавляет полную версию заказа в журнал ревизий.
+// Повторная доставка того же содержимого новую ревизию не создает.
+func saveRevision(tx *sql.Tx, order *models.Order, source *models.Source) error {
+	data, err := order.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision: %w", err)
+	}
+
+	var topic sql.NullString
+	var partition sql.NullInt32
+	var offset sql.NullInt64
+	if source != nil {
+		topic = sql.NullString{String: source.Topic, Valid: true}
+		partition = sql.NullInt32{Int32: int32(source.Partition), Valid: true}
+		offset = sql.NullInt64{Int64: source.Offset, Valid: true}
+	}
+
+	// Строка заказа уже заблокирована upsert'ом, поэтому номер ревизии вычисляется без гонок
+	_, err = tx.Exec(`
+		INSERT INTO order_revisions (order_uid, revision, data, source_topic, source_partition, source_offset)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2::jsonb, $3::varchar, $4::integer, $5::bigint
+		FROM order_revisions WHERE order_uid = $1
+		HAVING NOT EXISTS (
+			SELECT 1 FROM order_revisions last
+			WHERE last.order_uid = $1 AND last.data = $2::jsonb
+				AND last.revision = (SELECT MAX(revision) FROM order_revisions WHERE order_uid = $1)
+		)`,
+		order.OrderUID, string(data), topic, partition, offset)
+	if err != nil {
+		return fmt.Errorf("failed to insert revision: %w", err)
+	}
+
+	return nil
+}
+
+// saveItems сверяет товары заказа: удаляет отсутствующие в новой версии
+// и обновляет или добавляет остальные по ключу (order_uid, rid)
+func saveItems(tx *sql.Tx, order *models.Order) error {
+	rids := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		rids = append(rids, item.Rid)
+	}
+
+	_, err := tx.Exec(`
+		DELETE FROM items WHERE order_uid = $1 AND NOT (rid = ANY($2))`,
+		order.OrderUID, pq.Array(rids))
+	if err != nil {
+		return fmt.Errorf("failed to delete stale items: %w", err)
 	}
 
-	// Сохранение товаров
 	for _, item := range order.Items {
 		_, err = tx.Exec(`
 			INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, 
 				sale, size, total_price, nm_id, brand, status)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (order_uid, rid) DO UPDATE SET
+				chrt_id = EXCLUDED.chrt_id,
+				track_number = EXCLUDED.track_number,
+				price = EXCLUDED.price,
+				name = EXCLUDED.name,
+				sale = EXCLUDED.sale,
+				size = EXCLUDED.size,
+				total_price = EXCLUDED.total_price,
+				nm_id = EXCLUDED.nm_id,
+				brand = EXCLUDED.brand,
+				status = EXCLUDED.status`,
 			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid,
 			item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID,
 			item.Brand, item.Status)
 		if err != nil {
-			return fmt.Errorf("failed to insert item: %w", err)
+			return fmt.Errorf("failed to upsert item: %w", err)
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 // GetOrder получает заказ из базы данных по UID
-func (db *DB) GetOrder(orderUID string) (*models.Order, error) {
+func (db *DB) GetOrder(orderUID string) (_ *models.Order, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("get_order", start, err) }(time.Now())
+
+	return getOrder(db.conn, orderUID)
+}
+
+// querier обобщает *sql.DB и *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getOrder загружает заказ целиком через соединение или транзакцию
+func getOrder(q querier, orderUID string) (*models.Order, error) {
 	order := &models.Order{}
 
 	// Получение основной информации о заказе
-	err := db.conn.QueryRow(`
+	var cancelledAt sql.NullTime
+	err := q.QueryRow(`
 		SELECT order_uid, track_number, entry, locale, internal_signature,
-			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, created_at
+			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, created_at,
+			cancelled_at, cancel_reason
 		FROM orders WHERE order_uid = $1`, orderUID).Scan(
 		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
 		&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
-		&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.CreatedAt)
+		&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Status, &order.CreatedAt,
+		&cancelledAt, &order.CancelReason)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, models.ErrOrderNotFound
 		}
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
+	order.CancelledAt = nullTime(cancelledAt)
 
 	// Получение информации о доставке
-	err = db.conn.QueryRow(`
+	err = q.QueryRow(`
 		SELECT name, phone, zip, city, address, region, email
 		FROM deliveries WHERE order_uid = $1`, orderUID).Scan(
 		&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
@@ -137,7 +351,7 @@ func (db *DB) GetOrder(orderUID string) (*models.Order, error) {
 	}
 
 	// Получение информации об оплате
-	err = db.conn.QueryRow(`
+	err = q.QueryRow(`
 		SELECT transaction, request_id, currency, provider, amount, payment_dt,
 			bank, delivery_cost, goods_total, custom_fee
 		FROM payments WHERE order_uid = $1`, orderUID).Scan(
@@ -150,10 +364,10 @@ func (db *DB) GetOrder(orderUID string) (*models.Order, error) {
 	}
 
 	// Получение товаров
-	rows, err := db.conn.Query(`
+	rows, err := q.Query(`
 		SELECT chrt_id, track_number, price, rid, name, sale, size, 
 			total_price, nm_id, brand, status
-		FROM items WHERE order_uid = $1`, orderUID)
+		FROM items WHERE order_uid = $1 ORDER BY id`, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get items: %w", err)
 	}
@@ -173,31 +387,307 @@ func (db *DB) GetOrder(orderUID string) (*models.Order, error) {
 	return order, nil
 }
 
-// GetAllOrders получает все заказы из базы данных для восстановления кеша
-func (db *DB) GetAllOrders() ([]*models.Order, error) {
+// DeleteOrder удаляет заказ и в той же транзакции сохраняет смещение source;
+// доставка, оплата и товары удаляются каскадно. Журнал ревизий сохраняется.
+// Если заказа нет, смещение все равно сохраняется и возвращается models.ErrOrderNotFound.
+func (db *DB) DeleteOrder(orderUID string, source *models.Source) (err error) {
+	defer func(start time.Time) { metrics.ObserveDB("delete_order", start, err) }(time.Now())
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM orders WHERE order_uid = $1`, orderUID)
+	if err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+
+	if err := saveOffsets(tx, []*models.Source{source}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit deletion: %w", err)
+	}
+	if n == 0 {
+		return models.ErrOrderNotFound
+	}
+
+	return nil
+}
+
+// CancelOrder переводит заказ в этап models.StatusCancelled и в той же транзакции
+// записывает переход, добавляет ревизию и сохраняет смещение source.
+// Повторная отмена сохраняет время и причину первой; отмена из этапа, для которого
+// переход запрещен, возвращает *models.TransitionError.
+func (db *DB) CancelOrder(orderUID, reason string, at time.Time, source *models.Source) (_ *models.Order, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("cancel_order", start, err) }(time.Now())
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status models.Status
+	err = tx.QueryRow(`SELECT status FROM orders WHERE order_uid = $1 FOR UPDATE`, orderUID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	if status != models.StatusCancelled {
+		if !models.CanTransition(status, models.StatusCancelled) {
+			return nil, &models.TransitionError{OrderUID: orderUID, From: status, To: models.StatusCancelled}
+		}
+
+		_, err = tx.Exec(`
+			UPDATE orders SET
+				status = $2,
+				cancel_reason = CASE WHEN cancelled_at IS NULL THEN $4 ELSE cancel_reason END,
+				cancelled_at = COALESCE(cancelled_at, $3)
+			WHERE order_uid = $1`, orderUID, models.StatusCancelled, at.UTC(), reason)
+		if err != nil {
+			return nil, fmt.Errorf("failed to cancel order: %w", err)
+		}
+
+		err = saveTransitions(tx, []models.Transition{{
+			OrderUID: orderUID,
+			From:     status,
+			To:       models.StatusCancelled,
+			At:       at.UTC(),
+			Source:   source,
+		}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	order, err := getOrder(tx, orderUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := saveRevision(tx, order, source); err != nil {
+		return nil, err
+	}
+
+	if err := saveOffsets(tx, []*models.Source{source}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit cancellation: %w", err)
+	}
+	return order, nil
+}
+
+// cancelledOn возвращает время отмены для заказа, сохраняемого в этапе models.StatusCancelled
+func cancelledOn(order *models.Order) sql.NullTime {
+	if order.Status != models.StatusCancelled {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Now().UTC(), Valid: true}
+}
+
+// nullTime переводит NULL временную метку в nil
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// FindOrderUIDByTrackNumber находит UID последнего заказа с указанным трек-номером
+func (db *DB) FindOrderUIDByTrackNumber(trackNumber string) (string, error) {
+	return db.findOrderUID("find_order_by_track", `
+		SELECT order_uid FROM orders WHERE track_number = $1
+		ORDER BY created_at DESC LIMIT 1`, trackNumber)
+}
+
+// FindOrderUIDByTransaction находит UID последнего заказа с транзакцией оплаты
+func (db *DB) FindOrderUIDByTransaction(transaction string) (string, error) {
+	return db.findOrderUID("find_order_by_transaction", `
+		SELECT p.order_uid FROM payments p
+		JOIN orders o ON o.order_uid = p.order_uid
+		WHERE p.transaction = $1
+		ORDER BY o.created_at DESC LIMIT 1`, transaction)
+}
+
+// findOrderUID находит UID заказа вторичным запросом по индексу
+func (db *DB) findOrderUID(operation, query string, arg string) (_ string, err error) {
+	defer func(start time.Time) { metrics.ObserveDB(operation, start, err) }(time.Now())
+
+	var orderUID string
+	if err := db.conn.QueryRow(query, arg).Scan(&orderUID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", models.ErrOrderNotFound
+		}
+		return "", fmt.Errorf("failed to find order: %w", err)
+	}
+	return orderUID, nil
+}
+
+// GetOrderRevisions возвращает журнал ревизий заказа в порядке возрастания
+func (db *DB) GetOrderRevisions(orderUID string) (_ []*models.Revision, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("get_order_revisions", start, err) }(time.Now())
+
 	rows, err := db.conn.Query(`
-		SELECT order_uid FROM orders ORDER BY created_at DESC`)
+		SELECT revision, data, source_topic, source_partition, source_offset, created_at
+		FROM order_revisions WHERE order_uid = $1 ORDER BY revision`, orderUID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order UIDs: %w", err)
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
 	}
 	defer rows.Close()
 
-	var orders []*models.Order
+	var revisions []*models.Revision
 	for rows.Next() {
-		var orderUID string
-		if err := rows.Scan(&orderUID); err != nil {
-			log.Printf("Error scanning order UID: %v", err)
-			continue
+		rev, err := scanRevision(rows, orderUID)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetOrderRevision возвращает одну ревизию заказа
+func (db *DB) GetOrderRevision(orderUID string, revision int) (_ *models.Revision, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("get_order_revision", start, err) }(time.Now())
+
+	row := db.conn.QueryRow(`
+		SELECT revision, data, source_topic, source_partition, source_offset, created_at
+		FROM order_revisions WHERE order_uid = $1 AND revision = $2`, orderUID, revision)
+
+	rev, err := scanRevision(row, orderUID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrRevisionNotFound
+		}
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// scanner обобщает *sql.Row и *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRevision(s scanner, orderUID string) (*models.Revision, error) {
+	rev := &models.Revision{OrderUID: orderUID}
+
+	var data []byte
+	var topic sql.NullString
+	var partition sql.NullInt32
+	var offset sql.NullInt64
+	if err := s.Scan(&rev.Revision, &data, &topic, &partition, &offset, &rev.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan revision: %w", err)
+	}
+
+	rev.Order = data
+	if topic.Valid {
+		rev.Source = &models.Source{
+			Topic:     topic.String,
+			Partition: int(partition.Int32),
+			Offset:    offset.Int64,
+		}
+	}
+
+	return rev, nil
+}
+
+// CountOrders возвращает количество заказов в базе данных
+func (db *DB) CountOrders(ctx context.Context) (int, error) {
+	var n int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+	return n, nil
+}
+
+// StreamOrders читает все заказы порциями от новых к старым и передает каждую порцию в fn.
+// Порция загружается тремя запросами независимо от ее размера.
+// Ошибка fn прекращает чтение и возвращается вызывающему.
+func (db *DB) StreamOrders(ctx context.Context, chunkSize int, fn func([]*models.Order) error) error {
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+
+	var cursor *models.Cursor
+	for {
+		uids, next, err := db.nextOrderUIDs(ctx, cursor, chunkSize)
+		if err != nil {
+			return err
+		}
+		if len(uids) == 0 {
+			return nil
 		}
 
-		order, err := db.GetOrder(orderUID)
+		orders, err := db.GetOrdersByUIDs(uids)
 		if err != nil {
-			log.Printf("Error getting order %s: %v", orderUID, err)
-			continue
+			return err
+		}
+
+		if err := fn(orders); err != nil {
+			return err
+		}
+
+		if len(uids) < chunkSize {
+			return nil
 		}
+		cursor = next
+	}
+}
 
-		orders = append(orders, order)
+// nextOrderUIDs возвращает следующую порцию UID после курсора
+func (db *DB) nextOrderUIDs(ctx context.Context, cursor *models.Cursor, limit int) ([]string, *models.Cursor, error) {
+	var rows *sql.Rows
+	var err error
+	if cursor == nil {
+		rows, err = db.conn.QueryContext(ctx, `
+			SELECT order_uid, created_at FROM orders
+			ORDER BY created_at DESC, order_uid DESC LIMIT $1`, limit)
+	} else {
+		rows, err = db.conn.QueryContext(ctx, `
+			SELECT order_uid, created_at FROM orders
+			WHERE (created_at, order_uid) < ($1, $2)
+			ORDER BY created_at DESC, order_uid DESC LIMIT $3`,
+			cursor.CreatedAt, cursor.OrderUID, limit)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order UIDs: %w", err)
+	}
+	defer rows.Close()
+
+	uids := make([]string, 0, limit)
+	next := &models.Cursor{}
+	for rows.Next() {
+		if err := rows.Scan(&next.OrderUID, &next.CreatedAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan order UID: %w", err)
+		}
+		uids = append(uids, next.OrderUID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to iterate order UIDs: %w", err)
 	}
 
-	return orders, nil
+	return uids, next, nil
 }
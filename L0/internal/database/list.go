@@ -0,0 +1,221 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ListOrderSummaries возвращает страницу кратких записей заказов по фильтру
+// и курсор следующей страницы (nil, если страница последняя)
+func (db *DB) ListOrderSummaries(filter models.OrderFilter) (_ []*models.OrderSummary, _ *models.Cursor, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("list_orders", start, err) }(time.Now())
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultListLimit
+	}
+	if limit > models.MaxListLimit {
+		limit = models.MaxListLimit
+	}
+
+	where, args := buildOrderFilter(filter)
+	args = append(args, limit+1)
+
+	rows, err := db.conn.Query(`
+		SELECT o.order_uid, o.track_number, COALESCE(o.customer_id, ''), COALESCE(o.delivery_service, ''),
+			COALESCE(o.date_created, 'epoch'), o.created_at,
+			COALESCE(p.currency, ''), COALESCE(p.provider, ''), COALESCE(p.amount, 0),
+			(SELECT COUNT(*) FROM items i WHERE i.order_uid = o.order_uid), o.status
+		FROM orders o
+		LEFT JOIN payments p ON p.order_uid = o.order_uid
+		`+where+`
+		ORDER BY o.created_at DESC, o.order_uid DESC
+		LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make([]*models.OrderSummary, 0, limit)
+	for rows.Next() {
+		s := &models.OrderSummary{}
+		err := rows.Scan(&s.OrderUID, &s.TrackNumber, &s.CustomerID, &s.DeliveryService,
+			&s.DateCreated, &s.CreatedAt, &s.Currency, &s.Provider, &s.Amount, &s.ItemsCount, &s.Status)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan order summary: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
+
+	var next *models.Cursor
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+		last := summaries[limit-1]
+		next = &models.Cursor{CreatedAt: last.CreatedAt, OrderUID: last.OrderUID}
+	}
+
+	return summaries, next, nil
+}
+
+// ListOrders возвращает страницу полных заказов по фильтру в том же порядке,
+// что и ListOrderSummaries
+func (db *DB) ListOrders(filter models.OrderFilter) ([]*models.Order, *models.Cursor, error) {
+	summaries, next, err := db.ListOrderSummaries(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uids := make([]string, 0, len(summaries))
+	for _, s := range summaries {
+		uids = append(uids, s.OrderUID)
+	}
+
+	orders, err := db.GetOrdersByUIDs(uids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return orders, next, nil
+}
+
+// buildOrderFilter строит условие WHERE и его аргументы по фильтру
+func buildOrderFilter(filter models.OrderFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.CustomerID != "" {
+		add("o.customer_id = ?", filter.CustomerID)
+	}
+	if filter.TrackNumber != "" {
+		add("o.track_number = ?", filter.TrackNumber)
+	}
+	if filter.DeliveryService != "" {
+		add("o.delivery_service = ?", filter.DeliveryService)
+	}
+	if !filter.DateFrom.IsZero() {
+		add("o.date_created >= ?", filter.DateFrom)
+	}
+	if !filter.DateTo.IsZero() {
+		add("o.date_created < ?", filter.DateTo)
+	}
+	if filter.Currency != "" {
+		add("p.currency = ?", filter.Currency)
+	}
+	if filter.Provider != "" {
+		add("p.provider = ?", filter.Provider)
+	}
+	if filter.Brand != "" {
+		add("EXISTS (SELECT 1 FROM items bi WHERE bi.order_uid = o.order_uid AND bi.brand = ?)", filter.Brand)
+	}
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.OrderUID)
+		conds = append(conds, fmt.Sprintf("(o.created_at, o.order_uid) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// GetOrdersByUIDs загружает заказы набором запросов (по одному на таблицу)
+// и возвращает их в порядке uids. Отсутствующие заказы пропускаются.
+func (db *DB) GetOrdersByUIDs(uids []string) ([]*models.Order, error) {
+	if len(uids) == 0 {
+		return []*models.Order{}, nil
+	}
+
+	byUID := make(map[string]*models.Order, len(uids))
+
+	rows, err := db.conn.Query(`
+		SELECT o.order_uid, o.track_number, COALESCE(o.entry, ''), COALESCE(o.locale, ''),
+			COALESCE(o.internal_signature, ''), COALESCE(o.customer_id, ''), COALESCE(o.delivery_service, ''),
+			COALESCE(o.shardkey, ''), COALESCE(o.sm_id, 0), COALESCE(o.date_created, 'epoch'),
+			COALESCE(o.oof_shard, ''), o.status, o.created_at, o.cancelled_at, o.cancel_reason,
+			COALESCE(d.name, ''), COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+			COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''),
+			COALESCE(p.transaction, ''), COALESCE(p.request_id, ''), COALESCE(p.currency, ''),
+			COALESCE(p.provider, ''), COALESCE(p.amount, 0), COALESCE(p.payment_dt, 0),
+			COALESCE(p.bank, ''), COALESCE(p.delivery_cost, 0), COALESCE(p.goods_total, 0),
+			COALESCE(p.custom_fee, 0)
+		FROM orders o
+		LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+		LEFT JOIN payments p ON p.order_uid = o.order_uid
+		WHERE o.order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order := &models.Order{}
+		var cancelledAt sql.NullTime
+		err := rows.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
+			&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Status, &order.CreatedAt,
+			&cancelledAt, &order.CancelReason,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
+			&order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region,
+			&order.Delivery.Email,
+			&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
+			&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDt,
+			&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
+			&order.Payment.CustomFee)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		order.CancelledAt = nullTime(cancelledAt)
+		byUID[order.OrderUID] = order
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
+
+	itemRows, err := db.conn.Query(`
+		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+			total_price, nm_id, brand, status
+		FROM items WHERE order_uid = ANY($1) ORDER BY order_uid, id`, pq.Array(uids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var orderUID string
+		var item models.Item
+		err := itemRows.Scan(&orderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid,
+			&item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID,
+			&item.Brand, &item.Status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan item: %w", err)
+		}
+		if order, ok := byUID[orderUID]; ok {
+			order.Items = append(order.Items, item)
+		}
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate items: %w", err)
+	}
+
+	orders := make([]*models.Order, 0, len(byUID))
+	for _, uid := range uids {
+		if order, ok := byUID[uid]; ok {
+			orders = append(orders, order)
+		}
+	}
+
+	return orders, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var _ repository.OffsetStore = (*DB)(nil)
+
+// SaveOffsets сохраняет смещения сообщений, которые не меняют заказы
+func (db *DB) SaveOffsets(ctx context.Context, sources []*models.Source) (err error) {
+	defer func(start time.Time) { metrics.ObserveDB("save_offsets", start, err) }(time.Now())
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveOffsets(tx, sources); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LoadOffsets возвращает следующие смещения партиций топика для группы
+func (db *DB) LoadOffsets(ctx context.Context, group, topic string) (_ map[int]int64, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("load_offsets", start, err) }(time.Now())
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT partition, next_offset FROM consumer_offsets
+		WHERE group_id = $1 AND topic = $2`, group, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load offsets: %w", err)
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("failed to scan offset: %w", err)
+		}
+		offsets[partition] = offset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load offsets: %w", err)
+	}
+
+	return offsets, nil
+}
+
+// saveOffsets записывает в транзакции следующее смещение после каждого источника с группой.
+// Для партиции берется наибольшее смещение, и сохраненное значение никогда не уменьшается:
+// запоздавшая запись после ребалансировки не откатит позицию назад.
+func saveOffsets(tx *sql.Tx, sources []*models.Source) error {
+	type key struct {
+		group, topic string
+		partition    int
+	}
+	next := make(map[key]int64)
+	var keys []key
+	for _, s := range sources {
+		if s == nil || s.Group == "" {
+			continue
+		}
+		k := key{s.Group, s.Topic, s.Partition}
+		offset, ok := next[k]
+		if !ok {
+			keys = append(keys, k)
+		}
+		if !ok || s.Offset+1 > offset {
+			next[k] = s.Offset + 1
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	groups := make([]string, 0, len(keys))
+	topics := make([]string, 0, len(keys))
+	partitions := make([]int64, 0, len(keys))
+	offsets := make([]int64, 0, len(keys))
+	for _, k := range keys {
+		groups = append(groups, k.group)
+		topics = append(topics, k.topic)
+		partitions = append(partitions, int64(k.partition))
+		offsets = append(offsets, next[k])
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO consumer_offsets (group_id, topic, partition, next_offset)
+		SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::integer[], $4::bigint[])
+		ON CONFLICT (group_id, topic, partition) DO UPDATE SET
+			next_offset = GREATEST(consumer_offsets.next_offset, EXCLUDED.next_offset),
+			updated_at = CURRENT_TIMESTAMP`,
+		pq.Array(groups), pq.Array(topics), pq.Array(partitions), pq.Array(offsets))
+	if err != nil {
+		return fmt.Errorf("failed to save offsets: %w", err)
+	}
+
+	return nil
+}
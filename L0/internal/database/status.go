@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// applyStatuses блокирует строки сохраненных заказов, сверяет этапы новых версий с сохраненными
+// и возвращает переходы. Версии одного заказа в пакете проверяются по порядку,
+// каждая относительно предыдущей. Недопустимый переход возвращается как *models.TransitionError.
+func applyStatuses(tx *sql.Tx, writes []repository.OrderWrite) ([]models.Transition, error) {
+	uids := make([]string, 0, len(writes))
+	for _, w := range writes {
+		uids = append(uids, w.Order.OrderUID)
+	}
+
+	snapshots, err := loadStatuses(tx, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	at := time.Now().UTC()
+	var transitions []models.Transition
+	for _, w := range writes {
+		t, err := w.Order.ApplyStatuses(snapshots[w.Order.OrderUID], at, w.Source)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t...)
+		snapshots[w.Order.OrderUID] = w.Order.Snapshot()
+	}
+
+	return transitions, nil
+}
+
+// loadStatuses читает этапы сохраненных заказов и их товаров.
+// Строки заказов блокируются в порядке order_uid, как и при upsert пакета.
+func loadStatuses(tx *sql.Tx, uids []string) (map[string]*models.StatusSnapshot, error) {
+	rows, err := tx.Query(`
+		SELECT order_uid, status FROM orders
+		WHERE order_uid = ANY($1)
+		ORDER BY order_uid
+		FOR UPDATE`, pq.Array(uids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock orders: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := make(map[string]*models.StatusSnapshot, len(uids))
+	for rows.Next() {
+		var uid string
+		var status models.Status
+		if err := rows.Scan(&uid, &status); err != nil {
+			return nil, fmt.Errorf("failed to scan order status: %w", err)
+		}
+		snapshots[uid] = &models.StatusSnapshot{Order: status, Items: make(map[string]models.Status)}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock orders: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return snapshots, nil
+	}
+
+	itemRows, err := tx.Query(`
+		SELECT order_uid, rid, status FROM items WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item statuses: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var uid, rid string
+		var status models.Status
+		if err := itemRows.Scan(&uid, &rid, &status); err != nil {
+			return nil, fmt.Errorf("failed to scan item status: %w", err)
+		}
+		if s, ok := snapshots[uid]; ok {
+			s.Items[rid] = status
+		}
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get item statuses: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// saveTransitions добавляет переходы в журнал одним запросом
+func saveTransitions(tx *sql.Tx, transitions []models.Transition) error {
+	if len(transitions) == 0 {
+		return nil
+	}
+
+	var uids, rids, times []string
+	var froms, tos []int64
+	topics := make([]sql.NullString, 0, len(transitions))
+	partitions := make([]sql.NullInt64, 0, len(transitions))
+	offsets := make([]sql.NullInt64, 0, len(transitions))
+	for _, t := range transitions {
+		uids = append(uids, t.OrderUID)
+		rids = append(rids, t.Rid)
+		froms = append(froms, int64(t.From))
+		tos = append(tos, int64(t.To))
+		times = append(times, string(pq.FormatTimestamp(t.At)))
+
+		var topic sql.NullString
+		var partition, offset sql.NullInt64
+		if t.Source != nil {
+			topic = sql.NullString{String: t.Source.Topic, Valid: true}
+			partition = sql.NullInt64{Int64: int64(t.Source.Partition), Valid: true}
+			offset = sql.NullInt64{Int64: t.Source.Offset, Valid: true}
+		}
+		topics = append(topics, topic)
+		partitions = append(partitions, partition)
+		offsets = append(offsets, offset)
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO order_status_transitions (order_uid, rid, from_status, to_status, occurred_at,
+			source_topic, source_partition, source_offset)
+		SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::integer[], $4::integer[], $5::timestamp[],
+			$6::varchar[], $7::integer[], $8::bigint[])`,
+		pq.Array(uids), pq.Array(rids), pq.Array(froms), pq.Array(tos), pq.Array(times),
+		pq.Array(topics), pq.Array(partitions), pq.Array(offsets))
+	if err != nil {
+		return fmt.Errorf("failed to insert status transitions: %w", err)
+	}
+
+	return nil
+}
+
+// GetOrderTransitions возвращает журнал переходов заказа и его товаров в порядке записи
+func (db *DB) GetOrderTransitions(orderUID string) (_ []*models.Transition, err error) {
+	defer func(start time.Time) { metrics.ObserveDB("get_order_transitions", start, err) }(time.Now())
+
+	rows, err := db.conn.Query(`
+		SELECT rid, from_status, to_status, occurred_at, source_topic, source_partition, source_offset
+		FROM order_status_transitions WHERE order_uid = $1 ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status transitions: %w", err)
+	}
+	defer rows.Close()
+
+	var transitions []*models.Transition
+	for rows.Next() {
+		t := &models.Transition{OrderUID: orderUID}
+		var topic sql.NullString
+		var partition sql.NullInt32
+		var offset sql.NullInt64
+		if err := rows.Scan(&t.Rid, &t.From, &t.To, &t.At, &topic, &partition, &offset); err != nil {
+			return nil, fmt.Errorf("failed to scan status transition: %w", err)
+		}
+		if topic.Valid {
+			t.Source = &models.Source{Topic: topic.String, Partition: int(partition.Int32), Offset: offset.Int64}
+		}
+		transitions = append(transitions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate status transitions: %w", err)
+	}
+
+	return transitions, nil
+}
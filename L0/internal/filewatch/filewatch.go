@@ -0,0 +1,80 @@
+// Package filewatch перечитывает файлы конфигурации, когда меняется время их изменения.
+// Разбор содержимого остается за вызывающим пакетом.
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher вызывает load, когда время изменения хотя бы одного из файлов
+// отличается от запомненного при последней успешной загрузке
+type Watcher struct {
+	files []string
+	load  func() error
+
+	mu       sync.Mutex
+	modTimes []time.Time // nil до первой успешной загрузки
+}
+
+// New создает Watcher для файлов files; load читает и применяет их содержимое
+func New(load func() error, files ...string) *Watcher {
+	return &Watcher{files: files, load: load}
+}
+
+// Reload вызывает load, если файлы изменились, и возвращает true после успешной загрузки.
+// Если load вернул ошибку, время изменения не запоминается и файлы перечитываются
+// при следующей проверке, даже если их больше не трогали.
+func (w *Watcher) Reload() (bool, error) {
+	modTimes := make([]time.Time, 0, len(w.files))
+	for _, path := range w.files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.modTimes != nil && equalTimes(modTimes, w.modTimes) {
+		return false, nil
+	}
+	if err := w.load(); err != nil {
+		return false, err
+	}
+	w.modTimes = modTimes
+	return true, nil
+}
+
+// Watch вызывает Reload с интервалом interval до отмены контекста и передает ошибки в onError
+func (w *Watcher) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
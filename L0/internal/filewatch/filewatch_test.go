@@ -0,0 +1,90 @@
+package filewatch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// touch создает файл и выставляет время изменения
+func touch(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	errLoad := errors.New("parse failed")
+	start := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		touched     int   // Номер файла, время изменения которого сдвигается; -1 — без изменений
+		loadErr     error // Ошибка второй загрузки
+		wantChanged bool
+		wantLoads   int // Вызовы load, включая первую загрузку
+	}{
+		{name: "unchanged files are not reloaded", touched: -1, wantLoads: 1},
+		{name: "change of any file reloads", touched: 1, wantChanged: true, wantLoads: 2},
+		{name: "failed load keeps previous state", touched: 0, loadErr: errLoad, wantLoads: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+			for _, path := range files {
+				touch(t, path, start)
+			}
+
+			loads := 0
+			var loadErr error
+			w := New(func() error { loads++; return loadErr }, files...)
+			if changed, err := w.Reload(); err != nil || !changed {
+				t.Fatalf("first Reload() = %v, %v; want true, nil", changed, err)
+			}
+
+			if tt.touched >= 0 {
+				touch(t, files[tt.touched], start.Add(time.Minute))
+			}
+			loadErr = tt.loadErr
+			changed, err := w.Reload()
+			if !errors.Is(err, tt.loadErr) {
+				t.Fatalf("Reload() error = %v, want %v", err, tt.loadErr)
+			}
+			if changed != tt.wantChanged || loads != tt.wantLoads {
+				t.Errorf("changed = %v, loads = %d; want %v, %d", changed, loads, tt.wantChanged, tt.wantLoads)
+			}
+		})
+	}
+}
+
+func TestWatcherRetriesFailedLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a")
+	touch(t, path, time.Now().Add(-time.Hour))
+
+	loadErr := errors.New("parse failed")
+	w := New(func() error { return loadErr }, path)
+	if _, err := w.Reload(); err == nil {
+		t.Fatal("Reload() error = nil, want load error")
+	}
+
+	// Время файла не менялось, но после неудачной загрузки он перечитывается
+	loadErr = nil
+	if changed, err := w.Reload(); err != nil || !changed {
+		t.Errorf("Reload() = %v, %v; want true, nil", changed, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if _, err := w.Reload(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Reload() of a removed file error = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -2,30 +2,38 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"order-service/internal/cache"
-	"order-service/internal/database"
 	"order-service/internal/models"
+	"order-service/internal/redact"
+	"order-service/internal/repository"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // OrderHandler обрабатывает HTTP запросы для заказов
 type OrderHandler struct {
-	db    *database.DB
-	cache *cache.Cache
+	repo     repository.OrderRepository
+	cache    *cache.Cache
+	redactor *redact.Redactor // Маскирует персональные данные в ответах по роли вызывающей стороны
 }
 
 // NewOrderHandler создает новый handler для заказов
-func NewOrderHandler(db *database.DB, cache *cache.Cache) *OrderHandler {
+func NewOrderHandler(repo repository.OrderRepository, cache *cache.Cache, redactor *redact.Redactor) *OrderHandler {
 	return &OrderHandler{
-		db:    db,
-		cache: cache,
+		repo:     repo,
+		cache:    cache,
+		redactor: redactor,
 	}
 }
 
-// GetOrder возвращает заказ по UID
+// GetOrder возвращает заказ по UID. Отмененный заказ возвращается с cancelled_at и cancel_reason,
+// на удаленный заказ (журнал ревизий есть, а заказа нет) отвечает 410 Gone.
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderUID := vars["order_uid"]
@@ -39,16 +47,16 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	order, found := h.cache.Get(orderUID)
 	if found {
 		log.Printf("level=info component=http_handler route=get_order source=cache event=hit order_uid=%q", orderUID)
-		h.writeJSONResponse(w, order)
+		h.writeOrder(w, r, order)
 		return
 	}
 
 	// Если в кеше нет, ищем в базе данных
 	log.Printf("level=info component=http_handler route=get_order source=cache event=miss order_uid=%q", orderUID)
-	order, err := h.db.GetOrder(orderUID)
+	order, err := h.repo.GetOrder(orderUID)
 	if err != nil {
 		if err == models.ErrOrderNotFound {
-			http.Error(w, "Order not found", http.StatusNotFound)
+			h.writeOrderNotFound(w, "get_order", orderUID)
 			return
 		}
 		log.Printf("level=error component=http_handler route=get_order event=db_error order_uid=%q err=%v", orderUID, err)
@@ -60,14 +68,350 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	h.cache.Set(orderUID, order)
 	log.Printf("level=info component=http_handler route=get_order source=db event=cached order_uid=%q", orderUID)
 
-	h.writeJSONResponse(w, order)
+	h.writeOrder(w, r, order)
+}
+
+// writeOrder отвечает заказом, замаскированным по роли вызывающей стороны.
+// Заказ из кеша не изменяется: маскируется его копия.
+func (h *OrderHandler) writeOrder(w http.ResponseWriter, r *http.Request, order *models.Order) {
+	h.writeJSONResponse(w, h.redactor.Order(order, h.redactor.ForRequest(r.Context())))
+}
+
+// writeOrderNotFound отвечает 410 Gone, если заказ был удален, и 404 — если его не было
+func (h *OrderHandler) writeOrderNotFound(w http.ResponseWriter, route, orderUID string) {
+	revisions, err := h.repo.GetOrderRevisions(orderUID)
+	if err != nil {
+		log.Printf("level=error component=http_handler route=%s event=db_error order_uid=%q err=%v", route, orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) > 0 {
+		log.Printf("level=info component=http_handler route=%s event=gone order_uid=%q", route, orderUID)
+		http.Error(w, "Order has been deleted", http.StatusGone)
+		return
+	}
+	http.Error(w, "Order not found", http.StatusNotFound)
+}
+
+// GetOrderByTrackNumber возвращает заказ по трек-номеру
+func (h *OrderHandler) GetOrderByTrackNumber(w http.ResponseWriter, r *http.Request) {
+	h.lookupOrder(w, r, "get_order_by_track", "track_number", mux.Vars(r)["track_number"], h.repo.FindOrderUIDByTrackNumber)
+}
+
+// GetOrderByTransaction возвращает заказ по транзакции оплаты
+func (h *OrderHandler) GetOrderByTransaction(w http.ResponseWriter, r *http.Request) {
+	h.lookupOrder(w, r, "get_order_by_transaction", "transaction", mux.Vars(r)["transaction"], h.repo.FindOrderUIDByTransaction)
+}
+
+// lookupOrder находит UID заказа по вторичному ключу в базе данных, а сам заказ берет из кеша.
+// Ключ может быть у нескольких заказов, и какой из них последний, знает только база данных:
+// в кеше может не оказаться более нового заказа с тем же ключом.
+func (h *OrderHandler) lookupOrder(w http.ResponseWriter, r *http.Request, route, keyName, key string,
+	findUID func(string) (string, error)) {
+	if key == "" {
+		http.Error(w, fmt.Sprintf("Parameter %s is required", keyName), http.StatusBadRequest)
+		return
+	}
+
+	// Транзакция оплаты попадает в лог только в замаскированном виде
+	logKey := key
+	if keyName == "transaction" {
+		logKey = h.redactor.String("payment.transaction", key, h.redactor.ForLog(redact.LevelInfo))
+	}
+
+	orderUID, err := findUID(key)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("level=error component=http_handler route=%s event=db_error %s=%q err=%v", route, keyName, logKey, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if order, found := h.cache.Get(orderUID); found {
+		log.Printf("level=info component=http_handler route=%s source=cache event=hit %s=%q order_uid=%q", route, keyName, logKey, orderUID)
+		h.writeOrder(w, r, order)
+		return
+	}
+
+	log.Printf("level=info component=http_handler route=%s source=cache event=miss %s=%q order_uid=%q", route, keyName, logKey, orderUID)
+	order, err := h.repo.GetOrder(orderUID)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			// Заказ удален между поиском UID и чтением
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("level=error component=http_handler route=%s event=db_error %s=%q order_uid=%q err=%v", route, keyName, logKey, orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.cache.Set(orderUID, order)
+	log.Printf("level=info component=http_handler route=%s source=db event=cached %s=%q order_uid=%q", route, keyName, logKey, orderUID)
+
+	h.writeOrder(w, r, order)
+}
+
+// ListOrders возвращает страницу заказов с фильтрами и курсорной пагинацией.
+// Параметр view=summary возвращает краткое представление вместо полных заказов.
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var page interface{}
+	var next *models.Cursor
+	switch view := r.URL.Query().Get("view"); view {
+	case "", "full":
+		var orders []*models.Order
+		orders, next, err = h.repo.ListOrders(filter)
+		page = h.redactor.Orders(orders, h.redactor.ForRequest(r.Context()))
+	case "summary":
+		page, next, err = h.repo.ListOrderSummaries(filter)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown view %q", view), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("level=error component=http_handler route=list_orders event=db_error err=%v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"orders":      page,
+		"next_cursor": nil,
+	}
+	if next != nil {
+		response["next_cursor"] = next.Encode()
+	}
+
+	h.writeJSONResponse(w, response)
+}
+
+// parseOrderFilter разбирает параметры запроса списка заказов
+func parseOrderFilter(r *http.Request) (models.OrderFilter, error) {
+	query := r.URL.Query()
+	filter := models.OrderFilter{
+		CustomerID:      query.Get("customer_id"),
+		TrackNumber:     query.Get("track_number"),
+		DeliveryService: query.Get("delivery_service"),
+		Currency:        query.Get("currency"),
+		Provider:        query.Get("provider"),
+		Brand:           query.Get("brand"),
+	}
+
+	var err error
+	if v := query.Get("date_from"); v != "" {
+		if filter.DateFrom, err = parseDate(v); err != nil {
+			return filter, fmt.Errorf("invalid date_from: %w", err)
+		}
+	}
+	if v := query.Get("date_to"); v != "" {
+		if filter.DateTo, err = parseDate(v); err != nil {
+			return filter, fmt.Errorf("invalid date_to: %w", err)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		filter.Limit, err = strconv.Atoi(v)
+		if err != nil || filter.Limit < 1 || filter.Limit > models.MaxListLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", models.MaxListLimit)
+		}
+	}
+	if v := query.Get("cursor"); v != "" {
+		if filter.Cursor, err = models.DecodeCursor(v); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+// parseDate принимает дату в формате RFC3339 или YYYY-MM-DD
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// GetOrderHistory возвращает журнал ревизий заказа.
+// С параметрами from и to возвращает разницу между двумя ревизиями.
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+	if orderUID == "" {
+		http.Error(w, "Order UID is required", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("from") || query.Has("to") {
+		h.getRevisionDiff(w, r, orderUID, query.Get("from"), query.Get("to"))
+		return
+	}
+
+	revisions, err := h.repo.GetOrderRevisions(orderUID)
+	if err != nil {
+		log.Printf("level=error component=http_handler route=get_order_history event=db_error order_uid=%q err=%v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		http.Error(w, "Order history not found", http.StatusNotFound)
+		return
+	}
+
+	// Снимки заказа в ревизиях маскируются так же, как текущий заказ
+	mode := h.redactor.ForRequest(r.Context())
+	for i, rev := range revisions {
+		masked, err := h.redactor.JSON(rev.Order, mode)
+		if err != nil {
+			log.Printf("level=error component=http_handler route=get_order_history event=redact_error order_uid=%q revision=%d err=%v", orderUID, rev.Revision, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		c := *rev
+		c.Order = masked
+		revisions[i] = &c
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"order_uid": orderUID,
+		"revisions": revisions,
+	})
+}
+
+// getRevisionDiff возвращает разницу между ревизиями from и to
+func (h *OrderHandler) getRevisionDiff(w http.ResponseWriter, r *http.Request, orderUID, fromParam, toParam string) {
+	from, err := strconv.Atoi(fromParam)
+	if err != nil || from < 1 {
+		http.Error(w, "Parameter from must be a positive revision number", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(toParam)
+	if err != nil || to < 1 {
+		http.Error(w, "Parameter to must be a positive revision number", http.StatusBadRequest)
+		return
+	}
+
+	revisions := make([]*models.Revision, 0, 2)
+	for _, number := range []int{from, to} {
+		rev, err := h.repo.GetOrderRevision(orderUID, number)
+		if err != nil {
+			if errors.Is(err, models.ErrRevisionNotFound) {
+				http.Error(w, fmt.Sprintf("Revision %d not found", number), http.StatusNotFound)
+				return
+			}
+			log.Printf("level=error component=http_handler route=get_order_history event=db_error order_uid=%q revision=%d err=%v", orderUID, number, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	diff, err := models.DiffRevisions(revisions[0], revisions[1])
+	if err != nil {
+		log.Printf("level=error component=http_handler route=get_order_history event=diff_error order_uid=%q err=%v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	mode := h.redactor.ForRequest(r.Context())
+	for i := range diff.Changes {
+		c := &diff.Changes[i]
+		c.Old = h.redactor.Value(c.Path, c.Old, mode)
+		c.New = h.redactor.Value(c.Path, c.New, mode)
+	}
+
+	h.writeJSONResponse(w, diff)
+}
+
+// statusView — этап с кодом и названием
+type statusView struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+}
+
+func viewStatus(s models.Status) statusView {
+	return statusView{Code: int(s), Name: s.String()}
+}
+
+// GetOrderStatus возвращает текущие этапы заказа и товаров и журнал переходов между этапами
+func (h *OrderHandler) GetOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+	if orderUID == "" {
+		http.Error(w, "Order UID is required", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.repo.GetOrder(orderUID)
+	if err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			h.writeOrderNotFound(w, "get_order_status", orderUID)
+			return
+		}
+		log.Printf("level=error component=http_handler route=get_order_status event=db_error order_uid=%q err=%v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	transitions, err := h.repo.GetOrderTransitions(orderUID)
+	if err != nil {
+		log.Printf("level=error component=http_handler route=get_order_status event=db_error order_uid=%q err=%v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	type itemStatus struct {
+		Rid    string     `json:"rid"`
+		Status statusView `json:"status"`
+	}
+	type transition struct {
+		Rid    string         `json:"rid,omitempty"`
+		From   *statusView    `json:"from,omitempty"` // Нет для первого этапа
+		To     statusView     `json:"to"`
+		At     time.Time      `json:"at"`
+		Source *models.Source `json:"source,omitempty"`
+	}
+
+	items := make([]itemStatus, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, itemStatus{Rid: item.Rid, Status: viewStatus(item.Status)})
+	}
+	history := make([]transition, 0, len(transitions))
+	for _, t := range transitions {
+		view := transition{Rid: t.Rid, To: viewStatus(t.To), At: t.At, Source: t.Source}
+		if t.From != models.StatusUnknown {
+			from := viewStatus(t.From)
+			view.From = &from
+		}
+		history = append(history, view)
+	}
+
+	h.writeJSONResponse(w, map[string]interface{}{
+		"order_uid":   orderUID,
+		"status":      viewStatus(order.Status),
+		"items":       items,
+		"transitions": history,
+	})
 }
 
 // GetCacheStats возвращает статистику кеша (для отладки)
 func (h *OrderHandler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	cacheStats := h.cache.Stats()
 	stats := map[string]interface{}{
-		"cache_size": h.cache.Size(),
-		"orders":     []string{},
+		"cache_size":  cacheStats.Size,
+		"cache_bytes": cacheStats.Bytes,
+		"hits":        cacheStats.Hits,
+		"misses":      cacheStats.Misses,
+		"evictions":   cacheStats.Evictions,
+		"expirations": cacheStats.Expirations,
+		"orders":      []string{},
 	}
 
 	// Получаем список всех заказов в кеше
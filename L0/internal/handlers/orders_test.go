@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"order-service/internal/auth"
+	"order-service/internal/cache"
+	"order-service/internal/models"
+	"order-service/internal/redact"
+	"order-service/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// testOrder возвращает корректный заказ с одним товаром
+func testOrder(uid, track, customer string) *models.Order {
+	return &models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "tx-" + uid,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{{
+			ChrtID:      9934930,
+			TrackNumber: track,
+			Price:       453,
+			Rid:         "rid-" + uid,
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      models.StatusCreated,
+		}},
+		Locale:          "en",
+		CustomerID:      customer,
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+}
+
+// newTestServer собирает маршруты заказов, как в cmd/main.go, поверх in-memory хранилища.
+// Маскирование отключено, чтобы ответы совпадали с сохраненными заказами.
+func newTestServer(t *testing.T) (*mux.Router, *repository.Memory, *cache.Cache) {
+	t.Helper()
+
+	repo := repository.NewMemory()
+	orderCache := cache.New(cache.DefaultConfig())
+	policy := redact.DefaultPolicy()
+	policy.Reader = redact.ModeNone
+	redactor, err := redact.New(policy)
+	if err != nil {
+		t.Fatalf("redact.New: %v", err)
+	}
+	h := NewOrderHandler(repo, orderCache, redactor)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/orders", h.ListOrders).Methods("GET")
+	router.HandleFunc("/order/{order_uid}", h.GetOrder).Methods("GET")
+	router.HandleFunc("/order/{order_uid}/history", h.GetOrderHistory).Methods("GET")
+	router.HandleFunc("/order/{order_uid}/status", h.GetOrderStatus).Methods("GET")
+	router.HandleFunc("/track/{track_number}", h.GetOrderByTrackNumber).Methods("GET")
+	router.HandleFunc("/payment/{transaction}", h.GetOrderByTransaction).Methods("GET")
+	return router, repo, orderCache
+}
+
+func get(t *testing.T, router http.Handler, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestOrderLookups(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, repo *repository.Memory, c *cache.Cache)
+		url        string
+		wantStatus int
+		wantUID    string
+	}{
+		{
+			name:       "order from storage",
+			url:        "/order/o1",
+			wantStatus: http.StatusOK,
+			wantUID:    "o1",
+		},
+		{
+			name: "order from cache only",
+			setup: func(t *testing.T, repo *repository.Memory, c *cache.Cache) {
+				c.Set("cached", testOrder("cached", "TRACK-C", "c"))
+			},
+			url:        "/order/cached",
+			wantStatus: http.StatusOK,
+			wantUID:    "cached",
+		},
+		{
+			name:       "unknown order",
+			url:        "/order/missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "deleted order",
+			setup: func(t *testing.T, repo *repository.Memory, c *cache.Cache) {
+				if err := repo.DeleteOrder("o1", nil); err != nil {
+					t.Fatalf("DeleteOrder: %v", err)
+				}
+			},
+			url:        "/order/o1",
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:       "by track number",
+			url:        "/track/TRACK-2",
+			wantStatus: http.StatusOK,
+			wantUID:    "o2",
+		},
+		{
+			name: "shared track number resolves to the latest order in storage",
+			setup: func(t *testing.T, repo *repository.Memory, c *cache.Cache) {
+				if err := repo.SaveOrder(testOrder("o3", "TRACK-2", "carol"), nil); err != nil {
+					t.Fatalf("SaveOrder: %v", err)
+				}
+				// В кеше только более старый заказ с тем же трек-номером
+				c.Set("o2", testOrder("o2", "TRACK-2", "bob"))
+			},
+			url:        "/track/TRACK-2",
+			wantStatus: http.StatusOK,
+			wantUID:    "o3",
+		},
+		{
+			name:       "unknown track number",
+			url:        "/track/TRACK-X",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "by payment transaction",
+			url:        "/payment/tx-o1",
+			wantStatus: http.StatusOK,
+			wantUID:    "o1",
+		},
+		{
+			name:       "unknown transaction",
+			url:        "/payment/tx-missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "status of a deleted order",
+			setup:      func(t *testing.T, repo *repository.Memory, c *cache.Cache) { _ = repo.DeleteOrder("o2", nil) },
+			url:        "/order/o2/status",
+			wantStatus: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, repo, c := newTestServer(t)
+			for _, o := range []*models.Order{testOrder("o1", "TRACK-1", "alice"), testOrder("o2", "TRACK-2", "bob")} {
+				if err := repo.SaveOrder(o, nil); err != nil {
+					t.Fatalf("SaveOrder: %v", err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(t, repo, c)
+			}
+
+			w := get(t, router, tt.url)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantUID == "" {
+				return
+			}
+			var got models.Order
+			decode(t, w, &got)
+			if got.OrderUID != tt.wantUID {
+				t.Errorf("order_uid = %q, want %q", got.OrderUID, tt.wantUID)
+			}
+			if got.Delivery.Phone != "+9720000000" {
+				t.Errorf("delivery.phone = %q, want the stored value", got.Delivery.Phone)
+			}
+		})
+	}
+}
+
+func TestGetOrderCachesStorageHit(t *testing.T) {
+	router, repo, c := newTestServer(t)
+	if err := repo.SaveOrder(testOrder("o1", "TRACK-1", "alice"), nil); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+
+	if w := get(t, router, "/order/o1"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if _, found := c.Get("o1"); !found {
+		t.Fatal("order was not cached after a storage hit")
+	}
+
+	// Следующий запрос обслуживается кешем, даже если заказа уже нет в хранилище
+	if err := repo.DeleteOrder("o1", nil); err != nil {
+		t.Fatalf("DeleteOrder: %v", err)
+	}
+	if w := get(t, router, "/order/o1"); w.Code != http.StatusOK {
+		t.Errorf("cached order: status = %d, want 200", w.Code)
+	}
+}
+
+func TestLookupTakesOrderFromCacheByUID(t *testing.T) {
+	router, repo, c := newTestServer(t)
+	if err := repo.SaveOrder(testOrder("o1", "TRACK-1", "alice"), nil); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+
+	if w := get(t, router, "/track/TRACK-1"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if _, found := c.Get("o1"); !found {
+		t.Fatal("order was not cached after a storage hit")
+	}
+
+	// UID по-прежнему ищется в хранилище, а заказ берется из кеша
+	cached := testOrder("o1", "TRACK-1", "alice")
+	cached.Entry = "CACHED"
+	c.Set("o1", cached)
+	for _, url := range []string{"/track/TRACK-1", "/payment/tx-o1"} {
+		w := get(t, router, url)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", url, w.Code)
+		}
+		var got models.Order
+		decode(t, w, &got)
+		if got.Entry != "CACHED" {
+			t.Errorf("%s: entry = %q, want the cached order", url, got.Entry)
+		}
+	}
+}
+
+func TestListOrders(t *testing.T) {
+	router, repo, _ := newTestServer(t)
+	for _, o := range []*models.Order{
+		testOrder("o1", "TRACK-1", "alice"),
+		testOrder("o2", "TRACK-2", "bob"),
+		testOrder("o3", "TRACK-3", "alice"),
+	} {
+		if err := repo.SaveOrder(o, nil); err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+	}
+
+	type page struct {
+		Orders []struct {
+			OrderUID   string `json:"order_uid"`
+			CustomerID string `json:"customer_id"`
+			ItemsCount int    `json:"items_count"`
+		} `json:"orders"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantCount  int
+		wantNext   bool
+	}{
+		{name: "all orders", url: "/orders", wantStatus: http.StatusOK, wantCount: 3},
+		{name: "filter by customer", url: "/orders?customer_id=alice", wantStatus: http.StatusOK, wantCount: 2},
+		{name: "first page", url: "/orders?limit=2", wantStatus: http.StatusOK, wantCount: 2, wantNext: true},
+		{name: "summary view", url: "/orders?view=summary&track_number=TRACK-2", wantStatus: http.StatusOK, wantCount: 1},
+		{name: "no matches", url: "/orders?currency=EUR", wantStatus: http.StatusOK, wantCount: 0},
+		{name: "limit out of range", url: "/orders?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "invalid date", url: "/orders?date_from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "invalid cursor", url: "/orders?cursor=bogus", wantStatus: http.StatusBadRequest},
+		{name: "unknown view", url: "/orders?view=compact", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(t, router, tt.url)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var p page
+			decode(t, w, &p)
+			if len(p.Orders) != tt.wantCount {
+				t.Errorf("orders = %d, want %d", len(p.Orders), tt.wantCount)
+			}
+			if (p.NextCursor != nil) != tt.wantNext {
+				t.Errorf("next_cursor = %v, want present %v", p.NextCursor, tt.wantNext)
+			}
+		})
+	}
+
+	t.Run("pages do not overlap", func(t *testing.T) {
+		var first, second page
+		decode(t, get(t, router, "/orders?limit=2"), &first)
+		if first.NextCursor == nil {
+			t.Fatal("first page has no next_cursor")
+		}
+		decode(t, get(t, router, "/orders?limit=2&cursor="+*first.NextCursor), &second)
+
+		seen := make(map[string]bool)
+		for _, o := range append(first.Orders, second.Orders...) {
+			if seen[o.OrderUID] {
+				t.Errorf("order %s returned twice", o.OrderUID)
+			}
+			seen[o.OrderUID] = true
+		}
+		if len(seen) != 3 || second.NextCursor != nil {
+			t.Errorf("got %d orders over two pages (next_cursor %v), want 3 and no further page", len(seen), second.NextCursor)
+		}
+	})
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	router, repo, _ := newTestServer(t)
+	o := testOrder("o1", "TRACK-1", "alice")
+	if err := repo.SaveOrder(o, nil); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	updated := testOrder("o1", "TRACK-1", "alice")
+	updated.Delivery.City = "Haifa"
+	if err := repo.SaveOrder(updated, nil); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{name: "revisions", url: "/order/o1/history", wantStatus: http.StatusOK},
+		{name: "diff", url: "/order/o1/history?from=1&to=2", wantStatus: http.StatusOK},
+		{name: "unknown revision", url: "/order/o1/history?from=1&to=9", wantStatus: http.StatusNotFound},
+		{name: "invalid revision", url: "/order/o1/history?from=0&to=2", wantStatus: http.StatusBadRequest},
+		{name: "unknown order", url: "/order/missing/history", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := get(t, router, tt.url); w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %q", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	var history struct {
+		Revisions []models.Revision `json:"revisions"`
+	}
+	decode(t, get(t, router, "/order/o1/history"), &history)
+	if len(history.Revisions) != 2 {
+		t.Fatalf("revisions = %d, want 2", len(history.Revisions))
+	}
+
+	var diff models.RevisionDiff
+	decode(t, get(t, router, "/order/o1/history?from=1&to=2"), &diff)
+	if len(diff.Changes) != 1 || diff.Changes[0].Path != "delivery.city" || diff.Changes[0].New != "Haifa" {
+		t.Errorf("changes = %+v, want a single delivery.city change to Haifa", diff.Changes)
+	}
+}
+
+func TestGetOrderRedactedForAnonymous(t *testing.T) {
+	repo := repository.NewMemory()
+	if err := repo.SaveOrder(testOrder("o1", "TRACK-1", "alice"), nil); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	h := NewOrderHandler(repo, cache.New(cache.DefaultConfig()), redact.Default())
+	authn, err := auth.New(auth.Config{})
+	if err != nil {
+		t.Fatalf("auth.New: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Handle("/order/{order_uid}", authn.Require(auth.RoleReader)(http.HandlerFunc(h.GetOrder))).Methods("GET")
+
+	// Аутентификация выключена: запрос анонимный и получает маскирование роли reader
+	w := get(t, router, "/order/o1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var got models.Order
+	decode(t, w, &got)
+	if got.Delivery.Phone != "***0000" || got.Payment.Transaction != redact.Mask {
+		t.Errorf("phone = %q, transaction = %q; want masked values", got.Delivery.Phone, got.Payment.Transaction)
+	}
+}
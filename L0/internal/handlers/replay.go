@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"order-service/internal/kafka"
+	"sync"
+	"time"
+)
+
+// Состояния задачи повторного чтения
+const (
+	ReplayRunning   = "running"
+	ReplayDone      = "done"
+	ReplayFailed    = "failed"
+	ReplayCancelled = "cancelled"
+)
+
+// ReplayHandler запускает повторное чтение топика в фоне и показывает его состояние.
+// Одновременно выполняется одна задача; сохраняется только последняя.
+type ReplayHandler struct {
+	replayer *kafka.Replayer
+	ctx      context.Context // Отменяется при остановке сервиса
+
+	mu     sync.Mutex
+	job    *replayJob
+	nextID int
+}
+
+// replayJob — задача повторного чтения
+type replayJob struct {
+	ID         int                 `json:"id"`
+	State      string              `json:"state"`
+	Request    kafka.ReplayRequest `json:"request"`
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt *time.Time          `json:"finished_at,omitempty"`
+	Result     *kafka.ReplayResult `json:"result,omitempty"`
+	Error      string              `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// NewReplayHandler создает handler; задачи отменяются вместе с ctx
+func NewReplayHandler(ctx context.Context, replayer *kafka.Replayer) *ReplayHandler {
+	return &ReplayHandler{replayer: replayer, ctx: ctx}
+}
+
+// StartReplay запускает повторное чтение по JSON телу запроса (kafka.ReplayRequest)
+func (h *ReplayHandler) StartReplay(w http.ResponseWriter, r *http.Request) {
+	var req kafka.ReplayRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	if h.job != nil && h.job.State == ReplayRunning {
+		h.mu.Unlock()
+		http.Error(w, kafka.ErrReplayRunning.Error(), http.StatusConflict)
+		return
+	}
+	ctx, cancel := context.WithCancel(h.ctx)
+	h.nextID++
+	job := &replayJob{
+		ID:        h.nextID,
+		State:     ReplayRunning,
+		Request:   req,
+		StartedAt: time.Now().UTC(),
+		cancel:    cancel,
+	}
+	h.job = job
+	snapshot := *job
+	h.mu.Unlock()
+
+	log.Printf("level=info component=http_handler route=replay event=start job=%d dry_run=%t overwrite=%t", job.ID, req.DryRun, req.Overwrite)
+	go h.run(ctx, job)
+
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// run выполняет задачу и сохраняет ее итог
+func (h *ReplayHandler) run(ctx context.Context, job *replayJob) {
+	defer job.cancel()
+
+	result, err := h.replayer.Replay(ctx, job.Request)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	job.Result = result
+	switch {
+	case err == nil:
+		job.State = ReplayDone
+	case ctx.Err() != nil:
+		job.State = ReplayCancelled
+	default:
+		job.State = ReplayFailed
+		job.Error = err.Error()
+	}
+
+	log.Printf("level=info component=http_handler route=replay event=finished job=%d state=%s err=%q", job.ID, job.State, job.Error)
+}
+
+// GetReplay возвращает состояние текущей или последней задачи
+func (h *ReplayHandler) GetReplay(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.job == nil {
+		h.mu.Unlock()
+		http.Error(w, "No replay has been started", http.StatusNotFound)
+		return
+	}
+	snapshot := *h.job
+	h.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// CancelReplay отменяет выполняющуюся задачу
+func (h *ReplayHandler) CancelReplay(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.job == nil || h.job.State != ReplayRunning {
+		h.mu.Unlock()
+		http.Error(w, "No replay is running", http.StatusNotFound)
+		return
+	}
+	h.job.cancel()
+	snapshot := *h.job
+	h.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// writeJSON записывает JSON ответ с указанным статусом
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("level=error component=http_handler event=json_encode_error err=%v", err)
+	}
+}
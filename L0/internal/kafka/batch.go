@@ -0,0 +1,250 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"order-service/internal/metrics"
+	"order-service/internal/repository"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BatchConfig задает пакетный режим consumer: сообщения копятся, пока их не станет Size
+// или не пройдет Wait с момента получения первого, и сохраняются одной транзакцией.
+// Size <= 1 отключает пакетный режим.
+type BatchConfig struct {
+	Size int
+	Wait time.Duration
+}
+
+// DefaultBatchConfig возвращает конфигурацию с выключенным пакетным режимом
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		Size: 1,
+		Wait: 100 * time.Millisecond,
+	}
+}
+
+// Validate проверяет корректность конфигурации
+func (b BatchConfig) Validate() error {
+	if b.Size < 0 {
+		return errors.New("batch size must not be negative")
+	}
+	if b.enabled() && b.Wait <= 0 {
+		return errors.New("batch wait must be positive when batching is enabled")
+	}
+	return nil
+}
+
+func (b BatchConfig) enabled() bool {
+	return b.Size > 1
+}
+
+// SetBatch включает пакетный режим; вызывается до Start
+func (c *Consumer) SetBatch(cfg BatchConfig) {
+	c.batch = cfg
+}
+
+// runBatches — цикл потребления в пакетном режиме
+func (c *Consumer) runBatches(ctx context.Context) error {
+	log.Printf("component=kafka_consumer event=batch_mode size=%d wait=%s", c.batch.Size, c.batch.Wait)
+
+	for {
+		msgs, err := c.collect(ctx)
+		if err != nil {
+			log.Println("component=kafka_consumer event=stop msg=\"stopping consumer\"")
+			return nil
+		}
+
+		if err := c.handleBatch(ctx, msgs); err != nil {
+			return err
+		}
+	}
+}
+
+// collect ждет первое сообщение, затем добирает пакет до Size сообщений,
+// пока не истечет Wait. Ошибка возвращается только при отмене контекста до первого сообщения.
+func (c *Consumer) collect(ctx context.Context) ([]kafka.Message, error) {
+	first, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]kafka.Message, 1, c.batch.Size)
+	msgs[0] = first
+
+	fetchCtx, cancel := context.WithTimeout(ctx, c.batch.Wait)
+	defer cancel()
+
+	for len(msgs) < c.batch.Size {
+		msg, err := c.fetch(fetchCtx)
+		if err != nil {
+			break // Истекло время ожидания пакета
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+// handleBatch обрабатывает пакет и коммитит наибольшее обработанное смещение каждой партиции
+func (c *Consumer) handleBatch(ctx context.Context, msgs []kafka.Message) error {
+	done, err := c.executeBatch(ctx, msgs)
+
+	if cerr := c.commitBatch(ctx, msgs, done); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("level=info component=kafka_consumer event=stop_uncommitted size=%d msg=\"context cancelled before batch was processed\"", len(msgs))
+			return nil
+		}
+		log.Printf("level=error component=kafka_consumer event=halted size=%d err=%v", len(msgs), err)
+		return err
+	}
+
+	return nil
+}
+
+// executeBatch обрабатывает пакет и возвращает отметки обработанных сообщений.
+// Если пакет не удалось сохранить, сообщения обрабатываются по одному,
+// чтобы изолировать сообщение, из-за которого упала транзакция.
+func (c *Consumer) executeBatch(ctx context.Context, msgs []kafka.Message) ([]bool, error) {
+	defer func(start time.Time) {
+		metrics.ConsumerBatchDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+	metrics.ConsumerBatchSize.Observe(float64(len(msgs)))
+
+	done := make([]bool, len(msgs))
+
+	err := c.processBatch(ctx, msgs, done)
+	if err != nil && ctx.Err() == nil {
+		metrics.ConsumerBatchFallbacks.Inc()
+		log.Printf("level=warn component=kafka_consumer event=batch_fallback size=%d err=%v", len(msgs), err)
+		err = c.handleEach(ctx, msgs, done)
+	}
+
+	return done, err
+}
+
+// rejectedMessage — сообщение пакета, не прошедшее разбор или валидацию
+type rejectedMessage struct {
+	index  int
+	reason string
+	err    error
+}
+
+// processBatch сохраняет валидные заказы пакета одной транзакцией
+// и отправляет отклоненные сообщения в dead-letter топик.
+// События отмены и удаления делят пакет: заказы, полученные до события,
+// сохраняются перед ним, чтобы событие применилось в порядке сообщений.
+// Обработанные сообщения отмечаются в done.
+func (c *Consumer) processBatch(ctx context.Context, msgs []kafka.Message, done []bool) error {
+	start := 0
+	for i, msg := range msgs {
+		event := messageEvent(msg)
+		if isOrderWrite(event) {
+			continue
+		}
+
+		if err := c.processSegment(ctx, msgs, start, i, done); err != nil {
+			return err
+		}
+		c.logMessage(msg)
+		if err := c.processEvent(ctx, msg, event); err != nil {
+			return err
+		}
+		done[i] = true
+		start = i + 1
+	}
+
+	return c.processSegment(ctx, msgs, start, len(msgs), done)
+}
+
+// processSegment сохраняет заказы из msgs[from:to] одной транзакцией
+func (c *Consumer) processSegment(ctx context.Context, msgs []kafka.Message, from, to int, done []bool) error {
+	writes := make([]repository.OrderWrite, 0, to-from)
+	indexes := make([]int, 0, to-from)
+	var rejected []rejectedMessage
+
+	for i := from; i < to; i++ {
+		msg := msgs[i]
+		c.logMessage(msg)
+
+		order, reason, err := c.decode(msg)
+		if err != nil {
+			rejected = append(rejected, rejectedMessage{index: i, reason: reason, err: err})
+			continue
+		}
+		writes = append(writes, repository.OrderWrite{Order: order, Source: c.messageSource(msg)})
+		indexes = append(indexes, i)
+	}
+
+	// Отклоненные сообщения публикуются до сохранения пакета: транзакция пакета
+	// может сдвинуть сохраненное смещение партиции дальше них
+	for _, r := range rejected {
+		if err := c.deadLetter(ctx, msgs[r.index], r.reason, r.err); err != nil {
+			return err
+		}
+		done[r.index] = true
+	}
+
+	if len(writes) > 0 {
+		if err := c.repo.SaveOrders(writes); err != nil {
+			return fmt.Errorf("failed to save batch: %w", err)
+		}
+		for j, w := range writes {
+			c.processed(msgs[indexes[j]], w.Order)
+			done[indexes[j]] = true
+		}
+	}
+
+	return nil
+}
+
+// handleEach обрабатывает еще не обработанные сообщения пакета по одному с повторами
+func (c *Consumer) handleEach(ctx context.Context, msgs []kafka.Message, done []bool) error {
+	for i, msg := range msgs {
+		if done[i] {
+			continue
+		}
+		if err := c.handleMessage(ctx, msg); err != nil {
+			return err
+		}
+		done[i] = true
+	}
+	return nil
+}
+
+// commitBatch коммитит для каждой партиции наибольшее смещение, до которого
+// все сообщения пакета обработаны. Сообщения одной партиции идут в пакете по возрастанию смещений.
+func (c *Consumer) commitBatch(ctx context.Context, msgs []kafka.Message, done []bool) error {
+	last := make(map[int]kafka.Message)
+	blocked := make(map[int]bool)
+	for i, msg := range msgs {
+		if blocked[msg.Partition] {
+			continue
+		}
+		if !done[i] {
+			blocked[msg.Partition] = true
+			continue
+		}
+		last[msg.Partition] = msg
+	}
+	if len(last) == 0 {
+		return nil
+	}
+
+	commits := make([]kafka.Message, 0, len(last))
+	for _, msg := range last {
+		commits = append(commits, msg)
+	}
+	sort.Slice(commits, func(i, j int) bool { return commits[i].Partition < commits[j].Partition })
+
+	return c.commit(ctx, commits...)
+}
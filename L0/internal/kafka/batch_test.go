@@ -0,0 +1,230 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/cache"
+	"order-service/internal/kafka/kafkatest"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// batchRepo — in-memory хранилище, которое запоминает UID заказов каждого вызова SaveOrders.
+// Заказы из fail не сохраняются ни по одному, ни в составе пакета.
+type batchRepo struct {
+	*repository.Memory
+	fail map[string]bool
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (r *batchRepo) SaveOrder(order *models.Order, source *models.Source) error {
+	if r.fail[order.OrderUID] {
+		return errors.New("constraint violation")
+	}
+	return r.Memory.SaveOrder(order, source)
+}
+
+func (r *batchRepo) SaveOrders(writes []repository.OrderWrite) error {
+	uids := make([]string, 0, len(writes))
+	for _, w := range writes {
+		uids = append(uids, w.Order.OrderUID)
+	}
+	r.mu.Lock()
+	r.batches = append(r.batches, uids)
+	r.mu.Unlock()
+
+	for _, w := range writes {
+		if r.fail[w.Order.OrderUID] {
+			return errors.New("constraint violation")
+		}
+	}
+	return r.Memory.SaveOrders(writes)
+}
+
+func (r *batchRepo) saved() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]string(nil), r.batches...)
+}
+
+// batchConsumer возвращает consumer в пакетном режиме, который соберет все сообщения топика в один пакет
+func batchConsumer(broker *kafkatest.Broker, dlq *DeadLetterWriter, policy RetryPolicy, repo repository.OrderRepository) *Consumer {
+	c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), dlq, policy, repo, cache.New(cache.DefaultConfig()), nil)
+	c.SetBatch(BatchConfig{Size: len(broker.Messages("orders")), Wait: time.Second})
+	return c
+}
+
+func TestBatchFallbackIsolatesFailedOrder(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	broker.Produce("orders",
+		kafka.Message{Key: []byte("broken"), Value: []byte("{")},
+		orderMessage(t, testOrder("o1")),
+		orderMessage(t, testOrder("bad")),
+		orderMessage(t, testOrder("o2")),
+	)
+
+	repo := &batchRepo{Memory: repository.NewMemory(), fail: map[string]bool{"bad": true}}
+	dlq := NewDeadLetterWriterFrom(broker.Writer("orders-dlq"), "orders-dlq")
+	c := batchConsumer(broker, dlq, testPolicy(2, ExhaustedDeadLetter), repo)
+	stop, result := runConsumer(t, c)
+
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 4 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+
+	// Пакет не сохранился целиком, после чего заказы сохранены по одному
+	if got, want := repo.saved(), [][]string{{"o1", "bad", "o2"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+	for _, uid := range []string{"o1", "o2"} {
+		if _, err := repo.GetOrder(uid); err != nil {
+			t.Errorf("GetOrder(%s): %v", uid, err)
+		}
+	}
+
+	// Отклоненное при разборе сообщение не публикуется повторно при обработке по одному
+	var reasons []string
+	for _, msg := range broker.Messages("orders-dlq") {
+		reason, _ := header(msg, HeaderDLQReason)
+		reasons = append(reasons, string(msg.Key)+":"+reason)
+	}
+	if want := []string{"broken:" + ReasonInvalidJSON, "bad:" + ReasonRetriesExhausted}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("dead-letter messages = %v, want %v", reasons, want)
+	}
+}
+
+func TestBatchHaltsAtFailedOrder(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	broker.Produce("orders",
+		orderMessage(t, testOrder("o1")),
+		orderMessage(t, testOrder("bad")),
+		orderMessage(t, testOrder("o2")),
+	)
+
+	repo := &batchRepo{Memory: repository.NewMemory(), fail: map[string]bool{"bad": true}}
+	c := batchConsumer(broker, nil, testPolicy(2, ExhaustedHalt), repo)
+	_, result := runConsumer(t, c)
+
+	if err := waitResult(t, result); !errors.Is(err, ErrConsumerHalted) {
+		t.Fatalf("Start() error = %v, want %v", err, ErrConsumerHalted)
+	}
+	if got := broker.Committed(DefaultGroupID, "orders", 0); got != 1 {
+		t.Errorf("committed offset = %d, want 1", got)
+	}
+	if _, err := repo.GetOrder("o2"); err == nil {
+		t.Error("order after the failed one was saved")
+	}
+}
+
+func TestBatchEventsSplitSegments(t *testing.T) {
+	updated := testOrder("o1")
+	updated.Delivery.City = "Haifa"
+
+	broker := kafkatest.NewBroker()
+	broker.Produce("orders",
+		orderMessage(t, testOrder("o1")),
+		orderMessage(t, testOrder("o2")),
+		eventMessage("o2", EventOrderCancelled, `{"reason":"changed mind"}`),
+		eventMessage("o1", EventOrderDeleted, ""),
+		orderMessage(t, updated),
+	)
+
+	repo := &batchRepo{Memory: repository.NewMemory()}
+	dlq := NewDeadLetterWriterFrom(broker.Writer("orders-dlq"), "orders-dlq")
+	c := batchConsumer(broker, dlq, testPolicy(1, ExhaustedHalt), repo)
+	stop, result := runConsumer(t, c)
+
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 5 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+
+	// Заказы до событий сохранены первым сегментом, заказ после удаления — вторым
+	if got, want := repo.saved(), [][]string{{"o1", "o2"}, {"o1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+	if dead := broker.Messages("orders-dlq"); len(dead) != 0 {
+		t.Errorf("dead-letter messages = %d, want 0", len(dead))
+	}
+
+	o1, err := repo.GetOrder("o1")
+	if err != nil {
+		t.Fatalf("GetOrder(o1): %v", err)
+	}
+	if o1.Delivery.City != "Haifa" {
+		t.Errorf("o1 delivery.city = %q, want the order written after deletion", o1.Delivery.City)
+	}
+	o2, err := repo.GetOrder("o2")
+	if err != nil {
+		t.Fatalf("GetOrder(o2): %v", err)
+	}
+	if !o2.Cancelled() {
+		t.Error("o2 is not cancelled")
+	}
+}
+
+func TestCommitBatch(t *testing.T) {
+	msg := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Topic: "orders", Partition: partition, Offset: offset}
+	}
+
+	tests := []struct {
+		name          string
+		msgs          []kafka.Message
+		done          []bool
+		wantCommitted map[int]int64 // Следующее смещение по партициям
+	}{
+		{
+			name:          "all messages processed",
+			msgs:          []kafka.Message{msg(0, 0), msg(1, 0), msg(0, 1)},
+			done:          []bool{true, true, true},
+			wantCommitted: map[int]int64{0: 2, 1: 1},
+		},
+		{
+			name:          "stops at the first unfinished message of a partition",
+			msgs:          []kafka.Message{msg(0, 0), msg(0, 1), msg(0, 2), msg(1, 0), msg(1, 1)},
+			done:          []bool{true, false, true, true, true},
+			wantCommitted: map[int]int64{0: 1, 1: 2},
+		},
+		{
+			name:          "partition with an unfinished first message is not committed",
+			msgs:          []kafka.Message{msg(0, 0), msg(1, 5), msg(1, 6)},
+			done:          []bool{true, false, true},
+			wantCommitted: map[int]int64{0: 1, 1: 0},
+		},
+		{
+			name:          "nothing processed",
+			msgs:          []kafka.Message{msg(0, 0), msg(1, 0)},
+			done:          []bool{false, false},
+			wantCommitted: map[int]int64{0: 0, 1: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), nil, testPolicy(1, ExhaustedHalt), repository.NewMemory(), cache.New(cache.DefaultConfig()), nil)
+
+			if err := c.commitBatch(context.Background(), tt.msgs, tt.done); err != nil {
+				t.Fatalf("commitBatch() error = %v", err)
+			}
+
+			for partition, want := range tt.wantCommitted {
+				if got := broker.Committed(DefaultGroupID, "orders", partition); got != want {
+					t.Errorf("partition %d: committed = %d, want %d", partition, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Механизмы SASL
+const (
+	SASLNone        = ""
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+// ConnConfig задает подключение к кластеру: список bootstrap-брокеров, SASL и TLS
+type ConnConfig struct {
+	Brokers     []string      // Адреса host:port
+	DialTimeout time.Duration // Таймаут установки соединения
+	SASL        SASLConfig
+	TLS         TLSConfig
+}
+
+// SASLConfig задает аутентификацию; пустой Mechanism отключает SASL
+type SASLConfig struct {
+	Mechanism string // plain, scram-sha-256 или scram-sha-512
+	Username  string
+	Password  string
+}
+
+// TLSConfig задает шифрование соединений с брокерами
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string // PEM с корневыми сертификатами; пустой — системные
+	CertFile           string // PEM с клиентским сертификатом (mTLS), вместе с KeyFile
+	KeyFile            string
+	ServerName         string // Имя для проверки сертификата брокера; пустое — из адреса
+	InsecureSkipVerify bool   // Не проверять сертификат брокера (только для отладки)
+}
+
+// DefaultConnConfig возвращает подключение к локальному брокеру без SASL и TLS
+func DefaultConnConfig() ConnConfig {
+	return ConnConfig{
+		Brokers:     []string{"localhost:9092"},
+		DialTimeout: 10 * time.Second,
+	}
+}
+
+// ParseBrokers разбирает список адресов через запятую, пропуская пустые элементы
+func ParseBrokers(list string) []string {
+	var brokers []string
+	for _, b := range strings.Split(list, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	return brokers
+}
+
+// Validate проверяет корректность конфигурации без чтения файлов сертификатов
+func (c ConnConfig) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("at least one broker is required")
+	}
+	for _, b := range c.Brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			return fmt.Errorf("invalid broker address %q: %w", b, err)
+		}
+	}
+	if c.DialTimeout <= 0 {
+		return fmt.Errorf("dial timeout must be positive, got %s", c.DialTimeout)
+	}
+
+	switch c.SASL.Mechanism {
+	case SASLNone:
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		if c.SASL.Username == "" {
+			return fmt.Errorf("sasl username is required for mechanism %s", c.SASL.Mechanism)
+		}
+	default:
+		return fmt.Errorf("unknown sasl mechanism %q (expected %s, %s or %s)", c.SASL.Mechanism, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+	}
+
+	t := c.TLS
+	if !t.Enabled && (t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" || t.ServerName != "" || t.InsecureSkipVerify) {
+		return errors.New("tls settings are given but tls is not enabled")
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("tls cert file and key file must be set together")
+	}
+	return nil
+}
+
+// Cluster — подключение к кластеру Kafka, общее для consumer, dead-letter writer
+// и повторного чтения. Сертификаты и SASL разбираются один раз при создании.
+type Cluster struct {
+	brokers   []string
+	dialer    *kafka.Dialer
+	transport *kafka.Transport
+}
+
+// NewCluster проверяет конфигурацию, читает сертификаты и готовит dialer для reader'ов
+// и transport для writer'ов
+func NewCluster(cfg ConnConfig) (*Cluster, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	mechanism, err := cfg.SASL.mechanism()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := cfg.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cluster{
+		brokers: cfg.Brokers,
+		dialer: &kafka.Dialer{
+			Timeout:       cfg.DialTimeout,
+			DualStack:     true,
+			TLS:           tlsConfig,
+			SASLMechanism: mechanism,
+		},
+		transport: &kafka.Transport{
+			DialTimeout: cfg.DialTimeout,
+			TLS:         tlsConfig,
+			SASL:        mechanism,
+		},
+	}, nil
+}
+
+// dial подключается к первому доступному брокеру из списка
+func (c *Cluster) dial(ctx context.Context) (*kafka.Conn, error) {
+	var errs []string
+	for _, broker := range c.brokers {
+		conn, err := c.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, broker+": "+err.Error())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to brokers: %s", strings.Join(errs, "; "))
+}
+
+// dialLeader подключается к лидеру партиции, узнавая его через первый доступный брокер
+func (c *Cluster) dialLeader(ctx context.Context, topic string, partition int) (*kafka.Conn, error) {
+	var errs []string
+	for _, broker := range c.brokers {
+		conn, err := c.dialer.DialLeader(ctx, "tcp", broker, topic, partition)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, broker+": "+err.Error())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to partition %d leader: %s", partition, strings.Join(errs, "; "))
+}
+
+// mechanism возвращает механизм SASL или nil, если аутентификация отключена
+func (s SASLConfig) mechanism() (sasl.Mechanism, error) {
+	switch s.Mechanism {
+	case SASLPlain:
+		return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+	case SASLScramSHA256, SASLScramSHA512:
+		algo := scram.SHA256
+		if s.Mechanism == SASLScramSHA512 {
+			algo = scram.SHA512
+		}
+		m, err := scram.Mechanism(algo, s.Username, s.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sasl mechanism: %w", err)
+		}
+		return m, nil
+	default:
+		return nil, nil
+	}
+}
+
+// load читает сертификаты и возвращает конфигурацию TLS или nil, если TLS отключен
+func (t TLSConfig) load() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls ca file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,233 @@
+package kafka
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA — удостоверяющий центр для сертификатов брокера и клиента
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ca key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create ca certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse ca certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue выпускает сертификат для 127.0.0.1 с указанным назначением
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writePEM записывает сертификат и ключ в файлы и возвращает их пути
+func writePEM(t *testing.T, dir, name string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// startTLSBroker принимает одно соединение с обязательным клиентским сертификатом
+// и возвращает адрес и канал с результатом рукопожатия на стороне брокера
+func startTLSBroker(t *testing.T, ca *testCA) (string, <-chan error) {
+	t.Helper()
+	clients := x509.NewCertPool()
+	clients.AddCert(ca.cert)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "broker", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clients,
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	result := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			result <- err
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		result <- conn.(*tls.Conn).Handshake()
+	}()
+	return ln.Addr().String(), result
+}
+
+func TestClusterTLSHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "kafka-ca")
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+
+	otherCA := newTestCA(t, "other-ca")
+	otherCAFile := filepath.Join(dir, "other-ca.crt")
+	writeFile(t, otherCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCA.cert.Raw}))
+
+	certFile, keyFile := writePEM(t, dir, "client", ca.issue(t, "order-service", x509.ExtKeyUsageClientAuth))
+	foreignCert, foreignKey := writePEM(t, dir, "foreign", otherCA.issue(t, "order-service", x509.ExtKeyUsageClientAuth))
+
+	tests := []struct {
+		name   string
+		tls    TLSConfig
+		wantOK bool
+	}{
+		{
+			name:   "mutual tls",
+			tls:    TLSConfig{Enabled: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+			wantOK: true,
+		},
+		{
+			name:   "explicit server name",
+			tls:    TLSConfig{Enabled: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "localhost"},
+			wantOK: true,
+		},
+		{
+			name: "broker certificate from another ca",
+			tls:  TLSConfig{Enabled: true, CAFile: otherCAFile, CertFile: certFile, KeyFile: keyFile},
+		},
+		{
+			name: "server name mismatch",
+			tls:  TLSConfig{Enabled: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "kafka.example.com"},
+		},
+		{
+			name: "missing client certificate",
+			tls:  TLSConfig{Enabled: true, CAFile: caFile},
+		},
+		{
+			name: "client certificate from another ca",
+			tls:  TLSConfig{Enabled: true, CAFile: caFile, CertFile: foreignCert, KeyFile: foreignKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, brokerResult := startTLSBroker(t, ca)
+			cfg := DefaultConnConfig()
+			cfg.Brokers = []string{addr}
+			cfg.DialTimeout = 5 * time.Second
+			cfg.TLS = tt.tls
+
+			cluster, err := NewCluster(cfg)
+			if err != nil {
+				t.Fatalf("NewCluster: %v", err)
+			}
+			if cluster.transport.TLS != cluster.dialer.TLS {
+				t.Error("writers and readers use different tls configs")
+			}
+
+			// В TLS 1.3 клиент завершает рукопожатие раньше, чем брокер проверит его сертификат,
+			// поэтому результат проверяется на обеих сторонах
+			conn, dialErr := cluster.dial(context.Background())
+			if dialErr == nil {
+				conn.Close()
+			}
+			var brokerErr error
+			select {
+			case brokerErr = <-brokerResult:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for broker handshake")
+			}
+
+			if ok := dialErr == nil && brokerErr == nil; ok != tt.wantOK {
+				t.Errorf("handshake ok = %v, want %v (client: %v, broker: %v)", ok, tt.wantOK, dialErr, brokerErr)
+			}
+		})
+	}
+}
+
+func TestClusterTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.txt")
+	writeFile(t, notPEM, []byte("not a certificate"))
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+	}{
+		{name: "missing ca file", tls: TLSConfig{Enabled: true, CAFile: filepath.Join(dir, "missing.crt")}},
+		{name: "ca file without certificates", tls: TLSConfig{Enabled: true, CAFile: notPEM}},
+		{name: "missing client key pair", tls: TLSConfig{Enabled: true, CertFile: filepath.Join(dir, "c.crt"), KeyFile: filepath.Join(dir, "c.key")}},
+		{name: "key without certificate", tls: TLSConfig{Enabled: true, KeyFile: filepath.Join(dir, "c.key")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConnConfig()
+			cfg.TLS = tt.tls
+			if _, err := NewCluster(cfg); err == nil {
+				t.Error("NewCluster() error = nil, want error")
+			}
+		})
+	}
+}
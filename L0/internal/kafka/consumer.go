@@ -3,105 +3,409 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"order-service/internal/cache"
-	"order-service/internal/database"
+	"order-service/internal/metrics"
 	"order-service/internal/models"
+	"order-service/internal/redact"
+	"order-service/internal/repository"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// OrderValidator проверяет заказ перед сохранением
+type OrderValidator interface {
+	Validate(order *models.Order) error
+}
+
+// builtinValidator применяет только встроенные проверки models.Order
+type builtinValidator struct{}
+
+func (builtinValidator) Validate(order *models.Order) error {
+	return order.Validate()
+}
+
 // Consumer представляет Kafka consumer
 type Consumer struct {
-	reader *kafka.Reader
-	db     *database.DB
-	cache  *cache.Cache
+	reader    MessageSource
+	dlq       *DeadLetterWriter
+	retry     RetryPolicy
+	repo      repository.OrderRepository
+	cache     *cache.Cache
+	validator OrderValidator
+	batch     BatchConfig
+	workers   WorkerConfig
+	offsets   repository.OffsetStore // Если задан, смещения хранятся вместе с заказами
+	group     string
+	redactor  *redact.Redactor // Маскирует персональные данные в теле сообщения перед записью в лог
 }
 
-// NewConsumer создает новый Kafka consumer
-func NewConsumer(broker, topic string, db *database.DB, cache *cache.Cache) *Consumer {
+// DefaultGroupID — группа consumer по умолчанию
+const DefaultGroupID = "order-service-group"
+
+// NewConsumer создает новый Kafka consumer.
+// Если dlqTopic пустой, отклоненные сообщения только логируются,
+// а после исчерпания попыток consumer останавливается.
+// Если validator равен nil, применяются только встроенные проверки заказа.
+func NewConsumer(cluster *Cluster, topic, dlqTopic string, fetch FetchConfig, retry RetryPolicy, repo repository.OrderRepository, cache *cache.Cache, validator OrderValidator) *Consumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{broker},
+		Brokers:        cluster.brokers,
+		Dialer:         cluster.dialer,
 		Topic:          topic,
-		GroupID:        "order-service-group",
-		MinBytes:       10e3, // 10KB
-		MaxBytes:       10e6, // 10MB
-		CommitInterval: time.Second,
+		GroupID:        fetch.GroupID,
+		MinBytes:       fetch.MinBytes,
+		MaxBytes:       fetch.MaxBytes,
+		CommitInterval: fetch.CommitInterval,
 		StartOffset:    kafka.LastOffset,
 	})
 
+	var dlq *DeadLetterWriter
+	if dlqTopic != "" {
+		dlq = NewDeadLetterWriter(cluster, dlqTopic)
+	}
+
+	return NewConsumerFromSource(r, dlq, retry, repo, cache, validator)
+}
+
+// NewConsumerFromSource создает consumer поверх произвольного источника сообщений.
+// dlq и validator могут быть nil. source может быть nil, если consumer используется
+// только для обработки сообщений Replayer'ом.
+func NewConsumerFromSource(source MessageSource, dlq *DeadLetterWriter, retry RetryPolicy, repo repository.OrderRepository, cache *cache.Cache, validator OrderValidator) *Consumer {
+	if validator == nil {
+		validator = builtinValidator{}
+	}
+
 	return &Consumer{
-		reader: r,
-		db:     db,
-		cache:  cache,
+		reader:    source,
+		dlq:       dlq,
+		retry:     retry,
+		repo:      repo,
+		cache:     cache,
+		validator: validator,
+		batch:     DefaultBatchConfig(),
+		workers:   DefaultWorkerConfig(),
+		redactor:  redact.Default(),
 	}
 }
 
-// Start запускает потребление сообщений из Kafka
-func (c *Consumer) Start(ctx context.Context) {
+// SetRedactor задает политику маскирования тела сообщения в логах; вызывается до Start
+func (c *Consumer) SetRedactor(r *redact.Redactor) {
+	c.redactor = r
+}
+
+// ErrConsumerHalted возвращается из Start, когда сообщение не удалось обработать
+// за отведенное число попыток и политика требует остановки
+var ErrConsumerHalted = errors.New("consumer halted after exhausting retries")
+
+// Start запускает потребление сообщений из Kafka.
+// Возвращает nil при отмене контекста и ErrConsumerHalted при остановке по политике повторов.
+func (c *Consumer) Start(ctx context.Context) error {
 	log.Println("component=kafka_consumer event=start msg=\"starting consumer\"")
 
+	if c.offsets != nil && c.workers.enabled() && c.workers.Ordering != OrderingPartition {
+		return errors.New("offsets stored with orders require partition ordering of workers")
+	}
+
+	if c.workers.enabled() {
+		return c.runWorkers(ctx)
+	}
+	if c.batch.enabled() {
+		return c.runBatches(ctx)
+	}
+
 	for {
-		select {
-		case <-ctx.Done():
+		// Чтение сообщения из Kafka
+		msg, err := c.fetch(ctx)
+		if err != nil {
 			log.Println("component=kafka_consumer event=stop msg=\"stopping consumer\"")
-			return
-		default:
-			// Чтение сообщения из Kafka
-			msg, err := c.reader.FetchMessage(ctx)
-			if err != nil {
-				log.Printf("level=error component=kafka_consumer event=fetch_error err=%v", err)
+			return nil
+		}
+
+		// Обработка сообщения с повторами; смещение не сдвигается, пока заказ не сохранен
+		if err := c.handleMessage(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("level=info component=kafka_consumer event=stop_uncommitted partition=%d offset=%d msg=\"context cancelled before message was processed\"", msg.Partition, msg.Offset)
 				continue
 			}
+			log.Printf("level=error component=kafka_consumer event=halted partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
+			return err
+		}
 
-			// Обработка сообщения
-			if err := c.processMessage(msg); err != nil {
-				log.Printf("level=error component=kafka_consumer event=process_error partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
-				// В случае ошибки не коммитим сообщение
+		// Подтверждение успешной обработки
+		if err := c.commit(ctx, msg); err != nil {
+			if ctx.Err() != nil {
 				continue
 			}
+			return err
+		}
+	}
+}
 
-			// Подтверждение успешной обработки
-			if err := c.reader.CommitMessages(ctx, msg); err != nil {
-				log.Printf("level=error component=kafka_consumer event=commit_error partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
-			}
+// fetch читает следующее сообщение, повторяя чтение с паузой при ошибках брокера.
+// Возвращает ошибку только при отмене контекста.
+func (c *Consumer) fetch(ctx context.Context) (kafka.Message, error) {
+	for failures := 1; ; failures++ {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err == nil {
+			metrics.ObserveConsumerLag(msg.Partition, msg.Offset, msg.HighWaterMark)
+			return msg, nil
+		}
+		if ctx.Err() != nil {
+			return kafka.Message{}, ctx.Err()
+		}
+
+		backoff := c.retry.Backoff(failures)
+		log.Printf("level=error component=kafka_consumer event=fetch_error attempt=%d backoff=%s err=%v", failures, backoff, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return kafka.Message{}, err
+		}
+	}
+}
+
+// handleMessage обрабатывает сообщение, повторяя попытки согласно политике.
+// Возвращает nil, если сообщение можно коммитить.
+func (c *Consumer) handleMessage(ctx context.Context, msg kafka.Message) error {
+	defer func(start time.Time) {
+		metrics.ConsumerProcessingDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	for attempt := 1; ; attempt++ {
+		err := c.processMessage(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if c.retry.exhausted(attempt) {
+			metrics.ConsumerMessages.WithLabelValues(metrics.ResultFailed).Inc()
+			log.Printf("level=error component=kafka_consumer event=retries_exhausted partition=%d offset=%d attempts=%d action=%s err=%v", msg.Partition, msg.Offset, attempt, c.retry.OnExhausted, err)
+			return c.onExhausted(ctx, msg, err)
+		}
+
+		backoff := c.retry.Backoff(attempt)
+		log.Printf("level=warn component=kafka_consumer event=retry partition=%d offset=%d attempt=%d backoff=%s err=%v", msg.Partition, msg.Offset, attempt, backoff, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return err
 		}
 	}
 }
 
-// processMessage обрабатывает одно сообщение
-func (c *Consumer) processMessage(msg kafka.Message) error {
+// onExhausted применяет действие политики к сообщению, которое не удалось обработать
+func (c *Consumer) onExhausted(ctx context.Context, msg kafka.Message, cause error) error {
+	if c.retry.OnExhausted == ExhaustedDeadLetter && c.dlq != nil {
+		if err := c.dlq.Publish(ctx, msg, ReasonRetriesExhausted, cause); err != nil {
+			return fmt.Errorf("%w: %v", ErrConsumerHalted, err)
+		}
+		metrics.ConsumerMessages.WithLabelValues(metrics.ResultDeadLettered).Inc()
+		log.Printf("level=info component=kafka_consumer event=dead_lettered partition=%d offset=%d reason=%s dlq_topic=%q", msg.Partition, msg.Offset, ReasonRetriesExhausted, c.dlq.Topic())
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v", ErrConsumerHalted, cause)
+}
+
+// processMessage обрабатывает одно сообщение: сохраняет заказ или применяет событие отмены либо удаления
+func (c *Consumer) processMessage(ctx context.Context, msg kafka.Message) error {
+	c.logMessage(msg)
+
+	if event := messageEvent(msg); !isOrderWrite(event) {
+		return c.processEvent(ctx, msg, event)
+	}
+
+	order, reason, err := c.decode(msg)
+	if err != nil {
+		return c.deadLetter(ctx, msg, reason, err)
+	}
+
+	// Сохранение в базу данных
+	err = c.repo.SaveOrder(order, c.messageSource(msg))
+	if errors.Is(err, models.ErrIllegalTransition) {
+		return c.rejectTransition(ctx, msg, order.OrderUID, err)
+	}
+	if err != nil {
+		log.Printf("level=error component=kafka_consumer event=db_save_failed partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, order.OrderUID, err)
+		return err // Возвращаем ошибку для повторной обработки
+	}
+
+	c.processed(msg, order)
+	return nil
+}
+
+// logMessage логирует начало обработки и содержимое сообщения.
+// Персональные данные в теле маскируются по политике для уровня debug.
+func (c *Consumer) logMessage(msg kafka.Message) {
 	log.Printf("component=kafka_consumer event=process_start partition=%d offset=%d key=%q", msg.Partition, msg.Offset, string(msg.Key))
-	log.Printf("component=kafka_consumer event=message_content partition=%d offset=%d body=%q", msg.Partition, msg.Offset, string(msg.Value))
+	body := c.redactor.Body(msg.Value, c.redactor.ForLog(redact.LevelDebug))
+	log.Printf("level=debug component=kafka_consumer event=message_content partition=%d offset=%d body=%q", msg.Partition, msg.Offset, body)
+}
+
+// decode разбирает и проверяет заказ из сообщения, логируя нарушения.
+// При ошибке возвращает причину для dead-letter топика.
+func (c *Consumer) decode(msg kafka.Message) (*models.Order, string, error) {
+	order, reason, err := c.parseOrder(msg)
+	switch reason {
+	case ReasonInvalidJSON:
+		log.Printf("level=warn component=kafka_consumer event=invalid_json partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
+	case ReasonInvalidOrder:
+		logValidationError(msg, order.OrderUID, err)
+	}
+	if err != nil {
+		return nil, reason, err
+	}
+	return order, "", nil
+}
 
+// parseOrder разбирает и проверяет заказ без логирования.
+// При ошибке валидации возвращает и разобранный заказ.
+func (c *Consumer) parseOrder(msg kafka.Message) (*models.Order, string, error) {
 	// Парсинг JSON
 	var order models.Order
 	if err := json.Unmarshal(msg.Value, &order); err != nil {
-		log.Printf("level=warn component=kafka_consumer event=invalid_json partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
-		return nil // Игнорируем невалидные сообщения
+		return nil, ReasonInvalidJSON, err
 	}
 
 	// Валидация заказа
-	if err := order.Validate(); err != nil {
-		log.Printf("level=warn component=kafka_consumer event=invalid_order partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, order.OrderUID, err)
-		return nil // Игнорируем невалидные заказы
+	if err := c.validator.Validate(&order); err != nil {
+		return &order, ReasonInvalidOrder, err
 	}
 
-	// Сохранение в базу данных
-	if err := c.db.SaveOrder(&order); err != nil {
-		log.Printf("level=error component=kafka_consumer event=db_save_failed partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, order.OrderUID, err)
-		return err // Возвращаем ошибку для повторной обработки
+	return &order, "", nil
+}
+
+// messageSource возвращает координаты сообщения для журнала ревизий и хранилища смещений
+func (c *Consumer) messageSource(msg kafka.Message) *models.Source {
+	source := &models.Source{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+	if c.offsets != nil {
+		source.Group = c.group
 	}
+	return source
+}
 
-	// Сохранение в кеш
-	c.cache.Set(order.OrderUID, &order)
+// processed обновляет кеш сохраненной версией заказа и учитывает сообщение в метриках
+func (c *Consumer) processed(msg kafka.Message, order *models.Order) {
+	c.cache.Set(order.OrderUID, order)
 
+	metrics.ConsumerMessages.WithLabelValues(metrics.ResultProcessed).Inc()
 	log.Printf("level=info component=kafka_consumer event=processed partition=%d offset=%d order_uid=%q", msg.Partition, msg.Offset, order.OrderUID)
+}
+
+// rejectTransition отправляет в dead-letter топик сообщение с недопустимым переходом этапа.
+// Повтор такого сообщения не поможет, поэтому политика повторов не применяется.
+func (c *Consumer) rejectTransition(ctx context.Context, msg kafka.Message, orderUID string, err error) error {
+	log.Printf("level=warn component=kafka_consumer event=illegal_transition partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, orderUID, err)
+	return c.deadLetter(ctx, msg, ReasonIllegalTransition, err)
+}
+
+// logValidationError логирует каждое нарушение валидации отдельной строкой
+func logValidationError(msg kafka.Message, orderUID string, err error) {
+	ve, ok := models.AsValidationError(err)
+	if !ok {
+		log.Printf("level=warn component=kafka_consumer event=invalid_order partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, orderUID, err)
+		return
+	}
+
+	log.Printf("level=warn component=kafka_consumer event=invalid_order partition=%d offset=%d order_uid=%q violations=%d", msg.Partition, msg.Offset, orderUID, len(ve.Errors))
+	for _, fe := range ve.Errors {
+		log.Printf("level=warn component=kafka_consumer event=validation_error partition=%d offset=%d order_uid=%q field=%s rule=%s msg=%q", msg.Partition, msg.Offset, orderUID, fe.Field, fe.Rule, fe.Message)
+	}
+}
+
+// deadLetter отправляет отклоненное сообщение в dead-letter топик.
+// Ошибка публикации возвращается, чтобы сообщение не было закоммичено.
+func (c *Consumer) deadLetter(ctx context.Context, msg kafka.Message, reason string, cause error) error {
+	if c.dlq == nil {
+		metrics.ConsumerMessages.WithLabelValues(metrics.ResultInvalid).Inc()
+		return nil // Dead-letter топик не настроен, сообщение пропускается
+	}
+
+	// Неудачная публикация повторяется вместе с сообщением, поэтому невалидным
+	// оно считается только после успешной отправки
+	if err := c.dlq.Publish(ctx, msg, reason, cause); err != nil {
+		log.Printf("level=error component=kafka_consumer event=dlq_publish_failed partition=%d offset=%d reason=%s err=%v", msg.Partition, msg.Offset, reason, err)
+		return err
+	}
+
+	metrics.ConsumerMessages.WithLabelValues(metrics.ResultInvalid).Inc()
+	metrics.ConsumerMessages.WithLabelValues(metrics.ResultDeadLettered).Inc()
+	log.Printf("level=info component=kafka_consumer event=dead_lettered partition=%d offset=%d reason=%s dlq_topic=%q", msg.Partition, msg.Offset, reason, c.dlq.Topic())
+	return nil
+}
+
+// StoreOffsets включает хранение смещений в хранилище заказов: смещение сообщения
+// записывается в одной транзакции с заказом, а смещения отклоненных сообщений —
+// при коммите. Коммит в Kafka сохраняется для мониторинга отставания группы.
+// Вызывается до Start.
+func (c *Consumer) StoreOffsets(store repository.OffsetStore, group string) {
+	c.offsets = store
+	c.group = group
+}
+
+// commit подтверждает обработку сообщений: по одному сообщению на партицию,
+// после которого все предыдущие сообщения партиции уже обработаны.
+// Если смещения хранятся вместе с заказами, сначала они записываются в хранилище:
+// при неудаче в Kafka ничего не коммитится и возвращается ошибка, иначе после
+// перезапуска сообщения без записи заказа (например, отправленные в dead-letter)
+// обработались бы повторно.
+func (c *Consumer) commit(ctx context.Context, msgs ...kafka.Message) error {
+	if c.offsets != nil {
+		if err := c.storeOffsets(ctx, msgs); err != nil {
+			return err
+		}
+	}
+
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		for _, msg := range msgs {
+			log.Printf("level=error component=kafka_consumer event=commit_error partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
+		}
+	}
 	return nil
 }
 
+// storeOffsets записывает смещения в хранилище, повторяя попытки согласно политике.
+// Возвращает ErrConsumerHalted, если попытки исчерпаны, и ошибку контекста при его отмене.
+func (c *Consumer) storeOffsets(ctx context.Context, msgs []kafka.Message) error {
+	sources := make([]*models.Source, 0, len(msgs))
+	for _, msg := range msgs {
+		sources = append(sources, c.messageSource(msg))
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.offsets.SaveOffsets(ctx, sources)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if c.retry.exhausted(attempt) {
+			log.Printf("level=error component=kafka_consumer event=offset_store_failed partitions=%d attempts=%d err=%v", len(msgs), attempt, err)
+			return fmt.Errorf("%w: failed to store offsets: %v", ErrConsumerHalted, err)
+		}
+
+		backoff := c.retry.Backoff(attempt)
+		log.Printf("level=warn component=kafka_consumer event=offset_store_retry partitions=%d attempt=%d backoff=%s err=%v", len(msgs), attempt, backoff, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
 // Close закрывает consumer
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	var err error
+	if c.reader != nil {
+		err = c.reader.Close()
+	}
+	if c.dlq != nil {
+		if dlqErr := c.dlq.Close(); dlqErr != nil && err == nil {
+			err = dlqErr
+		}
+	}
+	return err
 }
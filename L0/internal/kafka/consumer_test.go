@@ -0,0 +1,792 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/internal/cache"
+	"order-service/internal/kafka/kafkatest"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+)
+
+// testOrder возвращает корректный заказ с одним товаром
+func testOrder(uid string) *models.Order {
+	track := "TRACK-" + uid
+	return &models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "tx-" + uid,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{{
+			ChrtID:      9934930,
+			TrackNumber: track,
+			Price:       453,
+			Rid:         "rid-" + uid,
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      models.StatusCreated,
+		}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+}
+
+// orderMessage возвращает сообщение с заказом целиком
+func orderMessage(t *testing.T, o *models.Order) kafka.Message {
+	t.Helper()
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("failed to marshal order: %v", err)
+	}
+	return kafka.Message{Topic: "orders", Key: []byte(o.OrderUID), Value: data}
+}
+
+// eventMessage возвращает сообщение события с заголовком HeaderEventType
+func eventMessage(uid, event, body string) kafka.Message {
+	msg := kafka.Message{Topic: "orders", Key: []byte(uid), Value: []byte(body)}
+	if event != "" {
+		msg.Headers = []kafka.Header{{Key: HeaderEventType, Value: []byte(event)}}
+	}
+	return msg
+}
+
+// testPolicy — политика повторов без задержек, чтобы тесты не ждали
+func testPolicy(attempts int, onExhausted ExhaustedAction) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     1,
+		OnExhausted:    onExhausted,
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	invalid := testOrder("bad")
+	invalid.Payment.Currency = "XXX"
+
+	tests := []struct {
+		name      string
+		setup     []*models.Order // Заказы в хранилище до сообщения
+		msg       func(t *testing.T) kafka.Message
+		uid       string
+		wantFound bool
+		wantGone  bool // Заказ удален, но его ревизии сохранены
+		check     func(t *testing.T, o *models.Order)
+	}{
+		{
+			name:      "order is saved and cached",
+			msg:       func(t *testing.T) kafka.Message { return orderMessage(t, testOrder("o1")) },
+			uid:       "o1",
+			wantFound: true,
+		},
+		{
+			name:  "order update replaces the stored order",
+			setup: []*models.Order{testOrder("o1")},
+			msg: func(t *testing.T) kafka.Message {
+				o := testOrder("o1")
+				o.Delivery.City = "Haifa"
+				return orderMessage(t, o)
+			},
+			uid:       "o1",
+			wantFound: true,
+			check: func(t *testing.T, o *models.Order) {
+				if o.Delivery.City != "Haifa" {
+					t.Errorf("delivery.city = %q, want Haifa", o.Delivery.City)
+				}
+			},
+		},
+		{
+			name: "invalid json is skipped",
+			msg: func(t *testing.T) kafka.Message {
+				return kafka.Message{Topic: "orders", Key: []byte("o1"), Value: []byte("{not json")}
+			},
+			uid: "o1",
+		},
+		{
+			name: "invalid order is skipped",
+			msg:  func(t *testing.T) kafka.Message { return orderMessage(t, invalid) },
+			uid:  "bad",
+		},
+		{
+			name:     "tombstone deletes the order",
+			setup:    []*models.Order{testOrder("o1")},
+			msg:      func(t *testing.T) kafka.Message { return eventMessage("o1", "", "") },
+			uid:      "o1",
+			wantGone: true,
+		},
+		{
+			name:     "delete event with order_uid in body",
+			setup:    []*models.Order{testOrder("o1")},
+			msg:      func(t *testing.T) kafka.Message { return eventMessage("", EventOrderDeleted, `{"order_uid":"o1"}`) },
+			uid:      "o1",
+			wantGone: true,
+		},
+		{
+			name: "delete of an unknown order is not an error",
+			msg:  func(t *testing.T) kafka.Message { return eventMessage("o1", EventOrderDeleted, "") },
+			uid:  "o1",
+		},
+		{
+			name:  "cancel event cancels the order",
+			setup: []*models.Order{testOrder("o1")},
+			msg: func(t *testing.T) kafka.Message {
+				return eventMessage("o1", EventOrderCancelled, `{"reason":"changed mind"}`)
+			},
+			uid:       "o1",
+			wantFound: true,
+			check: func(t *testing.T, o *models.Order) {
+				if o.Status != models.StatusCancelled || o.CancelReason != "changed mind" {
+					t.Errorf("status = %d, reason = %q; want cancelled with reason", o.Status, o.CancelReason)
+				}
+			},
+		},
+		{
+			name: "cancel of an unknown order is skipped",
+			msg:  func(t *testing.T) kafka.Message { return eventMessage("o1", EventOrderCancelled, `{"reason":"x"}`) },
+			uid:  "o1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewMemory()
+			orderCache := cache.New(cache.DefaultConfig())
+			for _, o := range tt.setup {
+				if err := repo.SaveOrder(o, nil); err != nil {
+					t.Fatalf("SaveOrder: %v", err)
+				}
+				orderCache.Set(o.OrderUID, o)
+			}
+			c := NewConsumerFromSource(nil, nil, testPolicy(1, ExhaustedHalt), repo, orderCache, nil)
+
+			// Отклоненные сообщения коммитятся: без dead-letter топика они только пропускаются
+			if err := c.handleMessage(context.Background(), tt.msg(t)); err != nil {
+				t.Fatalf("handleMessage() error = %v, want nil", err)
+			}
+
+			stored, err := repo.GetOrder(tt.uid)
+			if found := err == nil; found != tt.wantFound {
+				t.Fatalf("stored order found = %v, want %v (err %v)", found, tt.wantFound, err)
+			}
+			cached, found := orderCache.Get(tt.uid)
+			if found != tt.wantFound {
+				t.Fatalf("cached order found = %v, want %v", found, tt.wantFound)
+			}
+			if tt.wantFound && tt.check != nil {
+				tt.check(t, stored)
+				tt.check(t, cached)
+			}
+
+			revisions, err := repo.GetOrderRevisions(tt.uid)
+			if err != nil {
+				t.Fatalf("GetOrderRevisions: %v", err)
+			}
+			if gone := !tt.wantFound && len(revisions) > 0; gone != tt.wantGone {
+				t.Errorf("deleted with revisions = %v, want %v", gone, tt.wantGone)
+			}
+		})
+	}
+}
+
+func TestHandleMessageIllegalTransitionIsSkipped(t *testing.T) {
+	repo := repository.NewMemory()
+	c := NewConsumerFromSource(nil, nil, testPolicy(1, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+
+	if err := repo.SaveOrder(testOrder("o1"), nil); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	if _, err := repo.CancelOrder("o1", "", time.Now(), nil); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+
+	before, err := repo.GetOrderRevisions("o1")
+	if err != nil {
+		t.Fatalf("GetOrderRevisions: %v", err)
+	}
+
+	// Отмененный заказ нельзя вернуть на этап создания: сообщение пропускается без повторов
+	reopened := testOrder("o1")
+	reopened.Status = models.StatusCreated
+	if err := c.handleMessage(context.Background(), orderMessage(t, reopened)); err != nil {
+		t.Fatalf("handleMessage() error = %v, want nil", err)
+	}
+	stored, err := repo.GetOrder("o1")
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if stored.Status != models.StatusCancelled {
+		t.Errorf("status = %d, want %d", stored.Status, models.StatusCancelled)
+	}
+	if after, _ := repo.GetOrderRevisions("o1"); len(after) != len(before) {
+		t.Errorf("revisions = %d, want %d", len(after), len(before))
+	}
+}
+
+// hookRepo — in-memory хранилище, в котором перед сохранением заказа вызывается save.
+// Ошибка save возвращается вместо сохранения.
+type hookRepo struct {
+	*repository.Memory
+	save func(order *models.Order) error
+}
+
+func (r *hookRepo) SaveOrder(order *models.Order, source *models.Source) error {
+	if r.save != nil {
+		if err := r.save(order); err != nil {
+			return err
+		}
+	}
+	return r.Memory.SaveOrder(order, source)
+}
+
+// failTimes возвращает save, который завершается ошибкой первые n вызовов; n < 0 — всегда
+func failTimes(n int64) (save func(*models.Order) error, calls *atomic.Int64) {
+	calls = new(atomic.Int64)
+	return func(*models.Order) error {
+		if call := calls.Add(1); n < 0 || call <= n {
+			return errors.New("database is unavailable")
+		}
+		return nil
+	}, calls
+}
+
+// runConsumer запускает consumer и возвращает функцию остановки и канал с результатом Start
+func runConsumer(t *testing.T, c *Consumer) (stop func(), result <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- c.Start(ctx) }()
+	t.Cleanup(cancel)
+	return cancel, errc
+}
+
+// waitFor ожидает выполнения условия, проверяя его с короткой паузой
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitResult ожидает завершения Start
+func waitResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for consumer to stop")
+		return nil
+	}
+}
+
+func header(msg kafka.Message, key string) (string, bool) {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+func TestConsumerRetriesThenCommits(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	broker.Produce("orders", orderMessage(t, testOrder("o1")))
+
+	save, calls := failTimes(2)
+	repo := &hookRepo{Memory: repository.NewMemory(), save: save}
+	orderCache := cache.New(cache.DefaultConfig())
+	c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), nil, testPolicy(5, ExhaustedHalt), repo, orderCache, nil)
+	stop, result := runConsumer(t, c)
+
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 1 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("save attempts = %d, want 3", got)
+	}
+	if _, err := repo.GetOrder("o1"); err != nil {
+		t.Errorf("GetOrder: %v", err)
+	}
+	if _, found := orderCache.Get("o1"); !found {
+		t.Error("order was not cached")
+	}
+}
+
+func TestConsumerDeadLettersAfterRetries(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	msg := orderMessage(t, testOrder("o1"))
+	msg.Headers = []kafka.Header{{Key: "trace-id", Value: []byte("abc")}}
+	broker.Produce("orders", msg)
+
+	save, calls := failTimes(-1)
+	repo := &hookRepo{Memory: repository.NewMemory(), save: save}
+	dlq := NewDeadLetterWriterFrom(broker.Writer("orders-dlq"), "orders-dlq")
+	c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), dlq, testPolicy(3, ExhaustedDeadLetter), repo, cache.New(cache.DefaultConfig()), nil)
+	stop, result := runConsumer(t, c)
+
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 1 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("save attempts = %d, want 3", got)
+	}
+	dead := broker.Messages("orders-dlq")
+	if len(dead) != 1 {
+		t.Fatalf("dead-letter messages = %d, want 1", len(dead))
+	}
+	if string(dead[0].Key) != "o1" || string(dead[0].Value) != string(msg.Value) {
+		t.Errorf("dead-letter message key %q or value differs from the source message", dead[0].Key)
+	}
+
+	wantHeaders := map[string]string{
+		"trace-id":               "abc",
+		HeaderDLQReason:          ReasonRetriesExhausted,
+		HeaderDLQError:           "database is unavailable",
+		HeaderDLQSourceTopic:     "orders",
+		HeaderDLQSourcePartition: "0",
+		HeaderDLQSourceOffset:    "0",
+	}
+	for key, want := range wantHeaders {
+		if got, ok := header(dead[0], key); !ok || got != want {
+			t.Errorf("header %s = %q (present %v), want %q", key, got, ok, want)
+		}
+	}
+	for _, key := range []string{HeaderDLQSourceTimestamp, HeaderDLQTimestamp} {
+		value, _ := header(dead[0], key)
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			t.Errorf("header %s = %q is not an RFC 3339 time: %v", key, value, err)
+		}
+	}
+}
+
+func TestDeadLetterCountsInvalidOnce(t *testing.T) {
+	tests := []struct {
+		name             string
+		dlq              bool
+		failures         int
+		wantInvalid      float64
+		wantDeadLettered float64
+	}{
+		{name: "no dead-letter topic", wantInvalid: 1},
+		{name: "published at once", dlq: true, wantInvalid: 1, wantDeadLettered: 1},
+		{name: "published after failed attempts", dlq: true, failures: 2, wantInvalid: 1, wantDeadLettered: 1},
+		{name: "never published", dlq: true, failures: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			var dlq *DeadLetterWriter
+			var w *kafkatest.Writer
+			if tt.dlq {
+				w = broker.Writer("orders-dlq")
+				dlq = NewDeadLetterWriterFrom(w, "orders-dlq")
+			}
+			c := NewConsumerFromSource(nil, dlq, testPolicy(1, ExhaustedDeadLetter), repository.NewMemory(), cache.New(cache.DefaultConfig()), nil)
+
+			invalid := metrics.ConsumerMessages.WithLabelValues(metrics.ResultInvalid)
+			deadLettered := metrics.ConsumerMessages.WithLabelValues(metrics.ResultDeadLettered)
+			invalidBefore, deadLetteredBefore := testutil.ToFloat64(invalid), testutil.ToFloat64(deadLettered)
+
+			// Повторы обработки сообщения повторяют и публикацию в dead-letter топик
+			msg := orderMessage(t, testOrder("o1"))
+			for attempt := 0; attempt < 3; attempt++ {
+				if w != nil {
+					var err error
+					if attempt < tt.failures {
+						err = errors.New("broker is unavailable")
+					}
+					w.FailWrites(err)
+				}
+				if err := c.deadLetter(context.Background(), msg, ReasonInvalidOrder, errors.New("invalid order")); err == nil {
+					break
+				}
+			}
+
+			if got := testutil.ToFloat64(invalid) - invalidBefore; got != tt.wantInvalid {
+				t.Errorf("invalid = %v, want %v", got, tt.wantInvalid)
+			}
+			if got := testutil.ToFloat64(deadLettered) - deadLetteredBefore; got != tt.wantDeadLettered {
+				t.Errorf("dead_lettered = %v, want %v", got, tt.wantDeadLettered)
+			}
+		})
+	}
+}
+
+func TestConsumerDoesNotCommitFailedMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		dlq     bool
+		failDLQ bool
+	}{
+		{name: "halt policy"},
+		{name: "dead-letter topic is unavailable", dlq: true, failDLQ: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewBroker()
+			broker.Produce("orders", orderMessage(t, testOrder("o1")), orderMessage(t, testOrder("o2")))
+
+			save, _ := failTimes(-1)
+			repo := &hookRepo{Memory: repository.NewMemory(), save: save}
+			policy := testPolicy(2, ExhaustedHalt)
+			var dlq *DeadLetterWriter
+			if tt.dlq {
+				w := broker.Writer("orders-dlq")
+				if tt.failDLQ {
+					w.FailWrites(errors.New("broker is unavailable"))
+				}
+				dlq = NewDeadLetterWriterFrom(w, "orders-dlq")
+				policy.OnExhausted = ExhaustedDeadLetter
+			}
+			c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), dlq, policy, repo, cache.New(cache.DefaultConfig()), nil)
+			_, result := runConsumer(t, c)
+
+			if err := waitResult(t, result); !errors.Is(err, ErrConsumerHalted) {
+				t.Fatalf("Start() error = %v, want %v", err, ErrConsumerHalted)
+			}
+			if got := broker.Committed(DefaultGroupID, "orders", 0); got != 0 {
+				t.Errorf("committed offset = %d, want 0", got)
+			}
+			if _, err := repo.GetOrder("o2"); err == nil {
+				t.Error("message after the failed one was processed")
+			}
+		})
+	}
+}
+
+func TestConsumerRedeliversAfterRewind(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	broker.Produce("orders", orderMessage(t, testOrder("o1")), orderMessage(t, testOrder("o2")))
+
+	var failing atomic.Bool
+	failing.Store(true)
+	repo := &hookRepo{Memory: repository.NewMemory(), save: func(o *models.Order) error {
+		if o.OrderUID == "o2" && failing.Load() {
+			return errors.New("database is unavailable")
+		}
+		return nil
+	}}
+	reader := broker.Reader(DefaultGroupID, "orders")
+	c := NewConsumerFromSource(reader, nil, testPolicy(2, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+
+	// Первый заказ сохранен и закоммичен, на втором consumer останавливается
+	_, result := runConsumer(t, c)
+	if err := waitResult(t, result); !errors.Is(err, ErrConsumerHalted) {
+		t.Fatalf("Start() error = %v, want %v", err, ErrConsumerHalted)
+	}
+	if got := broker.Committed(DefaultGroupID, "orders", 0); got != 1 {
+		t.Fatalf("committed offset = %d, want 1", got)
+	}
+
+	// После ребалансировки незакоммиченное сообщение доставляется повторно
+	failing.Store(false)
+	reader.Rewind()
+	stop, result := runConsumer(t, c)
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 2 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+
+	revisions, err := repo.GetOrderRevisions("o1")
+	if err != nil || len(revisions) != 1 {
+		t.Errorf("o1 revisions = %d (err %v), want 1: committed message must not be redelivered", len(revisions), err)
+	}
+	if _, err := repo.GetOrder("o2"); err != nil {
+		t.Errorf("redelivered order was not saved: %v", err)
+	}
+}
+
+func TestConsumerWorkersCommitContiguousPrefix(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	repo := &hookRepo{Memory: repository.NewMemory()}
+	c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), nil, testPolicy(1, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+	c.SetWorkers(WorkerConfig{Workers: 2, Ordering: OrderingKey, QueueSize: 10})
+
+	// Заказы одной партиции с ключами, которые попадают к разным worker'ам
+	slow, fast := testOrder("slow"), testOrder("")
+	for i := 0; fast.OrderUID == ""; i++ {
+		uid := fmt.Sprintf("fast-%d", i)
+		if c.route(kafka.Message{Key: []byte(uid)}) != c.route(kafka.Message{Key: []byte(slow.OrderUID)}) {
+			fast = testOrder(uid)
+		}
+	}
+
+	release := make(chan struct{})
+	repo.save = func(o *models.Order) error {
+		if o.OrderUID == slow.OrderUID {
+			<-release
+		}
+		return nil
+	}
+	broker.Produce("orders", orderMessage(t, slow), orderMessage(t, fast))
+	stop, result := runConsumer(t, c)
+
+	// Второе сообщение обработано раньше первого, но его смещение не коммитится
+	waitFor(t, "fast order", func() bool {
+		_, err := repo.GetOrder(fast.OrderUID)
+		return err == nil
+	})
+	if got := broker.Committed(DefaultGroupID, "orders", 0); got != 0 {
+		t.Errorf("committed offset = %d before the first message was processed, want 0", got)
+	}
+
+	close(release)
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 2 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	msg := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Topic: "orders", Partition: partition, Offset: offset}
+	}
+
+	type step struct {
+		add      []kafka.Message
+		complete []kafka.Message
+		done     []bool        // nil — все сообщения complete обработаны
+		want     map[int]int64 // Партиция -> смещение сообщения для коммита
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{add: []kafka.Message{msg(0, 0), msg(0, 1)}, complete: []kafka.Message{msg(0, 0)}, want: map[int]int64{0: 0}},
+				{complete: []kafka.Message{msg(0, 1)}, want: map[int]int64{0: 1}},
+			},
+		},
+		{
+			name: "out of order waits for the gap",
+			steps: []step{
+				{add: []kafka.Message{msg(0, 0), msg(0, 1), msg(0, 2)}, complete: []kafka.Message{msg(0, 2), msg(0, 1)}, want: map[int]int64{}},
+				{complete: []kafka.Message{msg(0, 0)}, want: map[int]int64{0: 2}},
+			},
+		},
+		{
+			name: "failed message blocks the partition",
+			steps: []step{
+				{add: []kafka.Message{msg(0, 0), msg(0, 1)}, complete: []kafka.Message{msg(0, 0), msg(0, 1)}, done: []bool{false, true}, want: map[int]int64{}},
+			},
+		},
+		{
+			name: "partitions are independent",
+			steps: []step{
+				{add: []kafka.Message{msg(0, 0), msg(1, 0), msg(1, 1)}, complete: []kafka.Message{msg(1, 1), msg(1, 0)}, want: map[int]int64{1: 1}},
+				{complete: []kafka.Message{msg(0, 0)}, want: map[int]int64{0: 0}},
+			},
+		},
+		{
+			name: "redelivery resets the partition",
+			steps: []step{
+				{add: []kafka.Message{msg(0, 0), msg(0, 1)}, complete: []kafka.Message{msg(0, 1)}, want: map[int]int64{}},
+				// После ребалансировки партиция перечитывается с 0: старые ожидания сбрасываются
+				{add: []kafka.Message{msg(0, 0)}, complete: []kafka.Message{msg(0, 0)}, want: map[int]int64{0: 0}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for i, s := range tt.steps {
+				for _, m := range s.add {
+					tracker.add(m)
+				}
+				done := s.done
+				if done == nil {
+					done = make([]bool, len(s.complete))
+					for j := range done {
+						done[j] = true
+					}
+				}
+
+				got := make(map[int]int64)
+				for _, m := range tracker.complete(s.complete, done) {
+					got[m.Partition] = m.Offset
+				}
+				if !reflect.DeepEqual(got, s.want) {
+					t.Errorf("step %d: commits = %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventsStoreOffsetWithOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  kafka.Message
+	}{
+		{name: "tombstone", msg: eventMessage("o1", "", "")},
+		{name: "delete of an unknown order", msg: eventMessage("missing", EventOrderDeleted, "")},
+		{name: "cancel", msg: eventMessage("o1", EventOrderCancelled, `{"reason":"changed mind"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewMemory()
+			if err := repo.SaveOrder(testOrder("o1"), nil); err != nil {
+				t.Fatalf("SaveOrder: %v", err)
+			}
+			c := NewConsumerFromSource(nil, nil, testPolicy(1, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+			c.StoreOffsets(repo, DefaultGroupID)
+
+			msg := tt.msg
+			msg.Partition, msg.Offset = 1, 41
+			if err := c.handleMessage(context.Background(), msg); err != nil {
+				t.Fatalf("handleMessage() error = %v", err)
+			}
+
+			// Смещение сохранено вместе с изменением заказа, еще до коммита
+			offsets, err := repo.LoadOffsets(context.Background(), DefaultGroupID, "orders")
+			if err != nil {
+				t.Fatalf("LoadOffsets: %v", err)
+			}
+			if got := offsets[1]; got != 42 {
+				t.Errorf("stored offset = %d, want 42", got)
+			}
+		})
+	}
+}
+
+// failingOffsets — хранилище смещений, в котором первые failures вызовов SaveOffsets
+// завершаются ошибкой; failures < 0 — все вызовы
+type failingOffsets struct {
+	*repository.Memory
+	failures int64
+	calls    atomic.Int64
+}
+
+func (s *failingOffsets) SaveOffsets(ctx context.Context, sources []*models.Source) error {
+	if call := s.calls.Add(1); s.failures < 0 || call <= s.failures {
+		return errors.New("database is unavailable")
+	}
+	return s.Memory.SaveOffsets(ctx, sources)
+}
+
+func TestCommitStoresOffsetsBeforeKafka(t *testing.T) {
+	modes := []struct {
+		name  string
+		setup func(c *Consumer)
+	}{
+		{name: "single", setup: func(c *Consumer) {}},
+		{name: "batch", setup: func(c *Consumer) { c.SetBatch(BatchConfig{Size: 2, Wait: time.Millisecond}) }},
+		{name: "workers", setup: func(c *Consumer) {
+			c.SetWorkers(WorkerConfig{Workers: 2, Ordering: OrderingPartition, QueueSize: 1})
+		}},
+	}
+	tests := []struct {
+		name          string
+		failures      int64
+		wantHalted    bool
+		wantCommitted int64
+	}{
+		{name: "offset store recovers", failures: 1, wantCommitted: 1},
+		{name: "offset store is unavailable", failures: -1, wantHalted: true},
+	}
+
+	for _, mode := range modes {
+		for _, tt := range tests {
+			t.Run(mode.name+"/"+tt.name, func(t *testing.T) {
+				// Невалидный заказ уходит в dead-letter: его смещение записывается только при коммите
+				invalid := testOrder("bad")
+				invalid.Payment.Currency = "XXX"
+				broker := kafkatest.NewBroker()
+				broker.Produce("orders", orderMessage(t, invalid))
+
+				repo := repository.NewMemory()
+				store := &failingOffsets{Memory: repo, failures: tt.failures}
+				dlq := NewDeadLetterWriterFrom(broker.Writer("orders-dlq"), "orders-dlq")
+				c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), dlq, testPolicy(3, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+				c.StoreOffsets(store, DefaultGroupID)
+				mode.setup(c)
+				stop, result := runConsumer(t, c)
+
+				if tt.wantHalted {
+					if err := waitResult(t, result); !errors.Is(err, ErrConsumerHalted) {
+						t.Fatalf("Start() error = %v, want %v", err, ErrConsumerHalted)
+					}
+					if got := store.calls.Load(); got != 3 {
+						t.Errorf("SaveOffsets calls = %d, want 3", got)
+					}
+				} else {
+					waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 1 })
+					stop()
+					if err := waitResult(t, result); err != nil {
+						t.Fatalf("Start() error = %v, want nil", err)
+					}
+				}
+
+				if got := broker.Committed(DefaultGroupID, "orders", 0); got != tt.wantCommitted {
+					t.Errorf("kafka committed offset = %d, want %d", got, tt.wantCommitted)
+				}
+				offsets, err := repo.LoadOffsets(context.Background(), DefaultGroupID, "orders")
+				if err != nil {
+					t.Fatalf("LoadOffsets: %v", err)
+				}
+				if got := offsets[0]; got != tt.wantCommitted {
+					t.Errorf("stored offset = %d, want %d", got, tt.wantCommitted)
+				}
+				if dead := broker.Messages("orders-dlq"); len(dead) != 1 {
+					t.Errorf("dead-letter messages = %d, want 1", len(dead))
+				}
+			})
+		}
+	}
+}
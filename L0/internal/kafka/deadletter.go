@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Причины отправки сообщения в dead-letter топик
+const (
+	ReasonInvalidJSON       = "invalid_json"
+	ReasonInvalidOrder      = "invalid_order"
+	ReasonInvalidEvent      = "invalid_event"      // Событие без order_uid
+	ReasonUnknownEvent      = "unknown_event"      // Неизвестный тип события в HeaderEventType
+	ReasonUnknownOrder      = "unknown_order"      // Отмена заказа, которого нет в хранилище
+	ReasonIllegalTransition = "illegal_transition" // Переход этапа, запрещенный таблицей переходов
+)
+
+// Заголовки, которые добавляются к копии сообщения в dead-letter топике
+const (
+	HeaderDLQReason          = "x-dlq-reason"
+	HeaderDLQError           = "x-dlq-error"
+	HeaderDLQSourceTopic     = "x-dlq-source-topic"
+	HeaderDLQSourcePartition = "x-dlq-source-partition"
+	HeaderDLQSourceOffset    = "x-dlq-source-offset"
+	HeaderDLQSourceTimestamp = "x-dlq-source-timestamp"
+	HeaderDLQTimestamp       = "x-dlq-timestamp"
+)
+
+// DeadLetterWriter публикует отклоненные сообщения в dead-letter топик
+type DeadLetterWriter struct {
+	writer MessageWriter
+	topic  string
+}
+
+// NewDeadLetterWriter создает writer для dead-letter топика
+func NewDeadLetterWriter(cluster *Cluster, topic string) *DeadLetterWriter {
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP(cluster.brokers...),
+		Transport:              cluster.transport,
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+
+	return NewDeadLetterWriterFrom(w, topic)
+}
+
+// NewDeadLetterWriterFrom создает dead-letter writer поверх произвольного получателя.
+// topic используется только для логов и сообщений об ошибках.
+func NewDeadLetterWriterFrom(w MessageWriter, topic string) *DeadLetterWriter {
+	return &DeadLetterWriter{writer: w, topic: topic}
+}
+
+// Publish копирует исходное сообщение в dead-letter топик, сохраняя ключ и значение
+func (d *DeadLetterWriter) Publish(ctx context.Context, msg kafka.Message, reason string, cause error) error {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+7)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderDLQSourceTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderDLQSourceTimestamp, Value: []byte(msg.Time.UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: HeaderDLQTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())})
+	}
+
+	err := d.writer.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to dead-letter topic %s: %w", d.topic, err)
+	}
+
+	return nil
+}
+
+// Topic возвращает имя dead-letter топика
+func (d *DeadLetterWriter) Topic() string {
+	return d.topic
+}
+
+// Close закрывает writer
+func (d *DeadLetterWriter) Close() error {
+	return d.writer.Close()
+}
@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// HeaderEventType — заголовок с типом события заказа.
+// Сообщение без заголовка содержит заказ целиком.
+const HeaderEventType = "x-event-type"
+
+// Типы событий заказа
+const (
+	EventOrderCreated   = "order_created"   // Тело — заказ целиком
+	EventOrderUpdated   = "order_updated"   // Тело — заказ целиком
+	EventOrderCancelled = "order_cancelled" // Тело — CancelEvent
+	EventOrderDeleted   = "order_deleted"   // Тело пустое или {"order_uid": ...}; также tombstone
+)
+
+// CancelEvent — тело события отмены. Если order_uid не задан, берется ключ сообщения,
+// если cancelled_at не задан — время сообщения.
+type CancelEvent struct {
+	OrderUID    string     `json:"order_uid"`
+	Reason      string     `json:"reason"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// messageEvent возвращает тип события сообщения.
+// Tombstone (пустое значение) означает удаление заказа с UID из ключа.
+func messageEvent(msg kafka.Message) string {
+	if len(msg.Value) == 0 {
+		return EventOrderDeleted
+	}
+	for _, h := range msg.Headers {
+		if h.Key == HeaderEventType {
+			return string(h.Value)
+		}
+	}
+	return EventOrderUpdated
+}
+
+// isOrderWrite сообщает, содержит ли событие заказ для сохранения
+func isOrderWrite(event string) bool {
+	return event == EventOrderCreated || event == EventOrderUpdated
+}
+
+// processEvent применяет событие, которое не содержит заказ: отмену или удаление
+func (c *Consumer) processEvent(ctx context.Context, msg kafka.Message, event string) error {
+	switch event {
+	case EventOrderCancelled:
+		return c.processCancel(ctx, msg)
+	case EventOrderDeleted:
+		return c.processDelete(ctx, msg)
+	default:
+		log.Printf("level=warn component=kafka_consumer event=unknown_event partition=%d offset=%d event_type=%q", msg.Partition, msg.Offset, event)
+		return c.deadLetter(ctx, msg, ReasonUnknownEvent, fmt.Errorf("unknown event type %q", event))
+	}
+}
+
+// processCancel отмечает заказ отмененным и обновляет его в кеше.
+// Отмена неизвестного заказа отправляется в dead-letter топик.
+func (c *Consumer) processCancel(ctx context.Context, msg kafka.Message) error {
+	var ev CancelEvent
+	if err := json.Unmarshal(msg.Value, &ev); err != nil {
+		log.Printf("level=warn component=kafka_consumer event=invalid_json partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
+		return c.deadLetter(ctx, msg, ReasonInvalidJSON, err)
+	}
+	orderUID := eventOrderUID(msg, ev.OrderUID)
+	if orderUID == "" {
+		return c.rejectEvent(ctx, msg)
+	}
+
+	at := msg.Time
+	if ev.CancelledAt != nil {
+		at = *ev.CancelledAt
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	order, err := c.repo.CancelOrder(orderUID, ev.Reason, at, c.messageSource(msg))
+	if errors.Is(err, models.ErrOrderNotFound) {
+		log.Printf("level=warn component=kafka_consumer event=cancel_unknown_order partition=%d offset=%d order_uid=%q", msg.Partition, msg.Offset, orderUID)
+		return c.deadLetter(ctx, msg, ReasonUnknownOrder, err)
+	}
+	if errors.Is(err, models.ErrIllegalTransition) {
+		return c.rejectTransition(ctx, msg, orderUID, err)
+	}
+	if err != nil {
+		log.Printf("level=error component=kafka_consumer event=db_cancel_failed partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, orderUID, err)
+		return err
+	}
+
+	c.cache.Set(orderUID, order)
+
+	metrics.ConsumerMessages.WithLabelValues(metrics.ResultCancelled).Inc()
+	log.Printf("level=info component=kafka_consumer event=order_cancelled partition=%d offset=%d order_uid=%q reason=%q", msg.Partition, msg.Offset, orderUID, order.CancelReason)
+	return nil
+}
+
+// processDelete удаляет заказ вместе с доставкой, оплатой и товарами и убирает его из кеша.
+// Удаление отсутствующего заказа не считается ошибкой: событие могло быть прочитано повторно.
+func (c *Consumer) processDelete(ctx context.Context, msg kafka.Message) error {
+	var body struct {
+		OrderUID string `json:"order_uid"`
+	}
+	if len(msg.Value) > 0 {
+		if err := json.Unmarshal(msg.Value, &body); err != nil {
+			log.Printf("level=warn component=kafka_consumer event=invalid_json partition=%d offset=%d err=%v", msg.Partition, msg.Offset, err)
+			return c.deadLetter(ctx, msg, ReasonInvalidJSON, err)
+		}
+	}
+	orderUID := eventOrderUID(msg, body.OrderUID)
+	if orderUID == "" {
+		return c.rejectEvent(ctx, msg)
+	}
+
+	err := c.repo.DeleteOrder(orderUID, c.messageSource(msg))
+	if err != nil && !errors.Is(err, models.ErrOrderNotFound) {
+		log.Printf("level=error component=kafka_consumer event=db_delete_failed partition=%d offset=%d order_uid=%q err=%v", msg.Partition, msg.Offset, orderUID, err)
+		return err
+	}
+	found := err == nil
+
+	c.cache.Delete(orderUID)
+
+	metrics.ConsumerMessages.WithLabelValues(metrics.ResultDeleted).Inc()
+	log.Printf("level=info component=kafka_consumer event=order_deleted partition=%d offset=%d order_uid=%q tombstone=%t found=%t", msg.Partition, msg.Offset, orderUID, len(msg.Value) == 0, found)
+	return nil
+}
+
+// eventOrderUID возвращает UID заказа из тела события или, если его нет, из ключа сообщения
+func eventOrderUID(msg kafka.Message, bodyUID string) string {
+	if bodyUID != "" {
+		return bodyUID
+	}
+	return string(msg.Key)
+}
+
+// rejectEvent отправляет в dead-letter топик событие без UID заказа
+func (c *Consumer) rejectEvent(ctx context.Context, msg kafka.Message) error {
+	log.Printf("level=warn component=kafka_consumer event=invalid_event partition=%d offset=%d msg=\"order_uid is missing in body and key\"", msg.Partition, msg.Offset)
+	return c.deadLetter(ctx, msg, ReasonInvalidEvent, errors.New("order_uid is required"))
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FetchConfig задает параметры чтения топика, общие для consumer, источника
+// со смещениями из хранилища заказов и повторного чтения
+type FetchConfig struct {
+	GroupID        string        // Группа consumer
+	MinBytes       int           // Минимальный размер ответа брокера
+	MaxBytes       int           // Максимальный размер ответа брокера
+	CommitInterval time.Duration // Период коммита смещений группы, 0 — синхронный коммит
+}
+
+// DefaultFetchConfig возвращает параметры чтения по умолчанию
+func DefaultFetchConfig() FetchConfig {
+	return FetchConfig{
+		GroupID:        DefaultGroupID,
+		MinBytes:       10e3, // 10KB
+		MaxBytes:       10e6, // 10MB
+		CommitInterval: time.Second,
+	}
+}
+
+// Validate проверяет корректность конфигурации
+func (f FetchConfig) Validate() error {
+	if f.GroupID == "" {
+		return errors.New("group id must not be empty")
+	}
+	if f.MinBytes < 1 {
+		return fmt.Errorf("fetch min bytes must be >= 1, got %d", f.MinBytes)
+	}
+	if f.MaxBytes < f.MinBytes {
+		return fmt.Errorf("fetch max bytes must be >= min bytes (%d), got %d", f.MinBytes, f.MaxBytes)
+	}
+	if f.CommitInterval < 0 {
+		return fmt.Errorf("commit interval must be >= 0, got %s", f.CommitInterval)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package kafkatest содержит in-process брокер для тестов consumer без сети.
+//
+// Broker хранит топики с партициями и смещения, закоммиченные группами.
+// Reader реализует kafka.MessageSource: читает партиции с закоммиченных смещений,
+// а Rewind имитирует ребалансировку, после которой незакоммиченные сообщения
+// доставляются повторно. Writer реализует kafka.MessageWriter.
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrClosed возвращается при работе с закрытым Reader или Writer
+var ErrClosed = errors.New("kafkatest: closed")
+
+// Broker — in-process брокер
+type Broker struct {
+	mu        sync.Mutex
+	topics    map[string][][]kafka.Message
+	committed map[offsetKey]int64
+	produced  chan struct{} // закрывается и пересоздается при каждой записи
+}
+
+type offsetKey struct {
+	group     string
+	topic     string
+	partition int
+}
+
+// NewBroker создает пустой брокер
+func NewBroker() *Broker {
+	return &Broker{
+		topics:    make(map[string][][]kafka.Message),
+		committed: make(map[offsetKey]int64),
+		produced:  make(chan struct{}),
+	}
+}
+
+// CreateTopic создает топик с указанным числом партиций
+func (b *Broker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[topic]; !ok {
+		b.topics[topic] = make([][]kafka.Message, partitions)
+	}
+}
+
+// Produce записывает сообщения в топик. Партиция выбирается по хешу ключа,
+// сообщения без ключа попадают в партицию 0. Топик создается с одной партицией,
+// если его нет.
+func (b *Broker) Produce(topic string, msgs ...kafka.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	partitions := b.ensureTopic(topic)
+	for _, msg := range msgs {
+		partition := 0
+		if len(msg.Key) > 0 {
+			h := fnv.New32a()
+			h.Write(msg.Key)
+			partition = int(h.Sum32() % uint32(len(partitions)))
+		}
+		b.append(topic, partition, msg)
+	}
+}
+
+// ProduceTo записывает сообщение в конкретную партицию
+func (b *Broker) ProduceTo(topic string, partition int, msg kafka.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	partitions := b.ensureTopic(topic)
+	if partition < 0 || partition >= len(partitions) {
+		return fmt.Errorf("kafkatest: topic %s has no partition %d", topic, partition)
+	}
+	b.append(topic, partition, msg)
+	return nil
+}
+
+// Messages возвращает копию всех сообщений топика по порядку партиций и смещений
+func (b *Broker) Messages(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var result []kafka.Message
+	for _, partition := range b.topics[topic] {
+		result = append(result, partition...)
+	}
+	return result
+}
+
+// Committed возвращает следующее смещение, закоммиченное группой для партиции
+func (b *Broker) Committed(group, topic string, partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.committed[offsetKey{group, topic, partition}]
+}
+
+// Reader создает источник сообщений для группы
+func (b *Broker) Reader(group, topic string) *Reader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ensureTopic(topic)
+	r := &Reader{broker: b, group: group, topic: topic}
+	r.rewind()
+	return r
+}
+
+// Writer создает получателя сообщений для топика
+func (b *Broker) Writer(topic string) *Writer {
+	return &Writer{broker: b, topic: topic}
+}
+
+// ensureTopic возвращает партиции топика, создавая его при необходимости; вызывается под блокировкой
+func (b *Broker) ensureTopic(topic string) [][]kafka.Message {
+	if _, ok := b.topics[topic]; !ok {
+		b.topics[topic] = make([][]kafka.Message, 1)
+	}
+	return b.topics[topic]
+}
+
+// append добавляет сообщение в партицию и будит ожидающих читателей; вызывается под блокировкой
+func (b *Broker) append(topic string, partition int, msg kafka.Message) {
+	msg.Topic = topic
+	msg.Partition = partition
+	msg.Offset = int64(len(b.topics[topic][partition]))
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	b.topics[topic][partition] = append(b.topics[topic][partition], msg)
+
+	close(b.produced)
+	b.produced = make(chan struct{})
+}
+
+// Reader читает сообщения топика от имени группы
+type Reader struct {
+	broker    *Broker
+	group     string
+	topic     string
+	positions map[int]int64
+	next      int // партиция, с которой начинается следующий обход
+	fetchErrs []error
+	closed    bool
+}
+
+// FetchMessage возвращает следующее сообщение, обходя партиции по кругу.
+// Блокируется, пока сообщение не появится или не отменится контекст.
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		r.broker.mu.Lock()
+		if r.closed {
+			r.broker.mu.Unlock()
+			return kafka.Message{}, ErrClosed
+		}
+		if len(r.fetchErrs) > 0 {
+			err := r.fetchErrs[0]
+			r.fetchErrs = r.fetchErrs[1:]
+			r.broker.mu.Unlock()
+			return kafka.Message{}, err
+		}
+
+		partitions := r.broker.topics[r.topic]
+		for i := 0; i < len(partitions); i++ {
+			p := (r.next + i) % len(partitions)
+			pos := r.positions[p]
+			if pos < int64(len(partitions[p])) {
+				msg := partitions[p][pos]
+				msg.HighWaterMark = int64(len(partitions[p]))
+				r.positions[p] = pos + 1
+				r.next = (p + 1) % len(partitions)
+				r.broker.mu.Unlock()
+				return msg, nil
+			}
+		}
+		wait := r.broker.produced
+		r.broker.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// CommitMessages фиксирует смещения сообщений для группы; смещение не уменьшается
+func (r *Reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	for _, msg := range msgs {
+		key := offsetKey{r.group, msg.Topic, msg.Partition}
+		if next := msg.Offset + 1; next > r.broker.committed[key] {
+			r.broker.committed[key] = next
+		}
+	}
+	return nil
+}
+
+// Rewind возвращает позиции чтения к закоммиченным смещениям, как после ребалансировки
+func (r *Reader) Rewind() {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+	r.rewind()
+}
+
+// FailFetch заставляет следующие вызовы FetchMessage вернуть указанные ошибки по очереди
+func (r *Reader) FailFetch(errs ...error) {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+	r.fetchErrs = append(r.fetchErrs, errs...)
+}
+
+// Close закрывает Reader; незакоммиченные сообщения будут доставлены новому Reader группы
+func (r *Reader) Close() error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// rewind вызывается под блокировкой брокера
+func (r *Reader) rewind() {
+	r.positions = make(map[int]int64)
+	for p := range r.broker.topics[r.topic] {
+		r.positions[p] = r.broker.committed[offsetKey{r.group, r.topic, p}]
+	}
+}
+
+// Writer записывает сообщения в топик брокера
+type Writer struct {
+	broker *Broker
+	topic  string
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// WriteMessages записывает сообщения в топик Writer
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.broker.Produce(w.topic, msgs...)
+	return nil
+}
+
+// FailWrites заставляет WriteMessages возвращать err; nil снимает отказ
+func (w *Writer) FailWrites(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// Close закрывает Writer
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
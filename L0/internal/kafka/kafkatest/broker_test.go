@@ -0,0 +1,206 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func message(key, value string) kafka.Message {
+	return kafka.Message{Key: []byte(key), Value: []byte(value)}
+}
+
+// fetch читает сообщение с таймаутом, чтобы тест не зависал на пустом топике
+func fetch(t *testing.T, r *Reader) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := r.FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("FetchMessage: %v", err)
+	}
+	return msg
+}
+
+func TestProducePartitionsByKey(t *testing.T) {
+	b := NewBroker()
+	b.CreateTopic("orders", 3)
+	b.Produce("orders", message("o1", "v1"), message("o2", "v2"), message("o1", "v3"), message("", "v4"))
+
+	partitionOf := make(map[string]int)
+	offsets := make(map[int]int64)
+	for _, msg := range b.Messages("orders") {
+		if msg.Topic != "orders" {
+			t.Errorf("topic = %q, want orders", msg.Topic)
+		}
+		if msg.Offset != offsets[msg.Partition] {
+			t.Errorf("partition %d: offset = %d, want %d", msg.Partition, msg.Offset, offsets[msg.Partition])
+		}
+		offsets[msg.Partition]++
+
+		key := string(msg.Key)
+		if key == "" && msg.Partition != 0 {
+			t.Errorf("message without key in partition %d, want 0", msg.Partition)
+		}
+		if p, ok := partitionOf[key]; ok && p != msg.Partition {
+			t.Errorf("key %q in partitions %d and %d", key, p, msg.Partition)
+		}
+		partitionOf[key] = msg.Partition
+	}
+
+	if err := b.ProduceTo("orders", 2, message("o3", "v5")); err != nil {
+		t.Errorf("ProduceTo(2) error = %v", err)
+	}
+	if err := b.ProduceTo("orders", 3, message("o3", "v6")); err == nil {
+		t.Error("ProduceTo(3) error = nil, want missing partition error")
+	}
+}
+
+func TestReaderPositions(t *testing.T) {
+	tests := []struct {
+		name       string
+		commit     int // Число прочитанных сообщений, подтверждаемых группой
+		read       int // Число прочитанных сообщений
+		reopen     func(b *Broker, r *Reader) *Reader
+		wantOffset int64
+	}{
+		{
+			name:       "reader continues after uncommitted messages",
+			read:       2,
+			reopen:     func(b *Broker, r *Reader) *Reader { return r },
+			wantOffset: 2,
+		},
+		{
+			name:       "rewind returns to the committed offset",
+			read:       2,
+			commit:     1,
+			reopen:     func(b *Broker, r *Reader) *Reader { r.Rewind(); return r },
+			wantOffset: 1,
+		},
+		{
+			name:   "new reader of the group starts at the committed offset",
+			read:   3,
+			commit: 2,
+			reopen: func(b *Broker, r *Reader) *Reader {
+				r.Close()
+				return b.Reader("group", "orders")
+			},
+			wantOffset: 2,
+		},
+		{
+			name:       "another group reads from the beginning",
+			read:       3,
+			commit:     3,
+			reopen:     func(b *Broker, r *Reader) *Reader { return b.Reader("other", "orders") },
+			wantOffset: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroker()
+			b.Produce("orders", message("", "v0"), message("", "v1"), message("", "v2"), message("", "v3"))
+			r := b.Reader("group", "orders")
+
+			var read []kafka.Message
+			for i := 0; i < tt.read; i++ {
+				read = append(read, fetch(t, r))
+			}
+			if tt.commit > 0 {
+				if err := r.CommitMessages(context.Background(), read[tt.commit-1]); err != nil {
+					t.Fatalf("CommitMessages: %v", err)
+				}
+			}
+			if got := b.Committed("group", "orders", 0); got != int64(tt.commit) {
+				t.Errorf("committed = %d, want %d", got, tt.commit)
+			}
+
+			msg := fetch(t, tt.reopen(b, r))
+			if msg.Offset != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", msg.Offset, tt.wantOffset)
+			}
+			if msg.HighWaterMark != 4 {
+				t.Errorf("high watermark = %d, want 4", msg.HighWaterMark)
+			}
+		})
+	}
+}
+
+func TestCommitDoesNotMoveBack(t *testing.T) {
+	b := NewBroker()
+	b.Produce("orders", message("", "v0"), message("", "v1"))
+	r := b.Reader("group", "orders")
+	first, second := fetch(t, r), fetch(t, r)
+
+	if err := r.CommitMessages(context.Background(), second, first); err != nil {
+		t.Fatalf("CommitMessages: %v", err)
+	}
+	if got := b.Committed("group", "orders", 0); got != 2 {
+		t.Errorf("committed = %d, want 2", got)
+	}
+}
+
+func TestFetchWaitsForProduce(t *testing.T) {
+	b := NewBroker()
+	r := b.Reader("group", "orders")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Produce("orders", message("o1", "v1"))
+	}()
+	if msg := fetch(t, r); string(msg.Value) != "v1" {
+		t.Errorf("value = %q, want v1", msg.Value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.FetchMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FetchMessage() on an empty topic error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestInjectedFailures(t *testing.T) {
+	b := NewBroker()
+	b.Produce("orders", message("o1", "v1"))
+	errFetch := errors.New("fetch failed")
+	errWrite := errors.New("write failed")
+
+	r := b.Reader("group", "orders")
+	r.FailFetch(errFetch, errFetch)
+	for i := 0; i < 2; i++ {
+		if _, err := r.FetchMessage(context.Background()); !errors.Is(err, errFetch) {
+			t.Fatalf("FetchMessage() #%d error = %v, want %v", i+1, err, errFetch)
+		}
+	}
+	if msg := fetch(t, r); msg.Offset != 0 {
+		t.Errorf("offset after failures = %d, want 0", msg.Offset)
+	}
+
+	w := b.Writer("orders-dlq")
+	w.FailWrites(errWrite)
+	if err := w.WriteMessages(context.Background(), message("o1", "v1")); !errors.Is(err, errWrite) {
+		t.Errorf("WriteMessages() error = %v, want %v", err, errWrite)
+	}
+	w.FailWrites(nil)
+	if err := w.WriteMessages(context.Background(), message("o1", "v1")); err != nil {
+		t.Errorf("WriteMessages() error = %v, want nil", err)
+	}
+	if got := len(b.Messages("orders-dlq")); got != 1 {
+		t.Errorf("dlq messages = %d, want 1", got)
+	}
+
+	r.Close()
+	w.Close()
+	if _, err := r.FetchMessage(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("FetchMessage() after Close error = %v, want %v", err, ErrClosed)
+	}
+	if err := r.CommitMessages(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("CommitMessages() after Close error = %v, want %v", err, ErrClosed)
+	}
+	if err := w.WriteMessages(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteMessages() after Close error = %v, want %v", err, ErrClosed)
+	}
+}
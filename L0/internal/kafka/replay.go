@@ -0,0 +1,364 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrReplayRunning возвращается, если повторное чтение уже выполняется
+var ErrReplayRunning = errors.New("replay is already running")
+
+// ReplayRequest описывает окно топика для повторного чтения.
+// Начало задается смещением или временем, конец — смещением (включительно), временем
+// (включительно) или не задается: тогда чтение идет до конца партиции на момент запуска.
+// Без Overwrite сообщение пропускается, если у его заказа уже есть ревизия из этого или более
+// позднего сообщения партиции: иначе старая версия заказа заменила бы более новую, а переходы
+// этапов назад ушли бы в dead-letter топик. Сообщения, отклоненные ранее, ревизий не оставляют
+// и применяются. Overwrite применяет все окно; в dry-run ничего не сохраняется.
+type ReplayRequest struct {
+	Partitions []int      `json:"partitions,omitempty"` // Пустой список — все партиции
+	FromOffset *int64     `json:"from_offset,omitempty"`
+	FromTime   *time.Time `json:"from_time,omitempty"`
+	ToOffset   *int64     `json:"to_offset,omitempty"`
+	ToTime     *time.Time `json:"to_time,omitempty"`
+	DryRun     bool       `json:"dry_run"`   // Только разбор и валидация, без сохранения и dead-letter
+	Overwrite  bool       `json:"overwrite"` // Применять и сообщения, уже сохраненные в ревизиях заказов
+}
+
+// Validate проверяет корректность запроса
+func (r ReplayRequest) Validate() error {
+	if (r.FromOffset == nil) == (r.FromTime == nil) {
+		return errors.New("exactly one of from_offset and from_time is required")
+	}
+	if r.ToOffset != nil && r.ToTime != nil {
+		return errors.New("to_offset and to_time are mutually exclusive")
+	}
+	if r.FromOffset != nil && *r.FromOffset < 0 {
+		return fmt.Errorf("from_offset must be >= 0, got %d", *r.FromOffset)
+	}
+	if r.FromOffset != nil && r.ToOffset != nil && *r.ToOffset < *r.FromOffset {
+		return errors.New("to_offset must not be less than from_offset")
+	}
+	if r.FromTime != nil && r.ToTime != nil && r.ToTime.Before(*r.FromTime) {
+		return errors.New("to_time must not be before from_time")
+	}
+	for _, p := range r.Partitions {
+		if p < 0 {
+			return fmt.Errorf("invalid partition %d", p)
+		}
+	}
+	return nil
+}
+
+// ReplayResult — итог повторного чтения
+type ReplayResult struct {
+	DryRun     bool              `json:"dry_run"`
+	Partitions []PartitionReplay `json:"partitions"`
+	Duration   string            `json:"duration"`
+}
+
+// PartitionReplay — итог повторного чтения одной партиции
+type PartitionReplay struct {
+	Partition int   `json:"partition"`
+	From      int64 `json:"from"` // Первое прочитанное смещение
+	To        int64 `json:"to"`   // Смещение, на котором чтение остановлено (не включительно)
+	Messages  int   `json:"messages"`
+	Skipped   int   `json:"skipped"`  // Уже примененные к заказам, пропущены без overwrite
+	Valid     int   `json:"valid"`    // Прошли разбор и валидацию
+	Rejected  int   `json:"rejected"` // Не прошли разбор или валидацию
+	Events    int   `json:"events"`   // События отмены и удаления
+}
+
+// ReplaySource дает доступ к партициям топика без группы consumer
+type ReplaySource interface {
+	// Partitions возвращает номера партиций топика
+	Partitions(ctx context.Context) ([]int, error)
+	// Bounds возвращает первое доступное смещение и смещение следующего сообщения партиции
+	Bounds(ctx context.Context, partition int) (first, last int64, err error)
+	// OffsetAt возвращает смещение первого сообщения не раньше t
+	OffsetAt(ctx context.Context, partition int, t time.Time) (int64, error)
+	// Open открывает чтение партиции с указанного смещения
+	Open(partition int, offset int64) (MessageSource, error)
+}
+
+// DefaultReplayIdleTimeout — сколько ждать следующего сообщения, прежде чем считать
+// партицию прочитанной. В компактированных и транзакционных топиках последние смещения
+// окна могут не содержать сообщений (удалены или заняты маркерами транзакций).
+const DefaultReplayIdleTimeout = 5 * time.Second
+
+// Replayer повторно прочитывает окно топика отдельным reader'ом
+// и пропускает сообщения через обработку consumer
+type Replayer struct {
+	consumer *Consumer
+	source   ReplaySource
+	idle     time.Duration
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewReplayer создает повторное чтение с обработкой consumer c
+func NewReplayer(c *Consumer, source ReplaySource) *Replayer {
+	return &Replayer{consumer: c, source: source, idle: DefaultReplayIdleTimeout}
+}
+
+// Replay читает партиции по очереди. Смещения группы не коммитятся и не сохраняются.
+// Одновременно выполняется только одно повторное чтение.
+func (r *Replayer) Replay(ctx context.Context, req ReplayRequest) (*ReplayResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return nil, ErrReplayRunning
+	}
+	r.running = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	start := time.Now()
+	partitions := req.Partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = r.source.Partitions(ctx); err != nil {
+			return nil, fmt.Errorf("failed to list partitions: %w", err)
+		}
+	}
+	sort.Ints(partitions)
+
+	log.Printf("level=info component=kafka_replay event=start partitions=%v dry_run=%t overwrite=%t", partitions, req.DryRun, req.Overwrite)
+
+	result := &ReplayResult{DryRun: req.DryRun}
+	for _, partition := range partitions {
+		pr, err := r.replayPartition(ctx, partition, req)
+		if pr != nil {
+			result.Partitions = append(result.Partitions, *pr)
+		}
+		if err != nil {
+			result.Duration = time.Since(start).String()
+			return result, err
+		}
+	}
+	result.Duration = time.Since(start).String()
+
+	log.Printf("level=info component=kafka_replay event=done partitions=%d duration=%s", len(result.Partitions), result.Duration)
+	return result, nil
+}
+
+// replayPartition читает одну партицию от начала окна до его конца
+func (r *Replayer) replayPartition(ctx context.Context, partition int, req ReplayRequest) (*PartitionReplay, error) {
+	first, last, err := r.source.Bounds(ctx, partition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bounds of partition %d: %w", partition, err)
+	}
+
+	from := first
+	if req.FromOffset != nil {
+		from = max(*req.FromOffset, first)
+	} else if from, err = r.source.OffsetAt(ctx, partition, *req.FromTime); err != nil {
+		return nil, fmt.Errorf("failed to find offset of partition %d at %s: %w", partition, req.FromTime.Format(time.RFC3339), err)
+	}
+	if from < 0 || from > last {
+		from = last // Нет сообщений после from_time
+	}
+
+	end := last // Не включительно
+	if req.ToOffset != nil && *req.ToOffset+1 < end {
+		end = *req.ToOffset + 1
+	}
+
+	pr := &PartitionReplay{Partition: partition, From: from, To: from}
+	log.Printf("level=info component=kafka_replay event=partition_start partition=%d from=%d end=%d", partition, from, end)
+	if from >= end {
+		return pr, nil
+	}
+
+	reader, err := r.source.Open(partition, from)
+	if err != nil {
+		return pr, fmt.Errorf("failed to open partition %d: %w", partition, err)
+	}
+	defer reader.Close()
+
+	// Копия consumer с отдельным reader'ом: та же обработка, но без смещений группы
+	processor := *r.consumer
+	processor.reader = reader
+	processor.offsets, processor.group = nil, ""
+
+	for pr.To < end {
+		fetchCtx, cancel := context.WithTimeout(ctx, r.idle)
+		msg, err := processor.fetch(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return pr, ctx.Err()
+			}
+			// Сообщений нет дольше r.idle: оставшиеся смещения окна пусты
+			log.Printf("level=info component=kafka_replay event=partition_idle partition=%d to=%d end=%d idle=%s", partition, pr.To, end, r.idle)
+			break
+		}
+		// После пропуска смещений (компактирование, маркеры транзакций) reader может выйти за окно
+		if msg.Offset >= end || (req.ToTime != nil && msg.Time.After(*req.ToTime)) {
+			break
+		}
+
+		pr.Messages++
+		if err := processor.replayMessage(ctx, msg, req, pr); err != nil {
+			return pr, fmt.Errorf("partition %d offset %d: %w", partition, msg.Offset, err)
+		}
+		pr.To = msg.Offset + 1
+
+		// Прочитано все, что есть в партиции: дальше сообщений нет
+		if msg.HighWaterMark > 0 && pr.To >= msg.HighWaterMark {
+			break
+		}
+	}
+
+	log.Printf("level=info component=kafka_replay event=partition_done partition=%d from=%d to=%d messages=%d skipped=%d valid=%d rejected=%d events=%d", partition, pr.From, pr.To, pr.Messages, pr.Skipped, pr.Valid, pr.Rejected, pr.Events)
+	return pr, nil
+}
+
+// replayMessage обрабатывает сообщение как consumer; в dry-run только разбирает и проверяет его
+func (c *Consumer) replayMessage(ctx context.Context, msg kafka.Message, req ReplayRequest, pr *PartitionReplay) error {
+	dryRun := req.DryRun
+	if !dryRun && !req.Overwrite {
+		applied, err := c.applied(msg)
+		if err != nil {
+			return err
+		}
+		if applied {
+			pr.Skipped++
+			return nil
+		}
+	}
+
+	if !isOrderWrite(messageEvent(msg)) {
+		pr.Events++
+		if dryRun {
+			c.logMessage(msg)
+			return nil
+		}
+		return c.handleMessage(ctx, msg)
+	}
+
+	if dryRun {
+		c.logMessage(msg)
+		if _, _, err := c.decode(msg); err != nil {
+			pr.Rejected++
+		} else {
+			pr.Valid++
+		}
+		return nil
+	}
+
+	// Итог проверки нужен только для отчета; сохранение и dead-letter выполняет handleMessage
+	if _, _, err := c.parseOrder(msg); err != nil {
+		pr.Rejected++
+	} else {
+		pr.Valid++
+	}
+	return c.handleMessage(ctx, msg)
+}
+
+// applied сообщает, есть ли у заказа сообщения ревизия из этого или более позднего сообщения той же партиции
+func (c *Consumer) applied(msg kafka.Message) (bool, error) {
+	var body struct {
+		OrderUID string `json:"order_uid"`
+	}
+	_ = json.Unmarshal(msg.Value, &body) // Пустое или битое тело: UID берется из ключа
+	orderUID := eventOrderUID(msg, body.OrderUID)
+	if orderUID == "" {
+		return false, nil
+	}
+
+	revisions, err := c.repo.GetOrderRevisions(orderUID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get revisions of order %s: %w", orderUID, err)
+	}
+	for _, rev := range revisions {
+		if s := rev.Source; s != nil && s.Topic == msg.Topic && s.Partition == msg.Partition && s.Offset >= msg.Offset {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// kafkaReplaySource читает партиции напрямую с брокера
+type kafkaReplaySource struct {
+	cluster *Cluster
+	topic   string
+	fetch   FetchConfig
+}
+
+// NewReplaySource создает источник повторного чтения топика без группы consumer;
+// из fetch используются размеры ответа брокера
+func NewReplaySource(cluster *Cluster, topic string, fetch FetchConfig) ReplaySource {
+	return &kafkaReplaySource{cluster: cluster, topic: topic, fetch: fetch}
+}
+
+func (s *kafkaReplaySource) Partitions(ctx context.Context) ([]int, error) {
+	conn, err := s.cluster.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(s.topic)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+func (s *kafkaReplaySource) Bounds(ctx context.Context, partition int) (int64, int64, error) {
+	conn, err := s.cluster.dialLeader(ctx, s.topic, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	return conn.ReadOffsets()
+}
+
+func (s *kafkaReplaySource) OffsetAt(ctx context.Context, partition int, t time.Time) (int64, error) {
+	conn, err := s.cluster.dialLeader(ctx, s.topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return conn.ReadOffset(t)
+}
+
+func (s *kafkaReplaySource) Open(partition int, offset int64) (MessageSource, error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   s.cluster.brokers,
+		Dialer:    s.cluster.dialer,
+		Topic:     s.topic,
+		Partition: partition,
+		MinBytes:  s.fetch.MinBytes,
+		MaxBytes:  s.fetch.MaxBytes,
+	})
+	if err := r.SetOffset(offset); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,273 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"order-service/internal/cache"
+	"order-service/internal/kafka/kafkatest"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// gapSource — партиция 0 с пропусками смещений, как в компактированном или транзакционном топике.
+// last может быть больше смещения последнего сообщения: хвост партиции занят маркерами транзакций.
+type gapSource struct {
+	messages      []kafka.Message
+	last          int64
+	highWaterMark int64
+}
+
+func (s *gapSource) Partitions(context.Context) ([]int, error) { return []int{0}, nil }
+
+func (s *gapSource) Bounds(context.Context, int) (int64, int64, error) { return 0, s.last, nil }
+
+func (s *gapSource) OffsetAt(_ context.Context, _ int, t time.Time) (int64, error) {
+	for _, msg := range s.messages {
+		if !msg.Time.Before(t) {
+			return msg.Offset, nil
+		}
+	}
+	return -1, nil
+}
+
+func (s *gapSource) Open(_ int, offset int64) (MessageSource, error) {
+	var msgs []kafka.Message
+	for _, msg := range s.messages {
+		if msg.Offset >= offset {
+			msg.HighWaterMark = s.highWaterMark
+			msgs = append(msgs, msg)
+		}
+	}
+	return &sliceSource{msgs: msgs}, nil
+}
+
+// sliceSource отдает сообщения по порядку, затем блокируется до отмены контекста
+type sliceSource struct {
+	msgs []kafka.Message
+}
+
+func (s *sliceSource) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(s.msgs) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func (s *sliceSource) CommitMessages(context.Context, ...kafka.Message) error { return nil }
+
+func (s *sliceSource) Close() error { return nil }
+
+// cityMessage возвращает сообщение партиции 0 с заказом o1, доставленным в город city
+func cityMessage(t *testing.T, offset int64, city string) kafka.Message {
+	o := testOrder("o1")
+	o.Delivery.City = city
+	msg := orderMessage(t, o)
+	msg.Offset = offset
+	return msg
+}
+
+func TestReplayPartitionEnd(t *testing.T) {
+	offset := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name         string
+		offsets      []int64
+		last         int64
+		hwm          int64
+		toOffset     *int64
+		wantTo       int64
+		wantMessages int
+	}{
+		{
+			name:         "contiguous partition",
+			offsets:      []int64{0, 1, 2},
+			last:         3,
+			hwm:          3,
+			wantTo:       3,
+			wantMessages: 3,
+		},
+		{
+			name:         "empty offsets at the end of the window",
+			offsets:      []int64{0, 1, 3},
+			last:         6,
+			hwm:          6,
+			wantTo:       4,
+			wantMessages: 3,
+		},
+		{
+			name:         "high watermark reached before the reported end",
+			offsets:      []int64{0, 1, 2},
+			last:         10,
+			hwm:          3,
+			wantTo:       3,
+			wantMessages: 3,
+		},
+		{
+			name:         "gap jumps past to_offset",
+			offsets:      []int64{0, 1, 5},
+			last:         6,
+			hwm:          6,
+			toOffset:     offset(3),
+			wantTo:       2,
+			wantMessages: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &gapSource{last: tt.last, highWaterMark: tt.hwm}
+			for _, o := range tt.offsets {
+				source.messages = append(source.messages, cityMessage(t, o, "Haifa"))
+			}
+			c := NewConsumerFromSource(nil, nil, testPolicy(1, ExhaustedHalt), repository.NewMemory(), cache.New(cache.DefaultConfig()), nil)
+			r := NewReplayer(c, source)
+			r.idle = 50 * time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result, err := r.Replay(ctx, ReplayRequest{FromOffset: offset(0), ToOffset: tt.toOffset, DryRun: true})
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+
+			pr := result.Partitions[0]
+			if pr.To != tt.wantTo || pr.Messages != tt.wantMessages {
+				t.Errorf("to = %d, messages = %d; want %d, %d", pr.To, pr.Messages, tt.wantTo, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestReplaySkipsAppliedMessages(t *testing.T) {
+	from := int64(0)
+
+	tests := []struct {
+		name        string
+		source      *models.Source // Источник сохраненной версии заказа
+		overwrite   bool
+		wantSkipped int
+		wantCity    string
+	}{
+		{name: "revision offset limits the window", source: &models.Source{Topic: "orders", Offset: 1}, wantSkipped: 2, wantCity: "Haifa"},
+		{name: "order saved without source", wantCity: "Haifa"},
+		{name: "revision from another partition", source: &models.Source{Topic: "orders", Partition: 1, Offset: 5}, wantCity: "Haifa"},
+		{name: "whole window is already applied", source: &models.Source{Topic: "orders", Offset: 2}, wantSkipped: 3, wantCity: "Eilat"},
+		{name: "overwrite applies the whole window", source: &models.Source{Topic: "orders", Offset: 2}, overwrite: true, wantCity: "Haifa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &gapSource{
+				messages:      []kafka.Message{cityMessage(t, 0, "Tel Aviv"), cityMessage(t, 1, "Acre"), cityMessage(t, 2, "Haifa")},
+				last:          3,
+				highWaterMark: 3,
+			}
+
+			repo := repository.NewMemory()
+			current := testOrder("o1")
+			current.Delivery.City = "Eilat"
+			if err := repo.SaveOrder(current, tt.source); err != nil {
+				t.Fatalf("SaveOrder: %v", err)
+			}
+			c := NewConsumerFromSource(nil, nil, testPolicy(1, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+
+			result, err := NewReplayer(c, source).Replay(context.Background(), ReplayRequest{FromOffset: &from, Overwrite: tt.overwrite})
+			if err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+
+			pr := result.Partitions[0]
+			if pr.Skipped != tt.wantSkipped || pr.Messages != 3 {
+				t.Errorf("skipped = %d, messages = %d; want %d, 3", pr.Skipped, pr.Messages, tt.wantSkipped)
+			}
+			stored, err := repo.GetOrder("o1")
+			if err != nil {
+				t.Fatalf("GetOrder: %v", err)
+			}
+			if stored.Delivery.City != tt.wantCity {
+				t.Errorf("delivery.city = %q, want %q", stored.Delivery.City, tt.wantCity)
+			}
+		})
+	}
+}
+
+// rejectValidator отклоняет заказы с перечисленными UID
+type rejectValidator map[string]bool
+
+func (v rejectValidator) Validate(order *models.Order) error {
+	if v[order.OrderUID] {
+		return errors.New("rejected by rules")
+	}
+	return order.Validate()
+}
+
+func TestReplayAppliesDeadLetteredMessage(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	broker.Produce("orders", orderMessage(t, testOrder("o1")), orderMessage(t, testOrder("o2")))
+
+	// Consumer отклоняет o2 по старым правилам и коммитит оба сообщения
+	repo := repository.NewMemory()
+	dlq := NewDeadLetterWriterFrom(broker.Writer("orders-dlq"), "orders-dlq")
+	c := NewConsumerFromSource(broker.Reader(DefaultGroupID, "orders"), dlq, testPolicy(1, ExhaustedDeadLetter), repo, cache.New(cache.DefaultConfig()), rejectValidator{"o2": true})
+	stop, result := runConsumer(t, c)
+	waitFor(t, "commit", func() bool { return broker.Committed(DefaultGroupID, "orders", 0) == 2 })
+	stop()
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+	if got := len(broker.Messages("orders-dlq")); got != 1 {
+		t.Fatalf("dead-letter messages = %d, want 1", got)
+	}
+
+	// После исправления правил повторное чтение сохраняет o2 и не трогает уже сохраненный o1
+	messages := broker.Messages("orders")
+	source := &gapSource{messages: messages, last: 2, highWaterMark: 2}
+	replay := NewConsumerFromSource(nil, dlq, testPolicy(1, ExhaustedDeadLetter), repo, cache.New(cache.DefaultConfig()), nil)
+
+	from := int64(0)
+	res, err := NewReplayer(replay, source).Replay(context.Background(), ReplayRequest{FromOffset: &from})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if pr := res.Partitions[0]; pr.Skipped != 1 || pr.Valid != 1 {
+		t.Errorf("skipped = %d, valid = %d; want 1, 1", pr.Skipped, pr.Valid)
+	}
+	if _, err := repo.GetOrder("o2"); err != nil {
+		t.Errorf("GetOrder(o2): %v", err)
+	}
+	if revisions, _ := repo.GetOrderRevisions("o1"); len(revisions) != 1 {
+		t.Errorf("o1 revisions = %d, want 1", len(revisions))
+	}
+	if got := len(broker.Messages("orders-dlq")); got != 1 {
+		t.Errorf("dead-letter messages after replay = %d, want 1", got)
+	}
+}
+
+func TestReplayDryRunDoesNotSave(t *testing.T) {
+	from := int64(0)
+	source := &gapSource{
+		messages:      []kafka.Message{cityMessage(t, 0, "Acre"), cityMessage(t, 1, "Haifa")},
+		last:          2,
+		highWaterMark: 2,
+	}
+	repo := repository.NewMemory()
+	c := NewConsumerFromSource(nil, nil, testPolicy(1, ExhaustedHalt), repo, cache.New(cache.DefaultConfig()), nil)
+
+	result, err := NewReplayer(c, source).Replay(context.Background(), ReplayRequest{FromOffset: &from, DryRun: true})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if pr := result.Partitions[0]; pr.Skipped != 0 || pr.Valid != 2 {
+		t.Errorf("skipped = %d, valid = %d; want 0, 2", pr.Skipped, pr.Valid)
+	}
+	if _, err := repo.GetOrder("o1"); !errors.Is(err, models.ErrOrderNotFound) {
+		t.Errorf("GetOrder() error = %v, want %v: dry-run must not save", err, models.ErrOrderNotFound)
+	}
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// ExhaustedAction определяет, что делать с сообщением после исчерпания попыток
+type ExhaustedAction string
+
+const (
+	// ExhaustedDeadLetter отправляет сообщение в dead-letter топик и коммитит его
+	ExhaustedDeadLetter ExhaustedAction = "dead_letter"
+	// ExhaustedHalt останавливает consumer без коммита смещения
+	ExhaustedHalt ExhaustedAction = "halt"
+)
+
+// ReasonRetriesExhausted — причина для dead-letter после исчерпания попыток
+const ReasonRetriesExhausted = "retries_exhausted"
+
+// RetryPolicy описывает повторную обработку сообщения с экспоненциальной задержкой
+type RetryPolicy struct {
+	MaxAttempts    int             // Максимальное число попыток, 0 — без ограничения
+	InitialBackoff time.Duration   // Задержка перед второй попыткой
+	MaxBackoff     time.Duration   // Верхняя граница задержки
+	Multiplier     float64         // Множитель задержки между попытками
+	Jitter         float64         // Доля случайного разброса задержки, от 0 до 1
+	OnExhausted    ExhaustedAction // Действие после исчерпания попыток
+}
+
+// DefaultRetryPolicy возвращает политику повторов по умолчанию
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		OnExhausted:    ExhaustedDeadLetter,
+	}
+}
+
+// Validate проверяет корректность политики
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("retry max attempts must be >= 0, got %d", p.MaxAttempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff must be >= 0")
+	}
+	if p.Multiplier < 1 {
+		return fmt.Errorf("retry multiplier must be >= 1, got %v", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be in [0, 1], got %v", p.Jitter)
+	}
+	switch p.OnExhausted {
+	case ExhaustedDeadLetter, ExhaustedHalt:
+	default:
+		return fmt.Errorf("unknown retry exhausted action %q", p.OnExhausted)
+	}
+	return nil
+}
+
+// exhausted сообщает, исчерпаны ли попытки после attempt выполненных
+func (p RetryPolicy) exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+// Backoff возвращает задержку перед попыткой номер attempt+1 (attempt начинается с 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// sleep ожидает задержку или отмену контекста
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
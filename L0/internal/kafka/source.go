@@ -0,0 +1,27 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MessageSource — источник сообщений для consumer.
+// *kafka.Reader реализует его напрямую; kafkatest.Broker дает in-process реализацию.
+type MessageSource interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// MessageWriter — получатель сообщений (dead-letter топик).
+// *kafka.Writer реализует его напрямую.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+var (
+	_ MessageSource = (*kafka.Reader)(nil)
+	_ MessageWriter = (*kafka.Writer)(nil)
+)
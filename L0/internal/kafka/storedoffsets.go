@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// OffsetLoader возвращает смещения, сохраненные вместе с заказами
+type OffsetLoader interface {
+	LoadOffsets(ctx context.Context, group, topic string) (map[int]int64, error)
+}
+
+// StoredOffsetSource — источник сообщений группы, который после каждого назначения
+// партиций (старт и ребалансировка) начинает чтение со смещений из хранилища заказов,
+// а не с закоммиченных в Kafka. Партиции без сохраненного смещения читаются
+// с позиции группы в Kafka или, если ее нет, с последнего сообщения.
+type StoredOffsetSource struct {
+	group    *kafka.ConsumerGroup
+	groupID  string
+	topic    string
+	cluster  *Cluster
+	fetch    FetchConfig
+	loader   OffsetLoader
+	messages chan generationMessage
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu         sync.Mutex
+	generation *kafka.Generation
+}
+
+// generationMessage — сообщение с номером поколения группы, в котором оно прочитано
+type generationMessage struct {
+	generation int32
+	msg        kafka.Message
+}
+
+var _ MessageSource = (*StoredOffsetSource)(nil)
+
+// NewStoredOffsetSource присоединяется к группе fetch.GroupID и запускает чтение назначенных партиций
+func NewStoredOffsetSource(cluster *Cluster, topic string, fetch FetchConfig, loader OffsetLoader) (*StoredOffsetSource, error) {
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          fetch.GroupID,
+		Brokers:     cluster.brokers,
+		Dialer:      cluster.dialer,
+		Topics:      []string{topic},
+		StartOffset: kafka.LastOffset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &StoredOffsetSource{
+		group:    group,
+		groupID:  fetch.GroupID,
+		topic:    topic,
+		cluster:  cluster,
+		fetch:    fetch,
+		loader:   loader,
+		messages: make(chan generationMessage),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go s.run(ctx)
+
+	return s, nil
+}
+
+// run получает поколения группы и для каждого запускает чтение назначенных партиций
+func (s *StoredOffsetSource) run(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		gen, err := s.group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) {
+				return
+			}
+			log.Printf("level=error component=kafka_consumer event=group_join_error group=%q err=%v", s.groupID, err)
+			_ = sleep(ctx, time.Second)
+			continue
+		}
+
+		stored, err := s.loadOffsets(ctx, gen)
+		if err != nil {
+			return // Источник закрыт
+		}
+
+		s.mu.Lock()
+		s.generation = gen
+		s.mu.Unlock()
+
+		for _, assignment := range gen.Assignments[s.topic] {
+			offset, origin := assignment.Offset, "kafka"
+			if next, ok := stored[assignment.ID]; ok {
+				offset, origin = next, "store"
+			}
+			log.Printf("level=info component=kafka_consumer event=partition_assigned generation=%d partition=%d offset=%d offset_source=%s", gen.ID, assignment.ID, offset, origin)
+
+			partition := assignment.ID
+			gen.Start(func(genCtx context.Context) {
+				s.readPartition(genCtx, gen.ID, partition, offset)
+			})
+		}
+	}
+}
+
+// loadOffsets загружает сохраненные смещения, повторяя попытки при ошибках хранилища
+func (s *StoredOffsetSource) loadOffsets(ctx context.Context, gen *kafka.Generation) (map[int]int64, error) {
+	for attempt := 1; ; attempt++ {
+		stored, err := s.loader.LoadOffsets(ctx, s.groupID, s.topic)
+		if err == nil {
+			return stored, nil
+		}
+		log.Printf("level=error component=kafka_consumer event=offset_load_error generation=%d attempt=%d err=%v", gen.ID, attempt, err)
+		if err := sleep(ctx, time.Second); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readPartition читает партицию с указанного смещения до конца поколения
+func (s *StoredOffsetSource) readPartition(ctx context.Context, generation int32, partition int, offset int64) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   s.cluster.brokers,
+		Dialer:    s.cluster.dialer,
+		Topic:     s.topic,
+		Partition: partition,
+		MinBytes:  s.fetch.MinBytes,
+		MaxBytes:  s.fetch.MaxBytes,
+	})
+	defer r.Close()
+
+	if err := r.SetOffset(offset); err != nil {
+		log.Printf("level=error component=kafka_consumer event=seek_error partition=%d offset=%d err=%v", partition, offset, err)
+		return
+	}
+
+	for {
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("level=error component=kafka_consumer event=partition_read_error partition=%d err=%v", partition, err)
+			}
+			return // Завершение функции закрывает поколение, группа переподключится
+		}
+
+		select {
+		case s.messages <- generationMessage{generation: generation, msg: msg}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FetchMessage возвращает следующее сообщение текущего поколения.
+// Сообщения, прочитанные до ребалансировки, отбрасываются.
+func (s *StoredOffsetSource) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		select {
+		case m := <-s.messages:
+			s.mu.Lock()
+			current := s.generation != nil && s.generation.ID == m.generation
+			s.mu.Unlock()
+			if current {
+				return m.msg, nil
+			}
+		case <-s.done:
+			return kafka.Message{}, kafka.ErrGroupClosed
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+// CommitMessages коммитит смещения в Kafka для мониторинга отставания группы.
+// Источником истины остается хранилище заказов, поэтому ошибка завершенного поколения игнорируется.
+func (s *StoredOffsetSource) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	s.mu.Lock()
+	gen := s.generation
+	s.mu.Unlock()
+	if gen == nil {
+		return nil
+	}
+
+	offsets := make(map[string]map[int]int64)
+	for _, msg := range msgs {
+		if offsets[msg.Topic] == nil {
+			offsets[msg.Topic] = make(map[int]int64)
+		}
+		if next := msg.Offset + 1; next > offsets[msg.Topic][msg.Partition] {
+			offsets[msg.Topic][msg.Partition] = next
+		}
+	}
+
+	if err := gen.CommitOffsets(offsets); err != nil && !errors.Is(err, kafka.ErrGenerationEnded) {
+		return err
+	}
+	return nil
+}
+
+// Close выходит из группы и останавливает чтение партиций
+func (s *StoredOffsetSource) Close() error {
+	s.cancel()
+	err := s.group.Close()
+	<-s.done
+	return err
+}
@@ -0,0 +1,281 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Ordering определяет, какие сообщения обрабатываются строго по порядку
+type Ordering string
+
+const (
+	// OrderingPartition сохраняет порядок внутри партиции: партиция закреплена за одним worker
+	OrderingPartition Ordering = "partition"
+	// OrderingKey сохраняет порядок внутри ключа сообщения (order_uid):
+	// сообщения одной партиции с разными ключами обрабатываются параллельно
+	OrderingKey Ordering = "key"
+)
+
+// WorkerConfig задает параллельную обработку сообщений.
+// Workers <= 1 оставляет обработку в одной горутине.
+type WorkerConfig struct {
+	Workers   int      // Число worker'ов
+	Ordering  Ordering // Гарантия порядка
+	QueueSize int      // Емкость очереди каждого worker'а
+}
+
+// DefaultWorkerConfig возвращает конфигурацию с одним worker'ом
+func DefaultWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		Workers:   1,
+		Ordering:  OrderingPartition,
+		QueueSize: 100,
+	}
+}
+
+// Validate проверяет корректность конфигурации
+func (w WorkerConfig) Validate() error {
+	if w.Workers < 0 {
+		return fmt.Errorf("workers must be >= 0, got %d", w.Workers)
+	}
+	if w.QueueSize < 1 {
+		return fmt.Errorf("worker queue size must be >= 1, got %d", w.QueueSize)
+	}
+	switch w.Ordering {
+	case OrderingPartition, OrderingKey:
+	default:
+		return fmt.Errorf("unknown worker ordering %q", w.Ordering)
+	}
+	return nil
+}
+
+func (w WorkerConfig) enabled() bool {
+	return w.Workers > 1
+}
+
+// SetWorkers включает параллельную обработку; вызывается до Start
+func (c *Consumer) SetWorkers(cfg WorkerConfig) {
+	c.workers = cfg
+}
+
+// runWorkers читает сообщения в одной горутине и распределяет их по worker'ам так,
+// чтобы сообщения одной партиции (или одного ключа) всегда попадали к одному worker'у.
+// Смещения коммитятся через offsetTracker только после обработки всех предыдущих сообщений партиции.
+func (c *Consumer) runWorkers(ctx context.Context) error {
+	log.Printf("component=kafka_consumer event=worker_mode workers=%d ordering=%s batch_size=%d", c.workers.Workers, c.workers.Ordering, c.batch.Size)
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tracker := newOffsetTracker()
+	queues := make([]chan kafka.Message, c.workers.Workers)
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		haltErr error
+	)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, c.workers.QueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			if err := c.work(workCtx, queue, tracker); err != nil {
+				errOnce.Do(func() { haltErr = err })
+				cancel() // Остальные worker'ы останавливаются, незавершенные смещения не коммитятся
+			}
+		}(queues[i])
+	}
+
+	for {
+		msg, err := c.fetch(workCtx)
+		if err != nil {
+			break
+		}
+		tracker.add(msg)
+
+		select {
+		case queues[c.route(msg)] <- msg:
+		case <-workCtx.Done():
+		}
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	if haltErr != nil {
+		return haltErr
+	}
+	log.Println("component=kafka_consumer event=stop msg=\"stopping consumer\"")
+	return nil
+}
+
+// route возвращает номер worker'а для сообщения
+func (c *Consumer) route(msg kafka.Message) int {
+	if c.workers.Ordering == OrderingKey && len(msg.Key) > 0 {
+		h := fnv.New32a()
+		h.Write(msg.Key)
+		return int(h.Sum32() % uint32(c.workers.Workers))
+	}
+	return msg.Partition % c.workers.Workers
+}
+
+// work обрабатывает очередь одного worker'а: по одному сообщению или пакетами,
+// если включен пакетный режим. Возвращает ошибку при остановке по политике повторов.
+func (c *Consumer) work(ctx context.Context, queue <-chan kafka.Message, tracker *offsetTracker) error {
+	for {
+		msgs, ok := c.dequeue(ctx, queue)
+		if !ok {
+			return nil
+		}
+
+		var done []bool
+		var err error
+		if c.batch.enabled() {
+			done, err = c.executeBatch(ctx, msgs)
+		} else {
+			err = c.handleMessage(ctx, msgs[0])
+			done = []bool{err == nil}
+		}
+
+		if commits := tracker.complete(msgs, done); len(commits) > 0 {
+			if cerr := c.commit(ctx, commits...); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("level=info component=kafka_consumer event=stop_uncommitted size=%d msg=\"context cancelled before messages were processed\"", len(msgs))
+				return nil
+			}
+			log.Printf("level=error component=kafka_consumer event=halted size=%d err=%v", len(msgs), err)
+			return err
+		}
+	}
+}
+
+// dequeue берет из очереди одно сообщение или, в пакетном режиме, пакет
+// до Size сообщений в пределах Wait. Возвращает false, когда очередь закрыта
+// или контекст отменен.
+func (c *Consumer) dequeue(ctx context.Context, queue <-chan kafka.Message) ([]kafka.Message, bool) {
+	var first kafka.Message
+	select {
+	case msg, ok := <-queue:
+		if !ok {
+			return nil, false
+		}
+		first = msg
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	msgs := []kafka.Message{first}
+	if !c.batch.enabled() {
+		return msgs, true
+	}
+
+	timer := time.NewTimer(c.batch.Wait)
+	defer timer.Stop()
+
+	for len(msgs) < c.batch.Size {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				return msgs, true
+			}
+			msgs = append(msgs, msg)
+		case <-timer.C:
+			return msgs, true
+		case <-ctx.Done():
+			return msgs, true
+		}
+	}
+
+	return msgs, true
+}
+
+// offsetTracker согласует коммиты параллельных worker'ов: смещение партиции
+// коммитится, только когда обработаны все полученные до него сообщения этой партиции
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// partitionOffsets — полученные, но еще не закоммиченные сообщения партиции
+type partitionOffsets struct {
+	pending []int64                 // Смещения в порядке получения
+	done    map[int64]kafka.Message // Обработанные сообщения из pending
+	last    int64                   // Последнее полученное смещение
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+// add регистрирует полученное сообщение. Если смещение не больше последнего полученного,
+// партиция была перечитана после ребалансировки и прежние ожидания сбрасываются.
+func (t *offsetTracker) add(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{msg.Topic, msg.Partition}
+	p, ok := t.partitions[key]
+	if !ok || msg.Offset <= p.last {
+		p = &partitionOffsets{done: make(map[int64]kafka.Message)}
+		t.partitions[key] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+	p.last = msg.Offset
+}
+
+// complete отмечает обработанные сообщения и возвращает по одному сообщению на партицию,
+// смещение которого теперь можно закоммитить
+func (t *offsetTracker) complete(msgs []kafka.Message, done []bool) []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	advanced := make(map[partitionKey]kafka.Message)
+	for i, msg := range msgs {
+		if !done[i] {
+			continue
+		}
+		key := partitionKey{msg.Topic, msg.Partition}
+		p, ok := t.partitions[key]
+		if !ok || len(p.pending) == 0 || msg.Offset < p.pending[0] || msg.Offset > p.last {
+			continue // Сообщение из сброшенного после ребалансировки диапазона
+		}
+		p.done[msg.Offset] = msg
+
+		for len(p.pending) > 0 {
+			head, ok := p.done[p.pending[0]]
+			if !ok {
+				break
+			}
+			delete(p.done, p.pending[0])
+			p.pending = p.pending[1:]
+			advanced[key] = head
+		}
+	}
+
+	commits := make([]kafka.Message, 0, len(advanced))
+	for _, msg := range advanced {
+		commits = append(commits, msg)
+	}
+	sort.Slice(commits, func(i, j int) bool { return commits[i].Partition < commits[j].Partition })
+	return commits
+}
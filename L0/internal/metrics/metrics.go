@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"order-service/internal/cache"
+	"order-service/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "order_service"
+
+// Результаты обработки сообщения Kafka
+const (
+	ResultProcessed    = "processed"
+	ResultInvalid      = "invalid"
+	ResultFailed       = "failed"
+	ResultDeadLettered = "dead_lettered"
+	ResultCancelled    = "cancelled"
+	ResultDeleted      = "deleted"
+)
+
+var (
+	// ConsumerMessages считает обработанные сообщения по результату
+	ConsumerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_total",
+		Help:      "Kafka messages handled by the consumer, by result.",
+	}, []string{"result"})
+
+	// ConsumerLag — отставание consumer по партициям
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "lag_messages",
+		Help:      "Messages between the last fetched offset and the partition high watermark.",
+	}, []string{"partition"})
+
+	// ConsumerProcessingDuration — время обработки одного сообщения, включая повторы
+	ConsumerProcessingDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "processing_duration_seconds",
+		Help:      "Time to process a Kafka message, including retries.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// ConsumerBatchSize — число сообщений в пакете в пакетном режиме
+	ConsumerBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "batch_size",
+		Help:      "Number of Kafka messages per batch in batch mode.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+	})
+
+	// ConsumerBatchDuration — время обработки пакета, включая откат к обработке по одному
+	ConsumerBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "batch_duration_seconds",
+		Help:      "Time to process a batch of Kafka messages, including fallback to per-message handling.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// ConsumerBatchFallbacks считает пакеты, которые пришлось обработать по одному сообщению
+	ConsumerBatchFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "batch_fallbacks_total",
+		Help:      "Batches that failed and were reprocessed message by message.",
+	})
+
+	// DBQueryDuration — длительность операций с базой данных
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of database operations, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	// HTTPRequestDuration — длительность HTTP запросов
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests, by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// HTTPAuthFailures считает отклоненные запросы по причине
+	HTTPAuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "auth_failures_total",
+		Help:      "HTTP requests rejected by authentication or authorization, by reason.",
+	}, []string{"reason"})
+
+	// HTTPCertExpiry — срок действия текущего сертификата HTTPS сервера
+	HTTPCertExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "tls_cert_expiry_timestamp_seconds",
+		Help:      "Expiry time of the currently loaded HTTPS server certificate, as a Unix timestamp.",
+	})
+)
+
+// ObserveConsumerLag обновляет отставание партиции по high watermark сообщения
+func ObserveConsumerLag(partition int, offset, highWaterMark int64) {
+	lag := highWaterMark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	ConsumerLag.WithLabelValues(strconv.Itoa(partition)).Set(float64(lag))
+}
+
+// ObserveDB записывает длительность операции с базой данных
+func ObserveDB(operation string, start time.Time, err error) {
+	status := "ok"
+	switch {
+	case errors.Is(err, models.ErrOrderNotFound), errors.Is(err, models.ErrRevisionNotFound):
+		status = "not_found"
+	case err != nil:
+		status = "error"
+	}
+	DBQueryDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+// RegisterCache регистрирует метрики кеша, которые читаются из его счетчиков при сборе
+func RegisterCache(c *cache.Cache) {
+	stat := func(f func(cache.Stats) float64) func() float64 {
+		return func() float64 { return f(c.Stats()) }
+	}
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "entries",
+		Help: "Orders currently held in the cache.",
+	}, stat(func(s cache.Stats) float64 { return float64(s.Size) }))
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "bytes",
+		Help: "Estimated size of cached orders in bytes.",
+	}, stat(func(s cache.Stats) float64 { return float64(s.Bytes) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "hits_total",
+		Help: "Cache lookups that found an order.",
+	}, stat(func(s cache.Stats) float64 { return float64(s.Hits) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "misses_total",
+		Help: "Cache lookups that did not find an order.",
+	}, stat(func(s cache.Stats) float64 { return float64(s.Misses) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "evictions_total",
+		Help: "Orders evicted from the cache by size limits.",
+	}, stat(func(s cache.Stats) float64 { return float64(s.Evictions) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "expirations_total",
+		Help: "Orders removed from the cache after their TTL.",
+	}, stat(func(s cache.Stats) float64 { return float64(s.Expirations) }))
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "hit_ratio",
+		Help: "Share of cache lookups that were hits.",
+	}, stat(func(s cache.Stats) float64 {
+		total := s.Hits + s.Misses
+		if total == 0 {
+			return 0
+		}
+		return float64(s.Hits) / float64(total)
+	}))
+}
+
+// Handler возвращает HTTP handler для /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
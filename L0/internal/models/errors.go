@@ -8,6 +8,8 @@ var (
 	ErrInvalidTrackNumber = errors.New("invalid track number")
 	ErrNoItems            = errors.New("order must contain at least one item")
 	ErrOrderNotFound      = errors.New("order not found")
+	ErrRevisionNotFound   = errors.New("order revision not found")
+	ErrInvalidCursor      = errors.New("invalid cursor")
 	ErrDatabaseConnection = errors.New("database connection error")
 	ErrKafkaConnection    = errors.New("kafka connection error")
 )
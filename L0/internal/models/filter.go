@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// Ограничения размера страницы списка заказов
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// OrderFilter задает фильтры и пагинацию списка заказов.
+// Пустые поля не участвуют в фильтрации.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	DateFrom        time.Time
+	DateTo          time.Time
+	Currency        string
+	Provider        string
+	Brand           string
+	Limit           int
+	Cursor          *Cursor
+}
+
+// Cursor указывает позицию, после которой начинается следующая страница.
+// Заказы упорядочены по (created_at, order_uid) по убыванию.
+type Cursor struct {
+	CreatedAt time.Time `json:"c"`
+	OrderUID  string    `json:"u"`
+}
+
+// Encode кодирует курсор в непрозрачную строку
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor разбирает курсор, полученный от клиента
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.OrderUID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// OrderSummary — краткое представление заказа для списков
+type OrderSummary struct {
+	OrderUID        string    `json:"order_uid"`
+	TrackNumber     string    `json:"track_number"`
+	CustomerID      string    `json:"customer_id"`
+	DeliveryService string    `json:"delivery_service"`
+	DateCreated     time.Time `json:"date_created"`
+	Currency        string    `json:"currency"`
+	Provider        string    `json:"provider"`
+	Amount          int       `json:"amount"`
+	ItemsCount      int       `json:"items_count"`
+	Status          Status    `json:"status"`
+	CreatedAt       time.Time `json:"-"`
+}
@@ -21,7 +21,12 @@ type Order struct {
 	SmID              int       `json:"sm_id" db:"sm_id"`
 	DateCreated       time.Time `json:"date_created" db:"date_created"`
 	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+	Status            Status    `json:"status,omitempty" db:"status"` // Если не задан, наследуется от сохраненной версии
 	CreatedAt         time.Time `json:"-" db:"created_at"`
+
+	// Отмена заказа задается только событием отмены; значения из тела заказа не сохраняются
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CancelReason string     `json:"cancel_reason,omitempty" db:"cancel_reason"`
 }
 
 // Delivery представляет информацию о доставке
@@ -35,6 +40,17 @@ type Delivery struct {
 	Email   string `json:"email" db:"email"`
 }
 
+// PersonalData — пути полей с персональными данными покупателя и транзакцией оплаты.
+// Значения этих полей не включаются в тексты ошибок валидации.
+var PersonalData = map[string]bool{
+	"delivery.name":       true,
+	"delivery.phone":      true,
+	"delivery.zip":        true,
+	"delivery.address":    true,
+	"delivery.email":      true,
+	"payment.transaction": true,
+}
+
 // Payment представляет информацию об оплате
 type Payment struct {
 	Transaction  string `json:"transaction" db:"transaction"`
@@ -61,21 +77,12 @@ type Item struct {
 	TotalPrice  int    `json:"total_price" db:"total_price"`
 	NmID        int    `json:"nm_id" db:"nm_id"`
 	Brand       string `json:"brand" db:"brand"`
-	Status      int    `json:"status" db:"status"`
+	Status      Status `json:"status" db:"status"`
 }
 
-// Validate проверяет валидность заказа
-func (o *Order) Validate() error {
-	if o.OrderUID == "" {
-		return ErrInvalidOrderUID
-	}
-	if o.TrackNumber == "" {
-		return ErrInvalidTrackNumber
-	}
-	if len(o.Items) == 0 {
-		return ErrNoItems
-	}
-	return nil
+// Cancelled сообщает, отменен ли заказ
+func (o *Order) Cancelled() bool {
+	return o.CancelledAt != nil
 }
 
 // ToJSON конвертирует заказ в JSON
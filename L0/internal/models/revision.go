@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Source описывает происхождение версии заказа (сообщение Kafka)
+type Source struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Group     string `json:"-"` // Группа consumer; если задана, смещение сохраняется вместе с заказом
+}
+
+// Revision представляет сохраненную версию заказа
+type Revision struct {
+	OrderUID  string          `json:"order_uid"`
+	Revision  int             `json:"revision"`
+	Order     json.RawMessage `json:"order"`
+	Source    *Source         `json:"source,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// FieldChange описывает изменение одного поля между двумя ревизиями
+type FieldChange struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Операции изменения поля
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "changed"
+)
+
+// RevisionDiff описывает разницу между двумя ревизиями заказа
+type RevisionDiff struct {
+	OrderUID string        `json:"order_uid"`
+	From     int           `json:"from"`
+	To       int           `json:"to"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+// DiffRevisions сравнивает JSON двух ревизий по полям.
+// Пути полей имеют вид "payment.amount" или "items[0].status".
+func DiffRevisions(from, to *Revision) (*RevisionDiff, error) {
+	oldFields, err := flattenJSON(from.Order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse revision %d: %w", from.Revision, err)
+	}
+	newFields, err := flattenJSON(to.Order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse revision %d: %w", to.Revision, err)
+	}
+
+	changes := make([]FieldChange, 0)
+	for path, oldValue := range oldFields {
+		newValue, ok := newFields[path]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Path: path, Op: ChangeRemoved, Old: oldValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, FieldChange{Path: path, Op: ChangeUpdated, Old: oldValue, New: newValue})
+		}
+	}
+	for path, newValue := range newFields {
+		if _, ok := oldFields[path]; !ok {
+			changes = append(changes, FieldChange{Path: path, Op: ChangeAdded, New: newValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return &RevisionDiff{
+		OrderUID: to.OrderUID,
+		From:     from.Revision,
+		To:       to.Revision,
+		Changes:  changes,
+	}, nil
+}
+
+// flattenJSON раскладывает JSON документ в плоскую карту путь -> значение
+func flattenJSON(data []byte) (map[string]interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	flattenValue("", doc, fields)
+	return fields, nil
+}
+
+func flattenValue(prefix string, value interface{}, fields map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenValue(path, child, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(fmt.Sprintf("%s[%d]", prefix, i), child, fields)
+		}
+	default:
+		fields[prefix] = v
+	}
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rules — набор правил валидации для разных маркетплейсов.
+// Правила дополняют встроенные проверки Validate.
+//
+// Пример файла:
+//
+//	rulesets:
+//	  - name: wbil
+//	    match:
+//	      entry: [WBIL]
+//	    required: [delivery.email]
+//	    patterns:
+//	      delivery.phone: '^\+7[0-9]{10}$'
+//	    ranges:
+//	      payment.custom_fee: {min: 1}
+//	    sums:
+//	      - field: payment.goods_total
+//	        of: [items[].total_price]
+//
+// Пути полей совпадают с JSON заказа; "items[].name" означает поле каждого товара.
+type Rules struct {
+	RuleSets []RuleSet `yaml:"rulesets" json:"rulesets"`
+}
+
+// RuleSet — правила одного маркетплейса
+type RuleSet struct {
+	Name     string            `yaml:"name" json:"name"`
+	Match    RuleSelector      `yaml:"match" json:"match"`
+	Required []string          `yaml:"required" json:"required"`
+	Patterns map[string]string `yaml:"patterns" json:"patterns"`
+	Ranges   map[string]Range  `yaml:"ranges" json:"ranges"`
+	Sums     []SumRule         `yaml:"sums" json:"sums"`
+
+	compiled map[string]*regexp.Regexp
+}
+
+// RuleSelector выбирает заказы, к которым применяется набор.
+// Пустой список не ограничивает выбор; пустой RuleSelector подходит любому заказу.
+type RuleSelector struct {
+	Entry           []string `yaml:"entry" json:"entry"`
+	DeliveryService []string `yaml:"delivery_service" json:"delivery_service"`
+}
+
+// Range — допустимый диапазон числового поля; nil границы не проверяются
+type Range struct {
+	Min *float64 `yaml:"min" json:"min"`
+	Max *float64 `yaml:"max" json:"max"`
+}
+
+// SumRule требует, чтобы значение Field равнялось сумме полей Of
+type SumRule struct {
+	Field string   `yaml:"field" json:"field"`
+	Of    []string `yaml:"of" json:"of"`
+}
+
+// ParseRules разбирает YAML (или JSON) файл правил и компилирует регулярные выражения
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse validation rules: %w", err)
+	}
+
+	for i := range rules.RuleSets {
+		rs := &rules.RuleSets[i]
+		if rs.Name == "" {
+			return nil, fmt.Errorf("ruleset #%d has no name", i+1)
+		}
+
+		rs.compiled = make(map[string]*regexp.Regexp, len(rs.Patterns))
+		for field, pattern := range rs.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("ruleset %s: invalid pattern for %s: %w", rs.Name, field, err)
+			}
+			rs.compiled[field] = re
+		}
+
+		for field, r := range rs.Ranges {
+			if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+				return nil, fmt.Errorf("ruleset %s: range for %s has min > max", rs.Name, field)
+			}
+		}
+		for _, sum := range rs.Sums {
+			if sum.Field == "" || len(sum.Of) == 0 {
+				return nil, fmt.Errorf("ruleset %s: sum rule needs field and of", rs.Name)
+			}
+		}
+	}
+
+	return &rules, nil
+}
+
+// Select возвращает первый набор правил, подходящий заказу, или nil
+func (r *Rules) Select(o *Order) *RuleSet {
+	if r == nil {
+		return nil
+	}
+	for i := range r.RuleSets {
+		if r.RuleSets[i].Match.matches(o) {
+			return &r.RuleSets[i]
+		}
+	}
+	return nil
+}
+
+// Validate выполняет встроенные проверки и правила набора, выбранного для заказа
+func (r *Rules) Validate(o *Order) error {
+	err := o.Validate()
+
+	rs := r.Select(o)
+	if rs == nil {
+		return err
+	}
+
+	v := &validator{}
+	if ve, ok := AsValidationError(err); ok {
+		v.errs = ve.Errors
+	} else if err != nil {
+		return err
+	}
+
+	if rerr := rs.apply(o, v); rerr != nil {
+		return rerr
+	}
+	return v.result()
+}
+
+func (m RuleSelector) matches(o *Order) bool {
+	return matchAny(m.Entry, o.Entry) && matchAny(m.DeliveryService, o.DeliveryService)
+}
+
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply проверяет заказ правилами набора и добавляет нарушения в v
+func (rs *RuleSet) apply(o *Order, v *validator) error {
+	doc, err := orderDocument(o)
+	if err != nil {
+		return err
+	}
+
+	add := func(field, rule, format string, args ...interface{}) {
+		v.add(field, rule, nil, format+" (ruleset %s)", append(args, rs.Name)...)
+	}
+
+	for _, field := range rs.Required {
+		values := lookupPath(doc, field)
+		if len(values) == 0 {
+			add(field, RuleRequired, "is required")
+		}
+		for _, fv := range values {
+			if isEmpty(fv.value) {
+				add(fv.path, RuleRequired, "is required")
+			}
+		}
+	}
+
+	for _, field := range sortedKeys(rs.compiled) {
+		re := rs.compiled[field]
+		for _, fv := range lookupPath(doc, field) {
+			if isEmpty(fv.value) {
+				continue // Обязательность проверяется отдельно
+			}
+			s := fmt.Sprint(fv.value)
+			switch {
+			case re.MatchString(s):
+			case PersonalData[fv.path]:
+				add(fv.path, RuleFormat, "does not match %s", re.String()) // Значение не попадает в логи и DLQ
+			default:
+				add(fv.path, RuleFormat, "%q does not match %s", s, re.String())
+			}
+		}
+	}
+
+	for _, field := range sortedKeys(rs.Ranges) {
+		r := rs.Ranges[field]
+		for _, fv := range lookupPath(doc, field) {
+			n, ok := fv.value.(float64)
+			if !ok {
+				add(fv.path, RuleRange, "is not a number")
+				continue
+			}
+			if r.Min != nil && n < *r.Min {
+				add(fv.path, RuleRange, "is %v, must be >= %v", n, *r.Min)
+			}
+			if r.Max != nil && n > *r.Max {
+				add(fv.path, RuleRange, "is %v, must be <= %v", n, *r.Max)
+			}
+		}
+	}
+
+	for _, sum := range rs.Sums {
+		expected := 0.0
+		for _, field := range sum.Of {
+			for _, fv := range lookupPath(doc, field) {
+				if n, ok := fv.value.(float64); ok {
+					expected += n
+				}
+			}
+		}
+		for _, fv := range lookupPath(doc, sum.Field) {
+			if n, ok := fv.value.(float64); !ok || n != expected {
+				add(fv.path, RuleSum, "is %v, but %s sum is %v", fv.value, strings.Join(sum.Of, " + "), expected)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fieldValue — значение поля по конкретному пути, например items[1].brand
+type fieldValue struct {
+	path  string
+	value interface{}
+}
+
+// orderDocument представляет заказ в виде JSON документа для обхода по путям
+func orderDocument(o *Order) (map[string]interface{}, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order for validation: %w", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order for validation: %w", err)
+	}
+	return doc, nil
+}
+
+// lookupPath возвращает значения по пути вида "payment.amount" или "items[].status"
+func lookupPath(doc interface{}, path string) []fieldValue {
+	current := []fieldValue{{path: "", value: doc}}
+
+	for _, part := range strings.Split(path, ".") {
+		each := strings.HasSuffix(part, "[]")
+		key := strings.TrimSuffix(part, "[]")
+
+		var next []fieldValue
+		for _, fv := range current {
+			obj, ok := fv.value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			child, ok := obj[key]
+			if !ok {
+				continue
+			}
+			childPath := key
+			if fv.path != "" {
+				childPath = fv.path + "." + key
+			}
+
+			if !each {
+				next = append(next, fieldValue{path: childPath, value: child})
+				continue
+			}
+			items, _ := child.([]interface{})
+			for i, item := range items {
+				next = append(next, fieldValue{path: fmt.Sprintf("%s[%d]", childPath, i), value: item})
+			}
+		}
+		current = next
+	}
+
+	return current
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
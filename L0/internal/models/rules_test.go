@@ -0,0 +1,228 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid rules",
+			data: `
+rulesets:
+  - name: wbil
+    match: {entry: [WBIL]}
+    required: [delivery.email]
+    patterns: {delivery.zip: '^[0-9]+$'}
+    ranges: {'items[].sale': {min: 0, max: 99}}
+    sums: [{field: payment.goods_total, of: ['items[].total_price']}]
+`,
+		},
+		{name: "empty file"},
+		{name: "invalid yaml", data: "rulesets: [", wantErr: "failed to parse validation rules"},
+		{name: "ruleset without name", data: "rulesets: [{required: [customer_id]}]", wantErr: "ruleset #1 has no name"},
+		{name: "invalid pattern", data: "rulesets: [{name: a, patterns: {delivery.zip: '['}}]", wantErr: "invalid pattern for delivery.zip"},
+		{name: "min greater than max", data: "rulesets: [{name: a, ranges: {payment.amount: {min: 10, max: 1}}}]", wantErr: "min > max"},
+		{name: "sum without terms", data: "rulesets: [{name: a, sums: [{field: payment.amount}]}]", wantErr: "needs field and of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseRules() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRules() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRulesSelect(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rulesets:
+  - name: wbil-dhl
+    match: {entry: [WBIL], delivery_service: [dhl]}
+  - name: cross-border
+    match: {delivery_service: [dhl, ups]}
+  - name: wbil
+    match: {entry: [WBIL]}
+  - name: default
+`))
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+
+	tests := []struct {
+		entry           string
+		deliveryService string
+		want            string
+	}{
+		{entry: "WBIL", deliveryService: "dhl", want: "wbil-dhl"},
+		{entry: "wbil", deliveryService: "DHL", want: "wbil-dhl"},
+		{entry: "OZON", deliveryService: "ups", want: "cross-border"},
+		{entry: "WBIL", deliveryService: "meest", want: "wbil"},
+		{entry: "OZON", deliveryService: "meest", want: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry+"/"+tt.deliveryService, func(t *testing.T) {
+			o := testOrder()
+			o.Entry, o.DeliveryService = tt.entry, tt.deliveryService
+			if got := rules.Select(o); got == nil || got.Name != tt.want {
+				t.Errorf("Select() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&Rules{RuleSets: []RuleSet{{Name: "wbil", Match: RuleSelector{Entry: []string{"WBIL"}}}}}).Select(&Order{Entry: "OZON"}); got != nil {
+		t.Errorf("Select() = %s, want nil without a matching ruleset", got.Name)
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	doc, err := orderDocument(testOrder())
+	if err != nil {
+		t.Fatalf("orderDocument: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want []fieldValue
+	}{
+		{path: "customer_id", want: []fieldValue{{"customer_id", "test"}}},
+		{path: "payment.amount", want: []fieldValue{{"payment.amount", float64(2317)}}},
+		{path: "items[].rid", want: []fieldValue{{"items[0].rid", "ab4219087a764ae0btest"}, {"items[1].rid", "ab4219087a764ae0btest2"}}},
+		{path: "payment.missing"},
+		{path: "customer_id.nested"},
+		{path: "delivery[].name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := lookupPath(doc, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rulesets:
+  - name: wbil
+    match: {entry: [WBIL]}
+    required:
+      - customer_id
+      - items[].brand
+      - payment.bank
+    patterns:
+      delivery.zip: '^[0-9]{5,7}$'
+      delivery.phone: '^\+7[0-9]{10}$'
+      shardkey: '^[0-9]$'
+    ranges:
+      items[].nm_id: {min: 1}
+      payment.delivery_cost: {max: 1000}
+    sums:
+      - field: payment.goods_total
+        of:
+          - items[].total_price
+`))
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(o *Order)
+		want        []violation
+		wantMessage string   // Подстрока текста ошибки
+		hidden      []string // Значения, которых не должно быть в тексте ошибки
+	}{
+		{
+			name:   "order satisfying the ruleset",
+			modify: func(o *Order) {},
+		},
+		{
+			name: "ruleset is not selected",
+			modify: func(o *Order) {
+				o.Entry = "OZON"
+				o.CustomerID = ""
+			},
+		},
+		{
+			name: "required fields",
+			modify: func(o *Order) {
+				o.CustomerID = ""
+				o.Items[1].Brand = ""
+				o.Payment.Bank = ""
+			},
+			want:        []violation{{"customer_id", RuleRequired}, {"items[1].brand", RuleRequired}, {"payment.bank", RuleRequired}},
+			wantMessage: "is required (ruleset wbil)",
+		},
+		{
+			name:        "pattern shows the value of a regular field",
+			modify:      func(o *Order) { o.Shardkey = "42" },
+			want:        []violation{{"shardkey", RuleFormat}},
+			wantMessage: `"42" does not match`,
+		},
+		{
+			name:   "pattern hides personal data",
+			modify: func(o *Order) { o.Delivery.Phone = "+9720000000"; o.Delivery.Zip = "ZIP-A1" },
+			want:   []violation{{"delivery.phone", RuleFormat}, {"delivery.zip", RuleFormat}},
+			hidden: []string{"+9720000000", "ZIP-A1"},
+		},
+		{
+			name: "ranges",
+			modify: func(o *Order) {
+				o.Items[1].NmID = 0
+				o.Payment.DeliveryCost, o.Payment.Amount = 1500, 2317
+			},
+			want:        []violation{{"items[1].nm_id", RuleRange}, {"payment.delivery_cost", RuleRange}},
+			wantMessage: "is 1500, must be <= 1000",
+		},
+		{
+			name:        "sum is checked after the built-in violations",
+			modify:      func(o *Order) { o.Payment.GoodsTotal, o.Payment.Amount = 900, 1400 },
+			want:        []violation{{"payment.goods_total", RuleSum}, {"payment.goods_total", RuleSum}},
+			wantMessage: "is 900, but items[].total_price sum is 817 (ruleset wbil)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Заказ, которому подходит набор wbil
+			o := testOrder()
+			o.Entry = "WBIL"
+			o.Delivery.Phone = "+79990000000"
+			o.Payment.DeliveryCost, o.Payment.Amount = 500, 1317
+			tt.modify(o)
+
+			err := rules.Validate(o)
+			if got := violations(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+			if err == nil {
+				return
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("error %q does not contain %q", err.Error(), tt.wantMessage)
+			}
+			for _, value := range tt.hidden {
+				if strings.Contains(err.Error(), value) {
+					t.Errorf("error %q contains personal data %q", err.Error(), value)
+				}
+			}
+		})
+	}
+}
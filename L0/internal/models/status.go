@@ -0,0 +1,198 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Status — этап жизненного цикла заказа или товара.
+// Значения совпадают с числовыми кодами item.status в сообщениях Kafka и в базе данных.
+type Status int
+
+// Этапы жизненного цикла
+const (
+	StatusUnknown   Status = 0 // Не задан в сообщении
+	StatusCreated   Status = 200
+	StatusPaid      Status = 201
+	StatusAssembled Status = 202
+	StatusShipped   Status = 203
+	StatusDelivered Status = 204
+	StatusReturned  Status = 205
+	StatusCancelled Status = 206
+)
+
+var statusNames = map[Status]string{
+	StatusCreated:   "created",
+	StatusPaid:      "paid",
+	StatusAssembled: "assembled",
+	StatusShipped:   "shipped",
+	StatusDelivered: "delivered",
+	StatusReturned:  "returned",
+	StatusCancelled: "cancelled",
+}
+
+// statusTransitions — допустимые переходы между этапами.
+// Повтор текущего этапа переходом не считается и допустим всегда.
+var statusTransitions = map[Status][]Status{
+	StatusCreated:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusAssembled, StatusCancelled},
+	StatusAssembled: {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered, StatusReturned},
+	StatusDelivered: {StatusReturned},
+}
+
+// ErrIllegalTransition — переход между этапами, которого нет в таблице переходов
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+// Known сообщает, является ли значение известным этапом
+func (s Status) Known() bool {
+	_, ok := statusNames[s]
+	return ok
+}
+
+// String возвращает название этапа или числовой код для неизвестных значений
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return strconv.Itoa(int(s))
+}
+
+// UnmarshalJSON принимает числовой код (как в сообщениях Kafka) или название этапа
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*s = Status(code)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("status must be a code or a name: %s", data)
+	}
+	parsed, err := ParseStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// ParseStatus возвращает этап по названию или числовому коду
+func ParseStatus(v string) (Status, error) {
+	for s, name := range statusNames {
+		if name == v {
+			return s, nil
+		}
+	}
+	if code, err := strconv.Atoi(v); err == nil && Status(code).Known() {
+		return Status(code), nil
+	}
+	return StatusUnknown, fmt.Errorf("unknown status %q", v)
+}
+
+// CanTransition сообщает, допустим ли переход from -> to
+func CanTransition(from, to Status) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition — смена этапа заказа (Rid пустой) или товара
+type Transition struct {
+	OrderUID string    `json:"order_uid"`
+	Rid      string    `json:"rid,omitempty"`
+	From     Status    `json:"from"` // StatusUnknown для первого этапа
+	To       Status    `json:"to"`
+	At       time.Time `json:"at"`
+	Source   *Source   `json:"source,omitempty"`
+}
+
+// TransitionError описывает отклоненный переход
+type TransitionError struct {
+	OrderUID string
+	Rid      string
+	From     Status
+	To       Status
+}
+
+func (e *TransitionError) Error() string {
+	subject := "order " + e.OrderUID
+	if e.Rid != "" {
+		subject += " item " + e.Rid
+	}
+	return fmt.Sprintf("%s: %v: %s -> %s", subject, ErrIllegalTransition, e.From, e.To)
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrIllegalTransition)
+func (e *TransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
+
+// StatusSnapshot — сохраненные этапы заказа и его товаров (по rid)
+type StatusSnapshot struct {
+	Order Status
+	Items map[string]Status
+}
+
+// ApplyStatuses сверяет этапы новой версии заказа с сохраненными (prev равен nil для нового заказа)
+// и возвращает переходы. Этап заказа, не заданный в сообщении, наследуется от сохраненного,
+// а у нового заказа становится StatusCreated. Возвращает *TransitionError для недопустимого перехода.
+// Товары, которых нет в новой версии, не проверяются.
+func (o *Order) ApplyStatuses(prev *StatusSnapshot, at time.Time, source *Source) ([]Transition, error) {
+	var transitions []Transition
+	add := func(rid string, from, to Status) error {
+		if from == to {
+			return nil
+		}
+		if from != StatusUnknown && !CanTransition(from, to) {
+			return &TransitionError{OrderUID: o.OrderUID, Rid: rid, From: from, To: to}
+		}
+		transitions = append(transitions, Transition{OrderUID: o.OrderUID, Rid: rid, From: from, To: to, At: at, Source: source})
+		return nil
+	}
+
+	var prevOrder Status
+	if prev != nil {
+		prevOrder = prev.Order
+	}
+	if o.Status == StatusUnknown {
+		o.Status = prevOrder
+		if o.Status == StatusUnknown {
+			o.Status = StatusCreated
+		}
+	}
+	if err := add("", prevOrder, o.Status); err != nil {
+		return nil, err
+	}
+
+	for _, item := range o.Items {
+		var from Status
+		if prev != nil {
+			from = prev.Items[item.Rid]
+		}
+		if err := add(item.Rid, from, item.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	return transitions, nil
+}
+
+// Snapshot возвращает этапы заказа и товаров
+func (o *Order) Snapshot() *StatusSnapshot {
+	s := &StatusSnapshot{Order: o.Status, Items: make(map[string]Status, len(o.Items))}
+	for _, item := range o.Items {
+		s.Items[item.Rid] = item.Status
+	}
+	return s
+}
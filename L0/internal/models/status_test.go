@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusCreated, StatusPaid, true},
+		{StatusCreated, StatusCancelled, true},
+		{StatusPaid, StatusAssembled, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusAssembled, StatusShipped, true},
+		{StatusAssembled, StatusCancelled, true},
+		{StatusShipped, StatusDelivered, true},
+		{StatusShipped, StatusReturned, true},
+		{StatusDelivered, StatusReturned, true},
+		{StatusPaid, StatusPaid, true},
+		{StatusCancelled, StatusCancelled, true},
+
+		{StatusCreated, StatusShipped, false},
+		{StatusPaid, StatusCreated, false},
+		{StatusShipped, StatusCancelled, false},
+		{StatusDelivered, StatusShipped, false},
+		{StatusReturned, StatusDelivered, false},
+		{StatusCancelled, StatusCreated, false},
+		{StatusCreated, Status(299), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from.String()+"->"+tt.to.String(), func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyStatuses(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	source := &Source{Topic: "orders", Offset: 7}
+	const uid = "b563feb7b2b84b6test"
+	const rid1, rid2 = "ab4219087a764ae0btest", "ab4219087a764ae0btest2"
+
+	// transition возвращает ожидаемый переход заказа (rid пустой) или товара
+	transition := func(rid string, from, to Status) Transition {
+		return Transition{OrderUID: uid, Rid: rid, From: from, To: to, At: at, Source: source}
+	}
+
+	tests := []struct {
+		name       string
+		prev       *StatusSnapshot
+		modify     func(o *Order)
+		want       []Transition
+		wantStatus Status // Этап заказа после ApplyStatuses
+		wantErr    *TransitionError
+	}{
+		{
+			name: "new order without status becomes created",
+			want: []Transition{
+				transition("", StatusUnknown, StatusCreated),
+				transition(rid1, StatusUnknown, StatusCreated),
+				transition(rid2, StatusUnknown, StatusCreated),
+			},
+			wantStatus: StatusCreated,
+		},
+		{
+			name:       "unset status inherits the stored one",
+			prev:       &StatusSnapshot{Order: StatusPaid, Items: map[string]Status{rid1: StatusCreated, rid2: StatusCreated}},
+			wantStatus: StatusPaid,
+		},
+		{
+			name:       "legal order transition",
+			prev:       &StatusSnapshot{Order: StatusPaid, Items: map[string]Status{rid1: StatusCreated, rid2: StatusCreated}},
+			modify:     func(o *Order) { o.Status = StatusAssembled },
+			want:       []Transition{transition("", StatusPaid, StatusAssembled)},
+			wantStatus: StatusAssembled,
+		},
+		{
+			name:    "illegal order transition",
+			prev:    &StatusSnapshot{Order: StatusShipped, Items: map[string]Status{rid1: StatusCreated, rid2: StatusCreated}},
+			modify:  func(o *Order) { o.Status = StatusPaid },
+			wantErr: &TransitionError{OrderUID: uid, From: StatusShipped, To: StatusPaid},
+		},
+		{
+			name: "item transitions are reported per rid",
+			prev: &StatusSnapshot{Order: StatusCreated, Items: map[string]Status{rid1: StatusCreated, rid2: StatusPaid}},
+			modify: func(o *Order) {
+				o.Items[0].Status = StatusPaid
+				o.Items[1].Status = StatusCancelled
+			},
+			want: []Transition{
+				transition(rid1, StatusCreated, StatusPaid),
+				transition(rid2, StatusPaid, StatusCancelled),
+			},
+			wantStatus: StatusCreated,
+		},
+		{
+			name:    "illegal item transition",
+			prev:    &StatusSnapshot{Order: StatusCreated, Items: map[string]Status{rid1: StatusDelivered, rid2: StatusCreated}},
+			modify:  func(o *Order) { o.Items[0].Status = StatusShipped },
+			wantErr: &TransitionError{OrderUID: uid, Rid: rid1, From: StatusDelivered, To: StatusShipped},
+		},
+		{
+			name:       "new item starts without a transition check",
+			prev:       &StatusSnapshot{Order: StatusCreated, Items: map[string]Status{rid1: StatusCreated}},
+			modify:     func(o *Order) { o.Items[1].Status = StatusShipped },
+			want:       []Transition{transition(rid2, StatusUnknown, StatusShipped)},
+			wantStatus: StatusCreated,
+		},
+		{
+			name:       "stored items missing from the new version are not checked",
+			prev:       &StatusSnapshot{Order: StatusCreated, Items: map[string]Status{rid1: StatusCreated, rid2: StatusCreated, "removed": StatusShipped}},
+			wantStatus: StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOrder()
+			if tt.modify != nil {
+				tt.modify(o)
+			}
+
+			got, err := o.ApplyStatuses(tt.prev, at, source)
+			if tt.wantErr != nil {
+				var te *TransitionError
+				if !errors.As(err, &te) || *te != *tt.wantErr {
+					t.Fatalf("ApplyStatuses() error = %v, want %v", err, tt.wantErr)
+				}
+				if !errors.Is(err, ErrIllegalTransition) {
+					t.Errorf("errors.Is(err, ErrIllegalTransition) = false")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyStatuses() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+			if o.Status != tt.wantStatus {
+				t.Errorf("order status = %s, want %s", o.Status, tt.wantStatus)
+			}
+		})
+	}
+}
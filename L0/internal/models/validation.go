@@ -0,0 +1,209 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Правила валидации, на которые ссылаются FieldError
+const (
+	RuleRequired   = "required"
+	RuleFormat     = "format"
+	RuleRange      = "range"
+	RuleSum        = "sum"
+	RuleMatch      = "match"
+	RuleKnownValue = "known_value"
+	RuleUnique     = "unique"
+)
+
+// FieldError описывает нарушение правила в одном поле заказа
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Err     error  `json:"-"` // Сигнальная ошибка для errors.Is, может быть nil
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError содержит все нарушения, найденные в заказе
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid order: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap позволяет проверять сигнальные ошибки через errors.Is
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Err != nil {
+			errs = append(errs, fe.Err)
+		}
+	}
+	return errs
+}
+
+// AsValidationError извлекает ValidationError из цепочки ошибок
+func AsValidationError(err error) (*ValidationError, bool) {
+	var ve *ValidationError
+	ok := errors.As(err, &ve)
+	return ve, ok
+}
+
+// validator накапливает нарушения
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) add(field, rule string, sentinel error, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{
+		Field:   field,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+		Err:     sentinel,
+	})
+}
+
+func (v *validator) result() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
+	phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+)
+
+// Validate проверяет заказ и возвращает *ValidationError со всеми нарушениями
+func (o *Order) Validate() error {
+	v := &validator{}
+
+	if o.OrderUID == "" {
+		v.add("order_uid", RuleRequired, ErrInvalidOrderUID, "is required")
+	}
+	if o.TrackNumber == "" {
+		v.add("track_number", RuleRequired, ErrInvalidTrackNumber, "is required")
+	}
+	if len(o.Items) == 0 {
+		v.add("items", RuleRequired, ErrNoItems, "order must contain at least one item")
+	}
+
+	o.validateDelivery(v)
+	o.validatePayment(v)
+	o.validateItems(v)
+
+	if o.Status != StatusUnknown && !o.Status.Known() {
+		v.add("status", RuleKnownValue, nil, "unknown status %d", o.Status)
+	}
+
+	if o.Locale != "" && !KnownLocales[o.Locale] {
+		v.add("locale", RuleKnownValue, nil, "unknown locale %q", o.Locale)
+	}
+
+	return v.result()
+}
+
+func (o *Order) validateDelivery(v *validator) {
+	d := o.Delivery
+	if d.Email != "" && !emailPattern.MatchString(d.Email) {
+		v.add("delivery.email", RuleFormat, nil, "invalid email format")
+	}
+	if d.Phone != "" && !phonePattern.MatchString(d.Phone) {
+		v.add("delivery.phone", RuleFormat, nil, "invalid phone format")
+	}
+}
+
+func (o *Order) validatePayment(v *validator) {
+	p := o.Payment
+
+	if p.Currency == "" {
+		v.add("payment.currency", RuleRequired, nil, "is required")
+	} else if !ISOCurrencies[p.Currency] {
+		v.add("payment.currency", RuleKnownValue, nil, "%q is not an ISO 4217 currency code", p.Currency)
+	}
+
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"payment.amount", p.Amount},
+		{"payment.delivery_cost", p.DeliveryCost},
+		{"payment.goods_total", p.GoodsTotal},
+		{"payment.custom_fee", p.CustomFee},
+	} {
+		if f.value < 0 {
+			v.add(f.name, RuleRange, nil, "must not be negative, got %d", f.value)
+		}
+	}
+
+	itemsTotal := 0
+	for _, item := range o.Items {
+		itemsTotal += item.TotalPrice
+	}
+	if len(o.Items) > 0 && p.GoodsTotal != itemsTotal {
+		v.add("payment.goods_total", RuleSum, nil, "is %d, but items total_price sum is %d", p.GoodsTotal, itemsTotal)
+	}
+
+	if expected := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != expected {
+		v.add("payment.amount", RuleSum, nil, "is %d, but goods_total + delivery_cost + custom_fee is %d", p.Amount, expected)
+	}
+}
+
+func (o *Order) validateItems(v *validator) {
+	// Товары сверяются с сохраненными по rid, поэтому он должен быть непустым и уникальным в заказе
+	seen := make(map[string]int, len(o.Items))
+	for i, item := range o.Items {
+		prefix := fmt.Sprintf("items[%d].", i)
+
+		if item.Rid == "" {
+			v.add(prefix+"rid", RuleRequired, nil, "is required")
+		} else if first, ok := seen[item.Rid]; ok {
+			v.add(prefix+"rid", RuleUnique, nil, "duplicates items[%d].rid", first)
+		} else {
+			seen[item.Rid] = i
+		}
+
+		if item.Price < 0 {
+			v.add(prefix+"price", RuleRange, nil, "must not be negative, got %d", item.Price)
+		}
+		if item.Sale < 0 || item.Sale > 100 {
+			v.add(prefix+"sale", RuleRange, nil, "must be between 0 and 100, got %d", item.Sale)
+		} else if expected := ItemTotalPrice(item.Price, item.Sale); abs(item.TotalPrice-expected) > 1 {
+			v.add(prefix+"total_price", RuleSum, nil, "is %d, but price %d with sale %d%% gives %d", item.TotalPrice, item.Price, item.Sale, expected)
+		}
+
+		if !item.Status.Known() {
+			v.add(prefix+"status", RuleKnownValue, nil, "unknown status %d", item.Status)
+		}
+
+		if o.TrackNumber != "" && item.TrackNumber != o.TrackNumber {
+			v.add(prefix+"track_number", RuleMatch, nil, "is %q, but order track_number is %q", item.TrackNumber, o.TrackNumber)
+		}
+	}
+}
+
+// ItemTotalPrice возвращает цену товара со скидкой sale (в процентах), округленную вниз.
+// При проверке допускается расхождение на единицу из-за округления.
+func ItemTotalPrice(price, sale int) int {
+	return price * (100 - sale) / 100
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testOrder возвращает валидный заказ с двумя товарами
+func testOrder() *Order {
+	item := func(rid string, price, sale, total int) Item {
+		return Item{
+			ChrtID:      9934930,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       price,
+			Rid:         rid,
+			Name:        "Mascaras",
+			Sale:        sale,
+			Size:        "0",
+			TotalPrice:  total,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      StatusCreated,
+		}
+	}
+	return &Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       2317,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   817,
+		},
+		Items:           []Item{item("ab4219087a764ae0btest", 453, 30, 317), item("ab4219087a764ae0btest2", 500, 0, 500)},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+}
+
+// violation — поле и правило ожидаемого нарушения
+type violation struct {
+	field string
+	rule  string
+}
+
+// violations возвращает нарушения из ошибки Validate в порядке обнаружения
+func violations(t *testing.T, err error) []violation {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	ve, ok := AsValidationError(err)
+	if !ok {
+		t.Fatalf("Validate() error = %v, want *ValidationError", err)
+	}
+	got := make([]violation, 0, len(ve.Errors))
+	for _, fe := range ve.Errors {
+		got = append(got, violation{field: fe.Field, rule: fe.Rule})
+	}
+	return got
+}
+
+func TestOrderValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *Order)
+		want   []violation
+	}{
+		{
+			name:   "valid order",
+			modify: func(o *Order) {},
+		},
+		{
+			name:   "goods_total differs from items total_price sum",
+			modify: func(o *Order) { o.Payment.GoodsTotal = 800; o.Payment.Amount = 2300 },
+			want:   []violation{{"payment.goods_total", RuleSum}},
+		},
+		{
+			name:   "amount differs from goods_total, delivery_cost and custom_fee",
+			modify: func(o *Order) { o.Payment.CustomFee = 10 },
+			want:   []violation{{"payment.amount", RuleSum}},
+		},
+		{
+			name:   "amount includes custom_fee",
+			modify: func(o *Order) { o.Payment.CustomFee = 10; o.Payment.Amount = 2327 },
+		},
+		{
+			name:   "item total_price within rounding of price and sale",
+			modify: func(o *Order) { o.Items[0].TotalPrice = 318; o.Payment.GoodsTotal = 818; o.Payment.Amount = 2318 },
+		},
+		{
+			name:   "item total_price does not match price and sale",
+			modify: func(o *Order) { o.Items[0].TotalPrice = 453; o.Payment.GoodsTotal = 953; o.Payment.Amount = 2453 },
+			want:   []violation{{"items[0].total_price", RuleSum}},
+		},
+		{
+			name:   "sale out of range",
+			modify: func(o *Order) { o.Items[1].Sale = 101 },
+			want:   []violation{{"items[1].sale", RuleRange}},
+		},
+		{
+			name:   "negative amounts",
+			modify: func(o *Order) { o.Payment.DeliveryCost = -1; o.Payment.Amount = 816 },
+			want:   []violation{{"payment.delivery_cost", RuleRange}},
+		},
+		{
+			name:   "item track_number differs from the order",
+			modify: func(o *Order) { o.Items[1].TrackNumber = "OTHERTRACK" },
+			want:   []violation{{"items[1].track_number", RuleMatch}},
+		},
+		{
+			name:   "invalid email",
+			modify: func(o *Order) { o.Delivery.Email = "test.gmail.com" },
+			want:   []violation{{"delivery.email", RuleFormat}},
+		},
+		{
+			name:   "invalid phone",
+			modify: func(o *Order) { o.Delivery.Phone = "+972-000" },
+			want:   []violation{{"delivery.phone", RuleFormat}},
+		},
+		{
+			name:   "empty email and phone are allowed",
+			modify: func(o *Order) { o.Delivery.Email = ""; o.Delivery.Phone = "" },
+		},
+		{
+			name:   "missing currency",
+			modify: func(o *Order) { o.Payment.Currency = "" },
+			want:   []violation{{"payment.currency", RuleRequired}},
+		},
+		{
+			name:   "unknown currency",
+			modify: func(o *Order) { o.Payment.Currency = "usd" },
+			want:   []violation{{"payment.currency", RuleKnownValue}},
+		},
+		{
+			name:   "unknown locale",
+			modify: func(o *Order) { o.Locale = "xx" },
+			want:   []violation{{"locale", RuleKnownValue}},
+		},
+		{
+			name: "several violations are collected at once",
+			modify: func(o *Order) {
+				o.OrderUID = ""
+				o.Delivery.Email = "invalid"
+				o.Payment.Currency = "XXX"
+				o.Items[0].TrackNumber = "OTHERTRACK"
+			},
+			want: []violation{
+				{"order_uid", RuleRequired},
+				{"delivery.email", RuleFormat},
+				{"payment.currency", RuleKnownValue},
+				{"items[0].track_number", RuleMatch},
+			},
+		},
+		{
+			name:   "order without items",
+			modify: func(o *Order) { o.Items = nil; o.Payment.GoodsTotal = 0; o.Payment.Amount = 1500 },
+			want:   []violation{{"items", RuleRequired}},
+		},
+		{
+			name:   "empty item rid",
+			modify: func(o *Order) { o.Items[1].Rid = "" },
+			want:   []violation{{"items[1].rid", RuleRequired}},
+		},
+		{
+			name:   "duplicate item rid",
+			modify: func(o *Order) { o.Items[1].Rid = o.Items[0].Rid },
+			want:   []violation{{"items[1].rid", RuleUnique}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := testOrder()
+			tt.modify(o)
+
+			err := o.Validate()
+			got := violations(t, err)
+			if len(got) != len(tt.want) {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("violations[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+			if want := o.OrderUID == ""; errors.Is(err, ErrInvalidOrderUID) != want {
+				t.Errorf("errors.Is(err, ErrInvalidOrderUID) = %v, want %v", !want, want)
+			}
+		})
+	}
+}
+
+func TestValidationErrorOmitsPersonalData(t *testing.T) {
+	o := testOrder()
+	o.Delivery.Email = "john.doe.example.com"
+	o.Delivery.Phone = "call-me-555"
+
+	err := o.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want violations")
+	}
+	for _, value := range []string{o.Delivery.Email, o.Delivery.Phone} {
+		if strings.Contains(err.Error(), value) {
+			t.Errorf("error %q contains personal data %q", err.Error(), value)
+		}
+	}
+}
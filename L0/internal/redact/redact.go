@@ -0,0 +1,332 @@
+// Package redact маскирует персональные данные покупателя (models.Delivery) и транзакцию оплаты
+// в ответах API в зависимости от роли вызывающей стороны и в логах в зависимости от уровня записи.
+package redact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/internal/auth"
+	"order-service/internal/models"
+	"strings"
+)
+
+// Mode — степень маскирования
+type Mode string
+
+// Режимы маскирования
+const (
+	ModeNone    Mode = "none"    // Значения не изменяются
+	ModePartial Mode = "partial" // Остается фрагмент для сверки: инициалы, последние цифры, домен почты
+	ModeFull    Mode = "full"    // Значение заменяется на Mask
+)
+
+// Mask заменяет скрытое значение или его часть
+const Mask = "***"
+
+// ParseMode возвращает режим маскирования по названию
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(name); m {
+	case ModeNone, ModePartial, ModeFull:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown redaction mode %q (expected %s, %s or %s)", name, ModeNone, ModePartial, ModeFull)
+	}
+}
+
+// Уровни логов, для которых задается маскирование
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+)
+
+// field — маскируемое поле: путь в JSON заказа и частичное маскирование
+type field struct {
+	path    string
+	partial func(string) string
+}
+
+// fields — поля, которые можно маскировать, по названию
+var fields = map[string]field{
+	"name":        {path: "delivery.name", partial: maskName},
+	"phone":       {path: "delivery.phone", partial: func(s string) string { return keepSuffix(s, 4) }},
+	"zip":         {path: "delivery.zip", partial: func(s string) string { return keepPrefix(s, 3) }},
+	"city":        {path: "delivery.city", partial: func(s string) string { return keepPrefix(s, 1) }},
+	"address":     {path: "delivery.address", partial: maskAddress},
+	"region":      {path: "delivery.region", partial: func(s string) string { return keepPrefix(s, 1) }},
+	"email":       {path: "delivery.email", partial: maskEmail},
+	"transaction": {path: "payment.transaction", partial: func(s string) string { return keepSuffix(s, 4) }},
+}
+
+// Policy задает маскируемые поля и режим для каждой роли и уровня логов
+type Policy struct {
+	Fields  []string // Названия полей: name, phone, zip, city, address, region, email, transaction
+	Reader  Mode
+	Support Mode
+	Admin   Mode
+	Debug   Mode // Записи level=debug, например тело сообщения Kafka
+	Info    Mode // Записи level=info и выше
+}
+
+// DefaultPolicy возвращает политику по умолчанию: город и регион не маскируются,
+// читатели и поддержка видят фрагменты, администраторы — полные значения, в логах
+// значения скрыты. Записи level=debug выводятся всегда: отдельного уровня логов нет.
+func DefaultPolicy() Policy {
+	return Policy{
+		Fields:  []string{"name", "phone", "zip", "address", "email", "transaction"},
+		Reader:  ModePartial,
+		Support: ModePartial,
+		Admin:   ModeNone,
+		Debug:   ModeFull,
+		Info:    ModeFull,
+	}
+}
+
+// ParseFields разбирает список полей через запятую, пропуская пустые элементы
+func ParseFields(list string) []string {
+	var out []string
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Validate проверяет названия полей и режимы
+func (p Policy) Validate() error {
+	for _, name := range p.Fields {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("unknown field %q (expected name, phone, zip, city, address, region, email or transaction)", name)
+		}
+	}
+	for _, m := range []Mode{p.Reader, p.Support, p.Admin, p.Debug, p.Info} {
+		if _, err := ParseMode(string(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redactor применяет политику маскирования. Нулевое значение не используется — только New.
+type Redactor struct {
+	fields map[string]field // Путь в JSON заказа -> поле
+	roles  map[auth.Role]Mode
+	levels map[string]Mode
+}
+
+// New создает Redactor по политике
+func New(p Policy) (*Redactor, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &Redactor{
+		fields: make(map[string]field, len(p.Fields)),
+		roles:  map[auth.Role]Mode{auth.RoleReader: p.Reader, auth.RoleSupport: p.Support, auth.RoleAdmin: p.Admin},
+		levels: map[string]Mode{LevelDebug: p.Debug, LevelInfo: p.Info},
+	}
+	for _, name := range p.Fields {
+		f := fields[name]
+		r.fields[f.path] = f
+	}
+	return r, nil
+}
+
+// Default возвращает Redactor с политикой по умолчанию
+func Default() *Redactor {
+	r, err := New(DefaultPolicy())
+	if err != nil {
+		panic(err) // Политика по умолчанию всегда корректна
+	}
+	return r
+}
+
+// ForRole возвращает режим для роли. Для неизвестной роли применяется ModeFull.
+func (r *Redactor) ForRole(role auth.Role) Mode {
+	if m, ok := r.roles[role]; ok {
+		return m
+	}
+	return ModeFull
+}
+
+// ForRequest возвращает режим для вызывающей стороны запроса.
+// Анонимный запрос (маршрут без middleware или выключенная аутентификация) получает
+// режим роли reader независимо от роли в контексте.
+func (r *Redactor) ForRequest(ctx context.Context) Mode {
+	p := auth.FromContext(ctx)
+	if p == nil || p.Method == auth.MethodNone {
+		return r.ForRole(auth.RoleReader)
+	}
+	return r.ForRole(p.Role)
+}
+
+// ForLog возвращает режим для записи лога уровня level
+func (r *Redactor) ForLog(level string) Mode {
+	if m, ok := r.levels[level]; ok {
+		return m
+	}
+	return r.levels[LevelInfo]
+}
+
+// Value маскирует значение поля по пути в JSON заказа, например delivery.phone.
+// Значения других полей возвращаются без изменений.
+func (r *Redactor) Value(path string, value interface{}, mode Mode) interface{} {
+	s, ok := value.(string)
+	if !ok || mode == ModeNone {
+		return value
+	}
+	if f, ok := r.fields[path]; ok {
+		return mask(f, s, mode)
+	}
+	return value
+}
+
+// String маскирует строковое значение поля по пути в JSON заказа
+func (r *Redactor) String(path, value string, mode Mode) string {
+	return r.Value(path, value, mode).(string)
+}
+
+// Order возвращает копию заказа с замаскированными полями. Заказ из кеша не изменяется.
+func (r *Redactor) Order(o *models.Order, mode Mode) *models.Order {
+	if o == nil || mode == ModeNone {
+		return o
+	}
+
+	c := *o
+	d := &c.Delivery
+	for path, v := range map[string]*string{
+		"delivery.name":       &d.Name,
+		"delivery.phone":      &d.Phone,
+		"delivery.zip":        &d.Zip,
+		"delivery.city":       &d.City,
+		"delivery.address":    &d.Address,
+		"delivery.region":     &d.Region,
+		"delivery.email":      &d.Email,
+		"payment.transaction": &c.Payment.Transaction,
+	} {
+		*v = r.String(path, *v, mode)
+	}
+	return &c
+}
+
+// Orders маскирует список заказов
+func (r *Redactor) Orders(orders []*models.Order, mode Mode) []*models.Order {
+	if mode == ModeNone {
+		return orders
+	}
+	out := make([]*models.Order, len(orders))
+	for i, o := range orders {
+		out[i] = r.Order(o, mode)
+	}
+	return out
+}
+
+// JSON маскирует поля в JSON документе заказа: теле сообщения Kafka или ревизии.
+// Документ, который не является JSON объектом, возвращается с ошибкой.
+func (r *Redactor) JSON(data []byte, mode Mode) ([]byte, error) {
+	if mode == ModeNone {
+		return data, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errors.New("document is not a JSON object")
+	}
+
+	for path := range r.fields {
+		section, key, _ := strings.Cut(path, ".")
+		if obj, ok := doc[section].(map[string]interface{}); ok {
+			if v, ok := obj[key]; ok {
+				obj[key] = r.Value(path, v, mode)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Body возвращает тело сообщения для лога. Тело, которое не удалось разобрать,
+// при включенном маскировании не выводится: остается только его размер.
+func (r *Redactor) Body(data []byte, mode Mode) string {
+	if len(data) == 0 {
+		return ""
+	}
+	out, err := r.JSON(data, mode)
+	if err != nil {
+		return fmt.Sprintf("<%d bytes, not a JSON object>", len(data))
+	}
+	return string(out)
+}
+
+func mask(f field, s string, mode Mode) string {
+	if s == "" {
+		return s
+	}
+	switch mode {
+	case ModeNone:
+		return s
+	case ModePartial:
+		return f.partial(s)
+	default:
+		return Mask
+	}
+}
+
+// keepPrefix оставляет первые n символов. Короткое значение скрывается целиком.
+func keepPrefix(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= 2*n {
+		return Mask
+	}
+	return string(runes[:n]) + Mask
+}
+
+// keepSuffix оставляет последние n символов. Короткое значение скрывается целиком.
+func keepSuffix(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= 2*n {
+		return Mask
+	}
+	return Mask + string(runes[len(runes)-n:])
+}
+
+// maskName оставляет инициалы: "Test Testov" -> "T*** T***"
+func maskName(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = string([]rune(w)[:1]) + Mask
+	}
+	return strings.Join(words, " ")
+}
+
+// maskAddress оставляет первое слово: "Ploshad Mira 15" -> "Ploshad ***"
+func maskAddress(s string) string {
+	words := strings.Fields(s)
+	if len(words) < 2 {
+		return Mask
+	}
+	return words[0] + " " + Mask
+}
+
+// maskEmail оставляет первый символ и домен: "test@gmail.com" -> "t***@gmail.com"
+func maskEmail(s string) string {
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" {
+		return Mask
+	}
+	return string([]rune(local)[:1]) + Mask + "@" + domain
+}
@@ -0,0 +1,110 @@
+package redact
+
+import (
+	"context"
+	"order-service/internal/auth"
+	"order-service/internal/models"
+	"testing"
+)
+
+func TestForRequest(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Reader = ModeFull
+	policy.Support = ModePartial
+	r, err := New(policy)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		want      Mode
+	}{
+		{name: "no principal", want: ModeFull},
+		{name: "anonymous", principal: auth.Anonymous(), want: ModeFull},
+		{name: "anonymous with a higher role", principal: &auth.Principal{Subject: "anonymous", Role: auth.RoleAdmin, Method: auth.MethodNone}, want: ModeFull},
+		{name: "reader", principal: &auth.Principal{Subject: "web", Role: auth.RoleReader, Method: auth.MethodAPIKey}, want: ModeFull},
+		{name: "support", principal: &auth.Principal{Subject: "desk", Role: auth.RoleSupport, Method: auth.MethodJWT}, want: ModePartial},
+		{name: "admin", principal: &auth.Principal{Subject: "ops", Role: auth.RoleAdmin, Method: auth.MethodAPIKey}, want: ModeNone},
+		{name: "unknown role", principal: &auth.Principal{Subject: "x", Role: auth.RoleNone, Method: auth.MethodJWT}, want: ModeFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.WithPrincipal(ctx, tt.principal)
+			}
+			if got := r.ForRequest(ctx); got != tt.want {
+				t.Errorf("ForRequest() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForLogDefaults(t *testing.T) {
+	r := Default()
+
+	tests := []struct {
+		level string
+		want  Mode
+	}{
+		{level: LevelDebug, want: ModeFull},
+		{level: LevelInfo, want: ModeFull},
+		{level: "warn", want: ModeFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			if got := r.ForLog(tt.level); got != tt.want {
+				t.Errorf("ForLog(%s) = %s, want %s", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	o := &models.Order{
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test"},
+	}
+	r := Default()
+
+	tests := []struct {
+		mode Mode
+		want models.Delivery
+		tx   string
+	}{
+		{mode: ModeNone, want: o.Delivery, tx: "b563feb7b2b84b6test"},
+		{
+			mode: ModePartial,
+			want: models.Delivery{Name: "T*** T***", Phone: "***0000", Zip: "263***", City: "Kiryat Mozkin", Address: "Ploshad ***", Email: "t***@gmail.com"},
+			tx:   "***test",
+		},
+		{
+			mode: ModeFull,
+			want: models.Delivery{Name: Mask, Phone: Mask, Zip: Mask, City: "Kiryat Mozkin", Address: Mask, Email: Mask},
+			tx:   Mask,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			got := r.Order(o, tt.mode)
+			if got.Delivery != tt.want || got.Payment.Transaction != tt.tx {
+				t.Errorf("Order() = %+v, %q; want %+v, %q", got.Delivery, got.Payment.Transaction, tt.want, tt.tx)
+			}
+			if o.Delivery.Phone != "+9720000000" {
+				t.Fatal("Order() modified the source order")
+			}
+		})
+	}
+}
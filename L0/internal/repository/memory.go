@@ -0,0 +1,464 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"order-service/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory — потокобезопасная in-memory реализация OrderRepository.
+// Повторяет семантику PostgreSQL реализации: upsert, журнал ревизий,
+// переходы между этапами, фильтры и курсорную пагинацию.
+type Memory struct {
+	mu          sync.RWMutex
+	orders      map[string]*models.Order
+	revisions   map[string][]*models.Revision
+	transitions map[string][]*models.Transition
+	offsets     map[offsetKey]int64
+	now         func() time.Time
+}
+
+type offsetKey struct {
+	group     string
+	topic     string
+	partition int
+}
+
+var (
+	_ OrderRepository = (*Memory)(nil)
+	_ OffsetStore     = (*Memory)(nil)
+)
+
+// NewMemory создает пустое in-memory хранилище
+func NewMemory() *Memory {
+	return &Memory{
+		orders:      make(map[string]*models.Order),
+		revisions:   make(map[string][]*models.Revision),
+		transitions: make(map[string][]*models.Transition),
+		offsets:     make(map[offsetKey]int64),
+		now:         time.Now,
+	}
+}
+
+// SaveOrder сохраняет копию заказа и добавляет ревизию, если содержимое изменилось
+func (m *Memory) SaveOrder(order *models.Order, source *models.Source) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.save(order, source)
+}
+
+// SaveOrders сохраняет пакет заказов атомарно: при ошибке хранилище не меняется
+func (m *Memory) SaveOrders(writes []OrderWrite) error {
+	// Ошибки save — сериализация и недопустимый переход, поэтому они проверяются до изменений
+	for _, w := range writes {
+		if _, err := w.Order.ToJSON(); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshots := make(map[string]*models.StatusSnapshot)
+	for _, w := range writes {
+		prev, ok := snapshots[w.Order.OrderUID]
+		if existing, stored := m.orders[w.Order.OrderUID]; !ok && stored {
+			prev = existing.Snapshot()
+		}
+		check := cloneOrder(w.Order)
+		if _, err := check.ApplyStatuses(prev, m.now().UTC(), w.Source); err != nil {
+			return err
+		}
+		snapshots[w.Order.OrderUID] = check.Snapshot()
+	}
+
+	for _, w := range writes {
+		if err := m.save(w.Order, w.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save сохраняет заказ и ревизию; вызывается под блокировкой
+func (m *Memory) save(order *models.Order, source *models.Source) error {
+	now := m.now().UTC()
+	var prev *models.StatusSnapshot
+	existing, ok := m.orders[order.OrderUID]
+	if ok {
+		prev = existing.Snapshot()
+	}
+	transitions, err := order.ApplyStatuses(prev, now, source)
+	if err != nil {
+		return err
+	}
+
+	// Отмена не берется из тела заказа и переживает обновления, как в PostgreSQL;
+	// переданный заказ получает сохраненные значения
+	order.CancelledAt, order.CancelReason = nil, ""
+	createdAt := now
+	if ok {
+		createdAt = existing.CreatedAt
+		order.CancelledAt, order.CancelReason = existing.CancelledAt, existing.CancelReason
+	}
+	if order.CancelledAt == nil && order.Status == models.StatusCancelled {
+		order.CancelledAt = &now
+	}
+	m.addTransitions(transitions)
+	stored := cloneOrder(order)
+	stored.CreatedAt = createdAt
+	m.orders[order.OrderUID] = stored
+	m.saveOffset(source)
+
+	return m.addRevision(order, source)
+}
+
+// addRevision добавляет ревизию, если содержимое заказа изменилось; вызывается под блокировкой
+func (m *Memory) addRevision(order *models.Order, source *models.Source) error {
+	data, err := order.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	revisions := m.revisions[order.OrderUID]
+	if n := len(revisions); n > 0 && bytes.Equal(revisions[n-1].Order, data) {
+		return nil
+	}
+
+	rev := &models.Revision{
+		OrderUID:  order.OrderUID,
+		Revision:  len(revisions) + 1,
+		Order:     data,
+		CreatedAt: m.now().UTC(),
+	}
+	if source != nil {
+		src := *source
+		rev.Source = &src
+	}
+	m.revisions[order.OrderUID] = append(revisions, rev)
+
+	return nil
+}
+
+// SaveOffsets сохраняет смещения сообщений с группой
+func (m *Memory) SaveOffsets(ctx context.Context, sources []*models.Source) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, source := range sources {
+		m.saveOffset(source)
+	}
+	return nil
+}
+
+// LoadOffsets возвращает следующие смещения партиций топика для группы
+func (m *Memory) LoadOffsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	offsets := make(map[int]int64)
+	for k, offset := range m.offsets {
+		if k.group == group && k.topic == topic {
+			offsets[k.partition] = offset
+		}
+	}
+	return offsets, nil
+}
+
+// saveOffset запоминает следующее смещение; вызывается под блокировкой
+func (m *Memory) saveOffset(source *models.Source) {
+	if source == nil || source.Group == "" {
+		return
+	}
+	k := offsetKey{source.Group, source.Topic, source.Partition}
+	if next := source.Offset + 1; next > m.offsets[k] {
+		m.offsets[k] = next
+	}
+}
+
+// GetOrder возвращает копию заказа
+func (m *Memory) GetOrder(orderUID string) (*models.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	order, ok := m.orders[orderUID]
+	if !ok {
+		return nil, models.ErrOrderNotFound
+	}
+	return cloneOrder(order), nil
+}
+
+// FindOrderUIDByTrackNumber возвращает UID последнего заказа с трек-номером
+func (m *Memory) FindOrderUIDByTrackNumber(trackNumber string) (string, error) {
+	return m.findLatest(func(o *models.Order) bool { return o.TrackNumber == trackNumber })
+}
+
+// FindOrderUIDByTransaction возвращает UID последнего заказа с транзакцией оплаты
+func (m *Memory) FindOrderUIDByTransaction(transaction string) (string, error) {
+	return m.findLatest(func(o *models.Order) bool { return o.Payment.Transaction == transaction })
+}
+
+// ListOrders возвращает страницу заказов по фильтру
+func (m *Memory) ListOrders(filter models.OrderFilter) ([]*models.Order, *models.Cursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	page, next := m.page(filter)
+	orders := make([]*models.Order, 0, len(page))
+	for _, o := range page {
+		orders = append(orders, cloneOrder(o))
+	}
+	return orders, next, nil
+}
+
+// ListOrderSummaries возвращает страницу кратких записей заказов
+func (m *Memory) ListOrderSummaries(filter models.OrderFilter) ([]*models.OrderSummary, *models.Cursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	page, next := m.page(filter)
+	summaries := make([]*models.OrderSummary, 0, len(page))
+	for _, o := range page {
+		summaries = append(summaries, &models.OrderSummary{
+			OrderUID:        o.OrderUID,
+			TrackNumber:     o.TrackNumber,
+			CustomerID:      o.CustomerID,
+			DeliveryService: o.DeliveryService,
+			DateCreated:     o.DateCreated,
+			Currency:        o.Payment.Currency,
+			Provider:        o.Payment.Provider,
+			Amount:          o.Payment.Amount,
+			ItemsCount:      len(o.Items),
+			Status:          o.Status,
+			CreatedAt:       o.CreatedAt,
+		})
+	}
+	return summaries, next, nil
+}
+
+// DeleteOrder удаляет заказ и сохраняет смещение source; журнал ревизий сохраняется, как и в PostgreSQL
+func (m *Memory) DeleteOrder(orderUID string, source *models.Source) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saveOffset(source)
+	if _, ok := m.orders[orderUID]; !ok {
+		return models.ErrOrderNotFound
+	}
+	delete(m.orders, orderUID)
+	return nil
+}
+
+// CancelOrder отмечает заказ отмененным и добавляет ревизию
+func (m *Memory) CancelOrder(orderUID, reason string, at time.Time, source *models.Source) (*models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.orders[orderUID]
+	if !ok {
+		return nil, models.ErrOrderNotFound
+	}
+	if stored.Status != models.StatusCancelled {
+		if !models.CanTransition(stored.Status, models.StatusCancelled) {
+			return nil, &models.TransitionError{OrderUID: orderUID, From: stored.Status, To: models.StatusCancelled}
+		}
+		m.addTransitions([]models.Transition{{
+			OrderUID: orderUID,
+			From:     stored.Status,
+			To:       models.StatusCancelled,
+			At:       at.UTC(),
+			Source:   source,
+		}})
+		stored.Status = models.StatusCancelled
+	}
+	if stored.CancelledAt == nil {
+		cancelledAt := at.UTC()
+		stored.CancelledAt, stored.CancelReason = &cancelledAt, reason
+	}
+	m.saveOffset(source)
+
+	if err := m.addRevision(stored, source); err != nil {
+		return nil, err
+	}
+	return cloneOrder(stored), nil
+}
+
+// addTransitions добавляет переходы в журнал; вызывается под блокировкой
+func (m *Memory) addTransitions(transitions []models.Transition) {
+	for _, t := range transitions {
+		t := t
+		if t.Source != nil {
+			src := *t.Source
+			t.Source = &src
+		}
+		m.transitions[t.OrderUID] = append(m.transitions[t.OrderUID], &t)
+	}
+}
+
+// GetOrderTransitions возвращает журнал переходов заказа
+func (m *Memory) GetOrderTransitions(orderUID string) ([]*models.Transition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transitions := m.transitions[orderUID]
+	result := make([]*models.Transition, len(transitions))
+	copy(result, transitions)
+	return result, nil
+}
+
+// GetOrderRevisions возвращает журнал ревизий заказа
+func (m *Memory) GetOrderRevisions(orderUID string) ([]*models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := m.revisions[orderUID]
+	result := make([]*models.Revision, len(revisions))
+	copy(result, revisions)
+	return result, nil
+}
+
+// GetOrderRevision возвращает одну ревизию заказа
+func (m *Memory) GetOrderRevision(orderUID string, revision int) (*models.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := m.revisions[orderUID]
+	if revision < 1 || revision > len(revisions) {
+		return nil, models.ErrRevisionNotFound
+	}
+	return revisions[revision-1], nil
+}
+
+// CountOrders возвращает количество заказов
+func (m *Memory) CountOrders(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.orders), nil
+}
+
+// StreamOrders передает все заказы порциями от новых к старым
+func (m *Memory) StreamOrders(ctx context.Context, chunkSize int, fn func([]*models.Order) error) error {
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+
+	m.mu.RLock()
+	sorted := m.sorted()
+	orders := make([]*models.Order, 0, len(sorted))
+	for _, o := range sorted {
+		orders = append(orders, cloneOrder(o))
+	}
+	m.mu.RUnlock()
+
+	for start := 0; start < len(orders); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(start+chunkSize, len(orders))
+		if err := fn(orders[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findLatest возвращает UID самого нового заказа, удовлетворяющего условию
+func (m *Memory) findLatest(match func(*models.Order) bool) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, o := range m.sorted() {
+		if match(o) {
+			return o.OrderUID, nil
+		}
+	}
+	return "", models.ErrOrderNotFound
+}
+
+// page отбирает заказы по фильтру после курсора; вызывается под блокировкой
+func (m *Memory) page(filter models.OrderFilter) ([]*models.Order, *models.Cursor) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultListLimit
+	}
+	if limit > models.MaxListLimit {
+		limit = models.MaxListLimit
+	}
+
+	var page []*models.Order
+	for _, o := range m.sorted() {
+		if filter.Cursor != nil && !before(o, filter.Cursor) {
+			continue
+		}
+		if !matches(o, filter) {
+			continue
+		}
+		if len(page) == limit {
+			last := page[limit-1]
+			return page, &models.Cursor{CreatedAt: last.CreatedAt, OrderUID: last.OrderUID}
+		}
+		page = append(page, o)
+	}
+
+	return page, nil
+}
+
+// sorted возвращает заказы по убыванию (created_at, order_uid)
+func (m *Memory) sorted() []*models.Order {
+	orders := make([]*models.Order, 0, len(m.orders))
+	for _, o := range m.orders {
+		orders = append(orders, o)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.After(orders[j].CreatedAt)
+		}
+		return orders[i].OrderUID > orders[j].OrderUID
+	})
+	return orders
+}
+
+// before сообщает, идет ли заказ после курсора в порядке сортировки
+func before(o *models.Order, c *models.Cursor) bool {
+	if !o.CreatedAt.Equal(c.CreatedAt) {
+		return o.CreatedAt.Before(c.CreatedAt)
+	}
+	return o.OrderUID < c.OrderUID
+}
+
+// matches проверяет заказ на соответствие фильтру
+func matches(o *models.Order, f models.OrderFilter) bool {
+	switch {
+	case f.CustomerID != "" && o.CustomerID != f.CustomerID,
+		f.TrackNumber != "" && o.TrackNumber != f.TrackNumber,
+		f.DeliveryService != "" && o.DeliveryService != f.DeliveryService,
+		!f.DateFrom.IsZero() && o.DateCreated.Before(f.DateFrom),
+		!f.DateTo.IsZero() && !o.DateCreated.Before(f.DateTo),
+		f.Currency != "" && o.Payment.Currency != f.Currency,
+		f.Provider != "" && o.Payment.Provider != f.Provider:
+		return false
+	}
+
+	if f.Brand != "" {
+		for _, item := range o.Items {
+			if item.Brand == f.Brand {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// cloneOrder копирует заказ, чтобы вызывающий код не менял хранимую версию
+func cloneOrder(o *models.Order) *models.Order {
+	c := *o
+	c.Items = append([]models.Item(nil), o.Items...)
+	return &c
+}
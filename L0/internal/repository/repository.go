@@ -0,0 +1,68 @@
+// Package repository описывает хранилище заказов, от которого зависят
+// HTTP handlers и Kafka consumer, и содержит его in-memory реализацию.
+package repository
+
+import (
+	"context"
+	"order-service/internal/models"
+	"time"
+)
+
+// OrderRepository — хранилище заказов.
+// Реализации: *database.DB (PostgreSQL) и *Memory (для тестов).
+type OrderRepository interface {
+	// SaveOrder сохраняет или полностью заменяет заказ и добавляет ревизию; source может быть nil.
+	// Отмена заказа при замене сохраняется: поля отмены order заполняются сохраненными значениями.
+	// Смена этапов заказа и товаров записывается в журнал переходов; недопустимый переход
+	// возвращается как *models.TransitionError, и заказ не сохраняется
+	SaveOrder(order *models.Order, source *models.Source) error
+	// SaveOrders сохраняет пакет заказов в одной транзакции: либо все, либо ни одного.
+	// Поля отмены и этапы проверяются и заполняются, как в SaveOrder
+	SaveOrders(writes []OrderWrite) error
+	// GetOrder возвращает заказ или models.ErrOrderNotFound
+	GetOrder(orderUID string) (*models.Order, error)
+	// FindOrderUIDByTrackNumber возвращает UID последнего заказа с трек-номером или models.ErrOrderNotFound
+	FindOrderUIDByTrackNumber(trackNumber string) (string, error)
+	// FindOrderUIDByTransaction возвращает UID последнего заказа с транзакцией оплаты или models.ErrOrderNotFound
+	FindOrderUIDByTransaction(transaction string) (string, error)
+	// ListOrders возвращает страницу заказов по фильтру и курсор следующей страницы
+	ListOrders(filter models.OrderFilter) ([]*models.Order, *models.Cursor, error)
+	// ListOrderSummaries возвращает страницу кратких записей заказов
+	ListOrderSummaries(filter models.OrderFilter) ([]*models.OrderSummary, *models.Cursor, error)
+	// DeleteOrder удаляет заказ вместе с доставкой, оплатой и товарами; source может быть nil.
+	// Смещение source сохраняется в той же транзакции, даже если заказа нет.
+	// Журнал ревизий сохраняется; возвращает models.ErrOrderNotFound, если заказа нет
+	DeleteOrder(orderUID string, source *models.Source) error
+	// CancelOrder переводит заказ в этап models.StatusCancelled и добавляет ревизию; source может быть nil.
+	// Повторная отмена сохраняет время и причину первой. Возвращает отмененный заказ,
+	// models.ErrOrderNotFound или *models.TransitionError
+	CancelOrder(orderUID, reason string, at time.Time, source *models.Source) (*models.Order, error)
+
+	// GetOrderRevisions возвращает журнал ревизий заказа
+	GetOrderRevisions(orderUID string) ([]*models.Revision, error)
+	// GetOrderRevision возвращает ревизию или models.ErrRevisionNotFound
+	GetOrderRevision(orderUID string, revision int) (*models.Revision, error)
+	// GetOrderTransitions возвращает журнал переходов между этапами заказа и его товаров
+	GetOrderTransitions(orderUID string) ([]*models.Transition, error)
+
+	// CountOrders возвращает количество заказов
+	CountOrders(ctx context.Context) (int, error)
+	// StreamOrders передает все заказы порциями от новых к старым
+	StreamOrders(ctx context.Context, chunkSize int, fn func([]*models.Order) error) error
+}
+
+// OrderWrite — заказ и сообщение, из которого он получен, для пакетного сохранения
+type OrderWrite struct {
+	Order  *models.Order
+	Source *models.Source
+}
+
+// OffsetStore хранит смещения Kafka рядом с заказами.
+// SaveOrder и SaveOrders записывают смещение источника с заданной Group в той же транзакции,
+// что и заказ; SaveOffsets — для сообщений, которые не сохраняют заказ (dead-letter).
+type OffsetStore interface {
+	// SaveOffsets сохраняет следующие смещения после сообщений sources; смещение не уменьшается
+	SaveOffsets(ctx context.Context, sources []*models.Source) error
+	// LoadOffsets возвращает следующие смещения партиций топика для группы
+	LoadOffsets(ctx context.Context, group, topic string) (map[int]int64, error)
+}
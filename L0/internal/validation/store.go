@@ -0,0 +1,77 @@
+// Package validation загружает правила валидации заказов из файла
+// и перечитывает их при изменении без перезапуска сервиса.
+package validation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"order-service/internal/filewatch"
+	"order-service/internal/models"
+	"os"
+	"sync"
+	"time"
+)
+
+// Store хранит актуальные правила и перечитывает файл при изменении
+type Store struct {
+	path  string
+	watch *filewatch.Watcher
+
+	mu    sync.RWMutex
+	rules *models.Rules
+}
+
+// NewStore загружает правила из файла. Ошибка загрузки при старте фатальна.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	s.watch = filewatch.New(s.load, path)
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate проверяет заказ встроенными проверками и актуальными правилами
+func (s *Store) Validate(order *models.Order) error {
+	return s.Rules().Validate(order)
+}
+
+// Rules возвращает текущий набор правил
+func (s *Store) Rules() *models.Rules {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rules
+}
+
+// Reload перечитывает файл, если он изменился. Возвращает true, если правила обновлены;
+// с некорректным файлом продолжают действовать прежние правила.
+func (s *Store) Reload() (bool, error) {
+	return s.watch.Reload()
+}
+
+// load разбирает файл правил и заменяет ими текущие
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read validation rules %s: %w", s.path, err)
+	}
+	rules, err := models.ParseRules(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+
+	log.Printf("level=info component=validation event=rules_loaded path=%q rulesets=%d", s.path, len(rules.RuleSets))
+	return nil
+}
+
+// Watch проверяет файл правил с интервалом interval до отмены контекста
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	s.watch.Watch(ctx, interval, func(err error) {
+		log.Printf("level=error component=validation event=rules_reload_failed path=%q err=%v", s.path, err)
+	})
+}
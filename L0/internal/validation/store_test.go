@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeRules записывает файл правил и сдвигает время изменения,
+// чтобы Reload заметил запись даже при грубом разрешении mtime
+func writeRules(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		data        string
+		touch       bool // Изменить время файла
+		wantChanged bool
+		wantErr     bool
+		wantRuleSet string // Имя первого набора после Reload
+	}{
+		{name: "unchanged file is not reparsed", data: "not: [valid", wantRuleSet: "initial"},
+		{name: "changed file replaces rules", data: "rulesets: [{name: updated}]", touch: true, wantChanged: true, wantRuleSet: "updated"},
+		{name: "invalid yaml keeps previous rules", data: "rulesets: [", touch: true, wantErr: true, wantRuleSet: "initial"},
+		{name: "invalid ruleset keeps previous rules", data: "rulesets: [{name: a, patterns: {zip: '['}}]", touch: true, wantErr: true, wantRuleSet: "initial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			writeRules(t, path, "rulesets: [{name: initial}]", start)
+			s, err := NewStore(path)
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+
+			modTime := start
+			if tt.touch {
+				modTime = start.Add(time.Minute)
+			}
+			writeRules(t, path, tt.data, modTime)
+
+			changed, err := s.Reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Reload() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := s.Rules().RuleSets[0].Name; got != tt.wantRuleSet {
+				t.Errorf("ruleset = %q, want %q", got, tt.wantRuleSet)
+			}
+		})
+	}
+}
+
+func TestStoreRetriesFailedReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	start := time.Now().Add(-time.Hour)
+	writeRules(t, path, "rulesets: [{name: initial}]", start)
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	// Исправленный файл с тем же временем изменения, что и у неудачной версии, все равно загружается
+	broken := start.Add(time.Minute)
+	writeRules(t, path, "rulesets: [", broken)
+	if _, err := s.Reload(); err == nil {
+		t.Fatal("Reload() error = nil, want parse error")
+	}
+	writeRules(t, path, "rulesets: [{name: fixed}]", broken)
+	if changed, err := s.Reload(); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v; want true, nil", changed, err)
+	}
+	if got := s.Rules().RuleSets[0].Name; got != "fixed" {
+		t.Errorf("ruleset = %q, want fixed", got)
+	}
+}
+
+func TestNewStoreFails(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yaml")
+	writeRules(t, invalid, "rulesets: [{patterns: {zip: x}}]", time.Now())
+
+	for _, path := range []string{filepath.Join(dir, "missing.yaml"), invalid} {
+		if _, err := NewStore(path); err == nil {
+			t.Errorf("NewStore(%s) error = nil, want error", filepath.Base(path))
+		}
+	}
+}
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uq_items_order_uid_rid;
@@ -0,0 +1,9 @@
+-- Удаление дубликатов товаров, появившихся из-за повторной доставки сообщений
+DELETE FROM items a
+	USING items b
+	WHERE a.order_uid = b.order_uid
+		AND a.rid = b.rid
+		AND a.id < b.id;
+
+-- Уникальность товара в рамках заказа для upsert
+CREATE UNIQUE INDEX IF NOT EXISTS uq_items_order_uid_rid ON items(order_uid, rid);
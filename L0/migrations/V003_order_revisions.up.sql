@@ -0,0 +1,12 @@
+-- Журнал ревизий заказа (только добавление)
+CREATE TABLE IF NOT EXISTS order_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	order_uid VARCHAR(255) NOT NULL,
+	revision INTEGER NOT NULL,
+	data JSONB NOT NULL,
+	source_topic VARCHAR(255),
+	source_partition INTEGER,
+	source_offset BIGINT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT uq_order_revisions_order_uid_revision UNIQUE (order_uid, revision)
+);
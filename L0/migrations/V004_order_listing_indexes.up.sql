@@ -0,0 +1,6 @@
+-- Индексы для списка заказов с фильтрами и курсорной пагинацией
+CREATE INDEX IF NOT EXISTS idx_orders_created_at_uid ON orders(created_at DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
+CREATE INDEX IF NOT EXISTS idx_orders_delivery_service ON orders(delivery_service);
+CREATE INDEX IF NOT EXISTS idx_payments_currency_provider ON payments(currency, provider);
+CREATE INDEX IF NOT EXISTS idx_items_brand ON items(brand);
@@ -0,0 +1,2 @@
+-- Индекс для поиска заказа по транзакции оплаты
+CREATE INDEX IF NOT EXISTS idx_payments_transaction ON payments(transaction);
@@ -0,0 +1,9 @@
+-- Смещения Kafka, сохраняемые в одной транзакции с заказами
+CREATE TABLE IF NOT EXISTS consumer_offsets (
+	group_id VARCHAR(255) NOT NULL,
+	topic VARCHAR(255) NOT NULL,
+	partition INTEGER NOT NULL,
+	next_offset BIGINT NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_id, topic, partition)
+);
@@ -0,0 +1,3 @@
+-- Отмена заказа событием из Kafka; NULL — заказ не отменен
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_reason TEXT NOT NULL DEFAULT '';
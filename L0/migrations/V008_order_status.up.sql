@@ -0,0 +1,18 @@
+-- Этап жизненного цикла заказа (коды models.Status)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status INTEGER NOT NULL DEFAULT 200;
+UPDATE orders SET status = 206 WHERE cancelled_at IS NOT NULL;
+
+-- Журнал переходов между этапами заказа (rid пустой) и товаров (только добавление)
+CREATE TABLE IF NOT EXISTS order_status_transitions (
+	id BIGSERIAL PRIMARY KEY,
+	order_uid VARCHAR(255) NOT NULL,
+	rid VARCHAR(255) NOT NULL DEFAULT '',
+	from_status INTEGER NOT NULL,
+	to_status INTEGER NOT NULL,
+	occurred_at TIMESTAMP NOT NULL,
+	source_topic VARCHAR(255),
+	source_partition INTEGER,
+	source_offset BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_transitions_order_uid ON order_status_transitions(order_uid, id);
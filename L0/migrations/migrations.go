@@ -0,0 +1,11 @@
+// Package migrations встраивает SQL миграции схемы в бинарный файл.
+//
+// Файлы называются V<версия>_<имя>.up.sql и V<версия>_<имя>.down.sql.
+package migrations
+
+import "embed"
+
+// FS содержит все файлы миграций
+//
+//go:embed *.sql
+var FS embed.FS
@@ -197,11 +197,11 @@ func generateTestOrders() []TestOrder {
 				RequestID:    "req_001",
 				Currency:     "RUB",
 				Provider:     "sberbank",
-				Amount:       2500,
+				Amount:       2485,
 				PaymentDt:    time.Now().Unix(),
 				Bank:         "sberbank",
 				DeliveryCost: 300,
-				GoodsTotal:   2200,
+				GoodsTotal:   2185,
 				CustomFee:    0,
 			},
 			Items: []TestItem{
@@ -259,11 +259,11 @@ func generateTestOrders() []TestOrder {
 				RequestID:    "req_002",
 				Currency:     "RUB",
 				Provider:     "yandex_money",
-				Amount:       3200,
+				Amount:       2690,
 				PaymentDt:    time.Now().Unix(),
 				Bank:         "vtb",
 				DeliveryCost: 400,
-				GoodsTotal:   2800,
+				GoodsTotal:   2240,
 				CustomFee:    50,
 			},
 			Items: []TestItem{